@@ -0,0 +1,170 @@
+package route
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MediaRange is a media range of an Accept header, e.g. text/html, text/* or */*,
+// with its parameters except the quality. Types and parameter names are lower case.
+type MediaRange struct {
+	Type    string
+	Params  map[string]string
+	Quality float64
+}
+
+// specificity ranks */* below type/* below type/subtype below type/subtype with parameters.
+func (m MediaRange) specificity() int {
+	switch {
+	case m.Type == "*/*":
+		return 0
+	case strings.HasSuffix(m.Type, "/*"):
+		return 1
+	case len(m.Params) > 0:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// matches reports whether the media type with its parameters is within the range.
+// Parameter values compare case insensitively like the common charset parameter.
+func (m MediaRange) matches(mediaType string, params map[string]string) bool {
+	major, _, _ := strings.Cut(mediaType, "/")
+	switch {
+	case m.Type == "*/*":
+	case strings.HasSuffix(m.Type, "/*"):
+		if m.Type != major+"/*" {
+			return false
+		}
+	case m.Type != mediaType:
+		return false
+	}
+	for key, value := range m.Params {
+		if !strings.EqualFold(params[key], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// AcceptList is the media ranges of an Accept header ordered by preference,
+// highest quality first and more specific ranges before less specific ones of the same quality.
+type AcceptList []MediaRange
+
+// Quality returns the quality the client gives the media type, e.g. application/json or
+// text/html; charset=utf-8, by the most specific matching range. It is 0 for unacceptable media types.
+func (a AcceptList) Quality(mediaType string) float64 {
+	mediaType, params, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return 0
+	}
+	best, quality := -1, 0.0
+	for _, m := range a {
+		if m.specificity() > best && m.matches(mediaType, params) {
+			best, quality = m.specificity(), m.Quality
+		}
+	}
+	return quality
+}
+
+// Accepts reports whether the client accepts the media type.
+func (a AcceptList) Accepts(mediaType string) bool {
+	return a.Quality(mediaType) > 0
+}
+
+// Negotiate returns the offered media type the client prefers, the first one on equal quality.
+// It returns an empty string if the client accepts none of them.
+func (a AcceptList) Negotiate(offers ...string) string {
+	best, quality := "", 0.0
+	for _, offer := range offers {
+		if q := a.Quality(offer); q > quality {
+			best, quality = offer, q
+		}
+	}
+	return best
+}
+
+// Accept returns a FieldOption that binds the Accept header parsed as specified by RFC 9110 into an
+// AcceptList field, for handlers negotiating the representation themselves. Call it with ByType(Accept()).
+// Without Accept header the list accepts every media type, malformed headers are rejected with 400.
+func Accept() FieldOption[*AcceptList] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*AcceptList], error) {
+		return func(r *request, v *AcceptList) (func(error) error, error) {
+			list, err := parseAccept(r.Header.Values("Accept"))
+			if err != nil {
+				return nil, WithStatus(http.StatusBadRequest, err)
+			}
+			*v = list
+			return nil, nil
+		}, nil
+	}
+}
+
+func parseAccept(headers []string) (AcceptList, error) {
+	if len(headers) == 0 {
+		return AcceptList{{Type: "*/*", Quality: 1}}, nil
+	}
+	var list AcceptList
+	for _, header := range headers {
+		for _, part := range splitQuoted(header, ',') {
+			if strings.TrimSpace(part) == "" {
+				continue
+			}
+			mediaType, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Accept media range %q: %w", strings.TrimSpace(part), err)
+			}
+			if !strings.Contains(mediaType, "/") || strings.HasPrefix(mediaType, "*/") && mediaType != "*/*" {
+				return nil, Messagef("invalid Accept media range %q", mediaType)
+			}
+			m := MediaRange{Type: mediaType, Quality: 1}
+			if q, ok := params["q"]; ok {
+				m.Quality, err = strconv.ParseFloat(q, 64)
+				if err != nil || m.Quality < 0 || m.Quality > 1 || len(q) > 5 {
+					return nil, Messagef("invalid Accept quality %q of %s", q, mediaType)
+				}
+				delete(params, "q")
+			}
+			if len(params) > 0 {
+				m.Params = params
+			}
+			list = append(list, m)
+		}
+	}
+	slices.SortStableFunc(list, func(a, b MediaRange) int {
+		if a.Quality != b.Quality {
+			if a.Quality > b.Quality {
+				return -1
+			}
+			return 1
+		}
+		return b.specificity() - a.specificity()
+	})
+	return list, nil
+}
+
+// splitQuoted splits s at sep outside of quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped, start := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,247 @@
+package route
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobStatus is the state of an async job.
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is an async job submitted by a route handler wrapped with Async.
+// Result holds the JSON encoded output of a succeeded job, Error and ErrorStatus the error of a failed one.
+// Error is safe to show clients: the text of a Message error below 500, the status text otherwise.
+type Job struct {
+	ID          string          `json:"id"`
+	Status      JobStatus       `json:"status"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	ErrorStatus int             `json:"-"`
+	Created     time.Time       `json:"created"`
+	Updated     time.Time       `json:"updated"`
+
+	// err is the error of a failed job for the error handler, stores that persist jobs drop it.
+	err error
+}
+
+// JobStore persists async jobs, e.g. in a database so their state outlives the process.
+type JobStore interface {
+	Save(ctx context.Context, job Job) error
+	Load(ctx context.Context, id string) (Job, bool, error)
+}
+
+// MemoryJobStore is a JobStore holding the jobs in memory. Its zero value is ready to use.
+type MemoryJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+func (s *MemoryJobStore) Save(ctx context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jobs == nil {
+		s.jobs = map[string]Job{}
+	}
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryJobStore) Load(ctx context.Context, id string) (Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	return job, ok, nil
+}
+
+// Jobs runs the async jobs of Async handlers in a pool of workers and keeps their state in a JobStore.
+type Jobs struct {
+	store JobStore
+	queue chan func()
+	path  string
+	wg    sync.WaitGroup
+}
+
+// NewJobs returns Jobs running up to workers jobs at a time with up to queue jobs waiting.
+// Register its status routes with AsyncJobs and stop its workers with Close.
+func NewJobs(store JobStore, workers, queue int) *Jobs {
+	j := &Jobs{store: store, queue: make(chan func(), queue)}
+	j.wg.Add(workers)
+	for range workers {
+		go func() {
+			defer j.wg.Done()
+			for run := range j.queue {
+				run()
+			}
+		}()
+	}
+	return j
+}
+
+// Close waits for the queued jobs to finish and stops the workers. Submitting jobs afterwards panics.
+func (j *Jobs) Close() {
+	close(j.queue)
+	j.wg.Wait()
+}
+
+// Accepted is the output of Async handlers. It answers with 202 Accepted, the job and
+// a Location header pointing at the status route of the job.
+type Accepted struct {
+	Job      Job
+	Location string
+}
+
+func (a Accepted) Respond(w http.ResponseWriter, r *http.Request) error {
+	if a.Location != "" {
+		w.Header().Set("Location", a.Location)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	return json.NewEncoder(w).Encode(a.Job)
+}
+
+// Async returns a handler for long running handlers to register like Post(Async(jobs, handler)).
+// It submits the handler as a job and answers with Accepted, the handler runs in a worker of jobs
+// with a context that is not canceled with the request. Full queues are rejected with 503.
+func Async[Input, Output any](jobs *Jobs, handler func(context.Context, Input) (Output, error)) func(context.Context, Input) (Accepted, error) {
+	return func(ctx context.Context, in Input) (Accepted, error) {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return Accepted{}, err
+		}
+		now := time.Now()
+		job := Job{ID: hex.EncodeToString(id), Status: JobPending, Created: now, Updated: now}
+		if err := jobs.store.Save(ctx, job); err != nil {
+			return Accepted{}, fmt.Errorf("saving job: %w", err)
+		}
+
+		accepted := Accepted{Job: job}
+		if jobs.path != "" {
+			accepted.Location = prefixed(ctx, jobs.path+"/"+job.ID)
+		}
+
+		ctx = context.WithoutCancel(ctx)
+		run := func() {
+			job.Status, job.Updated = JobRunning, time.Now()
+			_ = jobs.store.Save(ctx, job)
+
+			output, err := runJob(ctx, in, handler)
+			if err == nil {
+				job.Result, err = json.Marshal(output)
+			}
+			if err != nil {
+				job.Status, job.ErrorStatus, job.err = JobFailed, StatusCode(err), err
+				job.Error = clientMessage(err)
+			} else {
+				job.Status = JobSucceeded
+			}
+			job.Updated = time.Now()
+			_ = jobs.store.Save(ctx, job)
+		}
+		select {
+		case jobs.queue <- run:
+		default:
+			return Accepted{}, WithStatus(http.StatusServiceUnavailable, Messagef("job queue is full"))
+		}
+		return accepted, nil
+	}
+}
+
+// clientMessage returns the text of a Message error below 500 and the status text otherwise,
+// so internals of failed jobs don't reach clients.
+func clientMessage(err error) string {
+	status := StatusCode(err)
+	var message *Message
+	if status < http.StatusInternalServerError && errors.As(err, &message) {
+		return message.Error()
+	}
+	return http.StatusText(status)
+}
+
+// runJob calls the handler of a job, a panic fails the job with a PanicError instead of the process.
+func runJob[Input, Output any](ctx context.Context, in Input, handler func(context.Context, Input) (Output, error)) (output Output, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = newPanicError(p)
+		}
+	}()
+	return handler(ctx, in)
+}
+
+// AsyncJobs returns an Option that registers the status route of the jobs at path/{id} answering with the Job
+// and the result route at path/{id}/result answering with the result of succeeded jobs, the error of
+// failed ones and 202 Accepted with the job while it is still pending or running.
+func AsyncJobs(path string, jobs *Jobs) Option {
+	return func(r *router) error {
+		cfg := r.config
+		load := func(w http.ResponseWriter, req *http.Request, segment int) (Job, bool) {
+			segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+			id := segments[len(segments)-segment]
+			job, ok, err := jobs.store.Load(req.Context(), id)
+			if err == nil && !ok {
+				err = WithStatus(http.StatusNotFound, Messagef("job %s not found", id))
+			}
+			if err != nil {
+				cfg.HandleErr(req.Context(), w, err)
+				return Job{}, false
+			}
+			return job, true
+		}
+
+		route := r.fixedRoute(http.MethodGet, path)
+		jobs.path = route.pattern()
+		route.addVarToPath("id")
+		r.register(route.node, RouteInfo{
+			Method:  http.MethodGet,
+			Pattern: route.pattern(),
+			Handler: "async job status",
+		}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if job, ok := load(w, req, 1); ok {
+				writeJSON(w, job)
+			}
+		}))
+
+		route.addFixedToPath("result")
+		r.register(route.node, RouteInfo{
+			Method:  http.MethodGet,
+			Pattern: route.pattern(),
+			Handler: "async job result",
+		}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			job, ok := load(w, req, 2)
+			if !ok {
+				return
+			}
+			switch job.Status {
+			case JobSucceeded:
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				_, _ = w.Write(job.Result)
+			case JobFailed:
+				err := job.err
+				if err == nil {
+					err = WithStatus(job.ErrorStatus, errors.New(job.Error))
+				}
+				cfg.HandleErr(req.Context(), w, err)
+			default:
+				_ = Accepted{Job: job, Location: prefixed(req.Context(), jobs.path+"/"+job.ID)}.Respond(w, req)
+			}
+		}))
+		return nil
+	}
+}
@@ -0,0 +1,144 @@
+package route
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// AuditRecord describes a handled request for audit trails.
+type AuditRecord struct {
+	Time      time.Time
+	Principal string
+	Method    string
+	Pattern   string
+	Path      string
+	// Input is the bound input of typed routes, nil if binding failed before or the route is untyped.
+	Input   any
+	Status  int
+	Latency time.Duration
+	Err     error
+}
+
+// Audit returns an Option that calls record after each request to the routes registered after it.
+// Principal identifies the requesting principal, e.g. from a verified token; it may be nil.
+func Audit(principal func(*http.Request) string, record func(context.Context, AuditRecord)) Option {
+	return func(r *router) error {
+		r.audit = &audit{principal: principal, record: record}
+		return nil
+	}
+}
+
+type audit struct {
+	principal func(*http.Request) string
+	record    func(context.Context, AuditRecord)
+}
+
+func (a *audit) wrap(info RouteInfo, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		handler.ServeHTTP(sw, r)
+
+		record := AuditRecord{
+			Time:    start,
+			Method:  r.Method,
+			Pattern: info.Pattern,
+			Path:    r.URL.Path,
+			Status:  sw.Status(),
+			Latency: time.Since(start),
+		}
+		// the request the handler saw carries what middleware added, e.g. authentication
+		inner := r
+		if ex, ok := exchangeFrom(r.Context()); ok {
+			inner = ex.request
+			record.Input = ex.input
+			record.Err = ex.err
+		}
+		if a.principal != nil {
+			record.Principal = a.principal(inner)
+		}
+		a.record(r.Context(), record)
+	})
+}
+
+// SlowRecord describes a request that exceeded the latency budget of SlowRequest.
+type SlowRecord struct {
+	Method   string
+	Pattern  string
+	Path     string
+	Duration time.Duration
+	// Input is the bound input of typed routes, nil if binding failed before or the route is untyped.
+	Input any
+}
+
+// SlowRequest returns an Option that calls slow after each request to the routes registered after it
+// that took longer than threshold, e.g. to drive alerting without full tracing.
+func SlowRequest(threshold time.Duration, slow func(context.Context, SlowRecord)) Option {
+	return func(r *router) error {
+		r.slow = &slowRequest{threshold: threshold, slow: slow}
+		return nil
+	}
+}
+
+type slowRequest struct {
+	threshold time.Duration
+	slow      func(context.Context, SlowRecord)
+}
+
+func (s *slowRequest) wrap(info RouteInfo, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		handler.ServeHTTP(w, r)
+		duration := time.Since(start)
+		if duration <= s.threshold {
+			return
+		}
+		record := SlowRecord{
+			Method:   r.Method,
+			Pattern:  info.Pattern,
+			Path:     r.URL.Path,
+			Duration: duration,
+		}
+		if ex, ok := exchangeFrom(r.Context()); ok {
+			record.Input = ex.input
+		}
+		s.slow(r.Context(), record)
+	})
+}
+
+// FieldRecord describes the binding of an input field by its FieldOptions.
+type FieldRecord struct {
+	Method   string
+	Pattern  string
+	Field    string
+	Duration time.Duration
+	Err      error
+}
+
+// FieldMetrics returns an Option that calls record after binding each input field of the routes registered
+// after it, so timings and failure counts per field show whether e.g. body decoding or token verification
+// dominates the latency of a route. Lazy fields are recorded when they are set up, not when they are bound.
+func FieldMetrics(record func(context.Context, FieldRecord)) Option {
+	return func(r *router) error {
+		r.fieldMetrics = record
+		return nil
+	}
+}
+
+// bindField binds the field with its FieldOptions and records the binding if the config asks for field metrics.
+func (c *config) bindField(ctx context.Context, route route, i int, r *request, v any) (func(error) error, error) {
+	if c.fieldMetrics == nil {
+		return route.fields[i](r, v)
+	}
+	start := time.Now()
+	close, err := route.fields[i](r, v)
+	c.fieldMetrics(ctx, FieldRecord{
+		Method:   route.method,
+		Pattern:  route.pattern(),
+		Field:    route.names[i],
+		Duration: time.Since(start),
+		Err:      err,
+	})
+	return close, err
+}
@@ -0,0 +1,52 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+)
+
+// Authenticate returns an Option that sets how the routes registered after it learn the scopes granted
+// to the principal of a request, e.g. from a verified bearer token. Scopes are nil for requests without
+// valid credentials. RequireScopes relies on it.
+func Authenticate(scopes func(*http.Request) []string) Option {
+	return func(r *router) error {
+		r.authenticate = scopes
+		return nil
+	}
+}
+
+// RequireScopes returns an Option that only lets requests whose principal is granted all scopes through
+// to the routes registered after it. Requests without valid credentials are rejected with 401, those
+// lacking a scope with 403. Without scopes it only requires valid credentials. It needs Authenticate before it.
+func RequireScopes(scopes ...string) Option {
+	return func(r *router) error {
+		if r.authenticate == nil {
+			return errors.New("RequireScopes needs Authenticate before it")
+		}
+		r.requiredScopes = &requiredScopes{authenticate: r.authenticate, scopes: scopes}
+		return nil
+	}
+}
+
+type requiredScopes struct {
+	authenticate func(*http.Request) []string
+	scopes       []string
+}
+
+func (s *requiredScopes) wrap(cfg *config, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		granted := s.authenticate(r)
+		if granted == nil {
+			cfg.HandleErr(r.Context(), w, WithStatus(http.StatusUnauthorized, Messagef("unauthorized")))
+			return
+		}
+		for _, scope := range s.scopes {
+			if !slices.Contains(granted, scope) {
+				cfg.HandleErr(r.Context(), w, WithStatus(http.StatusForbidden, Messagef("missing scope %s", scope)))
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
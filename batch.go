@@ -0,0 +1,97 @@
+package route
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// BatchRequest is a sub-request of a Batch. Body is sent as JSON, Header adds to the headers of the batch request.
+type BatchRequest struct {
+	Method string            `json:"method"`
+	Path   string            `json:"path"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResponse is the response to a BatchRequest. Body holds JSON responses as is and other ones as string.
+type BatchResponse struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   json.RawMessage   `json:"body,omitempty"`
+}
+
+// Batch returns an Option that mounts an endpoint at path accepting POST requests with a JSON array of
+// BatchRequests. Each one is routed through the router in order as if it was sent on its own with the
+// headers of the batch request, and answered in a JSON array of BatchResponses at the same position.
+// Batches of more than max sub-requests are rejected with 413, batches within batches with 400.
+func Batch(path string, max int) Option {
+	return func(r *router) error {
+		route := r.fixedRoute(http.MethodPost, path)
+		pattern := route.pattern()
+		cfg := r.config
+		r.register(route.node, RouteInfo{
+			Method:  http.MethodPost,
+			Pattern: pattern,
+			Handler: "batch",
+		}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var batch []BatchRequest
+			if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+				cfg.HandleErr(req.Context(), w, WithStatus(http.StatusBadRequest, fmt.Errorf("decoding batch: %w", err)))
+				return
+			}
+			if len(batch) > max {
+				cfg.HandleErr(req.Context(), w, WithStatus(http.StatusRequestEntityTooLarge, Messagef("batch of %d requests exceeds %d", len(batch), max)))
+				return
+			}
+
+			responses := make([]BatchResponse, len(batch))
+			for i, sub := range batch {
+				responses[i] = r.serveBatched(req, pattern, sub)
+			}
+			writeJSON(w, responses)
+		}))
+		return nil
+	}
+}
+
+// serveBatched routes the sub-request of the batch request and records its response.
+func (r *router) serveBatched(batch *http.Request, pattern string, sub BatchRequest) BatchResponse {
+	recorder := newResponseRecorder()
+	subReq, err := http.NewRequestWithContext(batch.Context(), strings.ToUpper(sub.Method), sub.Path, bytes.NewReader(sub.Body))
+	switch {
+	case err != nil:
+		r.HandleErr(batch.Context(), recorder, WithStatus(http.StatusBadRequest, err))
+	case strings.TrimSuffix(subReq.URL.Path, "/") == pattern:
+		r.HandleErr(batch.Context(), recorder, WithStatus(http.StatusBadRequest, Messagef("nested batch")))
+	default:
+		subReq.Header = batch.Header.Clone()
+		subReq.Header.Del("Content-Length")
+		if len(sub.Body) > 0 {
+			subReq.Header.Set("Content-Type", "application/json")
+		}
+		for key, value := range sub.Header {
+			subReq.Header.Set(key, value)
+		}
+		subReq.RemoteAddr = batch.RemoteAddr
+		subReq.TLS = batch.TLS
+		r.ServeHTTP(recorder, subReq)
+	}
+
+	recorded := recorder.response()
+	response := BatchResponse{Status: recorded.Status, Header: map[string]string{}}
+	for key := range recorded.Header {
+		response.Header[key] = recorded.Header.Get(key)
+	}
+	body := bytes.TrimSpace(recorded.Body)
+	switch {
+	case len(body) == 0:
+	case json.Valid(body):
+		response.Body = body
+	default:
+		response.Body, _ = json.Marshal(string(body))
+	}
+	return response
+}
@@ -0,0 +1,104 @@
+package route
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// BodyLogger returns a middleware that logs request and response bodies up to limit bytes each for audit purposes.
+// Values of JSON object fields named like one of redact, e.g. password or token, are replaced
+// case-insensitively before logging. If redaction is requested, bodies that can not be redacted
+// because they are no valid JSON, e.g. because they exceed the limit, are not logged.
+// Add it with Middleware.
+func BodyLogger(logger *slog.Logger, limit int, redact ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var reqBody []byte
+			if r.Body != nil {
+				captured, err := io.ReadAll(io.LimitReader(r.Body, int64(limit)))
+				if err != nil {
+					logger.WarnContext(r.Context(), "reading request body", "error", err)
+				}
+				reqBody = captured
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(captured), r.Body), r.Body}
+			}
+
+			capture := &bodyCapture{ResponseWriter: w, limit: limit, status: http.StatusOK}
+			next.ServeHTTP(capture, r)
+
+			logger.InfoContext(r.Context(), "http body",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", capture.status,
+				"request", redactBody(reqBody, redact),
+				"response", redactBody(capture.body.Bytes(), redact),
+			)
+		})
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type bodyCapture struct {
+	http.ResponseWriter
+	limit  int
+	status int
+	body   bytes.Buffer
+}
+
+func (c *bodyCapture) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	if rest := c.limit - c.body.Len(); rest > 0 {
+		c.body.Write(p[:min(rest, len(p))])
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+func (c *bodyCapture) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+func redactBody(body []byte, redact []string) string {
+	if len(redact) == 0 || len(body) == 0 {
+		return string(body)
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "[REDACTED]"
+	}
+	b, err := json.Marshal(redactValue(v, redact))
+	if err != nil {
+		return "[REDACTED]"
+	}
+	return string(b)
+}
+
+func redactValue(v any, redact []string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if slices.ContainsFunc(redact, func(name string) bool { return strings.EqualFold(name, key) }) {
+				v[key] = "[REDACTED]"
+				continue
+			}
+			v[key] = redactValue(value, redact)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(value, redact)
+		}
+	}
+	return v
+}
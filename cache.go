@@ -0,0 +1,240 @@
+package route
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedResponse is an encoded response.
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+func (c CachedResponse) writeTo(w http.ResponseWriter) {
+	header := w.Header()
+	for key, values := range c.Header {
+		header[key] = values
+	}
+	w.WriteHeader(c.Status)
+	_, _ = w.Write(c.Body)
+}
+
+// CacheStore keeps cached responses, e.g. in memory or in Redis.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (CachedResponse, bool, error)
+	// Set stores the response for ttl and associates it with the invalidation tags.
+	Set(ctx context.Context, key string, response CachedResponse, ttl time.Duration, tags []string) error
+	// Invalidate drops all responses associated with one of the tags.
+	Invalidate(ctx context.Context, tags ...string) error
+}
+
+// ResponseCache returns an Option that caches successful GET responses of the routes registered after it in store for ttl.
+// Responses are keyed by route pattern, host, path, normalized query, the tenant resolved by Tenants
+// and the values of the vary request headers.
+// Handlers tag responses with CacheTags and drop tagged responses with InvalidateCache.
+// Responses setting cookies or marked Cache-Control no-store or private are not cached, neither are requests
+// carrying Authorization or Cookie headers unless those are vary headers, so responses never leak to other users.
+// Hop-by-hop headers are not stored.
+func ResponseCache(store CacheStore, ttl time.Duration, vary ...string) Option {
+	return func(r *router) error {
+		r.cache = &responseCache{store: store, ttl: ttl, vary: vary}
+		return nil
+	}
+}
+
+// CacheTags tags the response of the current request for invalidation with InvalidateCache.
+func CacheTags(ctx context.Context, tags ...string) {
+	if ex, ok := exchangeFrom(ctx); ok {
+		ex.cacheTags = append(ex.cacheTags, tags...)
+	}
+}
+
+// InvalidateCache drops the cached responses tagged with one of the tags from the cache store of the current route.
+func InvalidateCache(ctx context.Context, tags ...string) error {
+	ex, ok := exchangeFrom(ctx)
+	if !ok || ex.cache == nil {
+		return nil
+	}
+	return ex.cache.store.Invalidate(ctx, tags...)
+}
+
+type responseCache struct {
+	store CacheStore
+	ttl   time.Duration
+	vary  []string
+}
+
+func (c *responseCache) wrap(info RouteInfo, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		ex, ok := exchangeFrom(ctx)
+		if ok {
+			ex.cache = c
+		}
+		if r.Method != http.MethodGet || !ok || !shareable(r, c.vary) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		for _, name := range c.vary {
+			w.Header().Add("Vary", name)
+		}
+		key := requestKey(info, r, c.vary)
+		if cached, ok, err := c.store.Get(ctx, key); err == nil && ok {
+			w.Header().Set("X-Cache", "HIT")
+			cached.writeTo(w)
+			return
+		}
+
+		rec := newResponseRecorder()
+		handler.ServeHTTP(rec, r)
+		response := rec.response()
+		if response.Status == http.StatusOK && cacheable(response.Header) {
+			stored := response
+			stored.Header = response.Header.Clone()
+			for _, name := range hopByHopHeaders {
+				stored.Header.Del(name)
+			}
+			_ = c.store.Set(ctx, key, stored, c.ttl, ex.cacheTags)
+		}
+		w.Header().Set("X-Cache", "MISS")
+		response.writeTo(w)
+	})
+}
+
+// shareable reports whether responses to the request may be served to other requests, which is not
+// the case for requests carrying credentials the cache key does not vary by.
+func shareable(r *http.Request, vary []string) bool {
+	for _, name := range []string{"Authorization", "Cookie"} {
+		if r.Header.Get(name) != "" && !slices.ContainsFunc(vary, func(vary string) bool { return strings.EqualFold(vary, name) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// hopByHopHeaders only apply to a single connection and must not be replayed from the cache.
+var hopByHopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// cacheable reports whether a response with the header may be stored by a shared cache.
+func cacheable(header http.Header) bool {
+	if len(header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if strings.EqualFold(name, "no-store") || strings.EqualFold(name, "private") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// requestKey identifies requests to a route by path, normalized query and the values of the vary headers.
+func requestKey(info RouteInfo, r *http.Request, vary []string) string {
+	var key strings.Builder
+	key.WriteString(info.Pattern)
+	key.WriteString(" ")
+	key.WriteString(r.Host)
+	key.WriteString(r.URL.EscapedPath())
+	key.WriteString("?")
+	key.WriteString(r.URL.Query().Encode())
+	if tenant, ok := TenantFromContext(r.Context()); ok {
+		key.WriteString("\ntenant: ")
+		key.WriteString(tenant.ID)
+	}
+	for _, name := range vary {
+		key.WriteString("\n")
+		key.WriteString(name)
+		key.WriteString(": ")
+		key.WriteString(strings.Join(r.Header.Values(name), ", "))
+	}
+	return key.String()
+}
+
+// NewMemoryCache returns a CacheStore keeping up to capacity responses in memory,
+// evicting the least recently used ones first.
+func NewMemoryCache(capacity int) CacheStore {
+	return &memoryCache{capacity: capacity, entries: map[string]*list.Element{}}
+}
+
+type memoryCache struct {
+	mu       sync.Mutex
+	capacity int
+	lru      list.List
+	entries  map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	key      string
+	response CachedResponse
+	expires  time.Time
+	tags     []string
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) (CachedResponse, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return CachedResponse{}, false, nil
+	}
+	entry := element.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		return CachedResponse{}, false, nil
+	}
+	c.lru.MoveToFront(element)
+	return entry.response, true, nil
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, response CachedResponse, ttl time.Duration, tags []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.lru.PushFront(&memoryCacheEntry{
+		key:      key,
+		response: response,
+		expires:  time.Now().Add(ttl),
+		tags:     tags,
+	})
+	for c.lru.Len() > c.capacity {
+		c.remove(c.lru.Back())
+	}
+	return nil
+}
+
+func (c *memoryCache) Invalidate(ctx context.Context, tags ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for element := c.lru.Front(); element != nil; {
+		next := element.Next()
+		for _, tag := range element.Value.(*memoryCacheEntry).tags {
+			if slices.Contains(tags, tag) {
+				c.remove(element)
+				break
+			}
+		}
+		element = next
+	}
+	return nil
+}
+
+func (c *memoryCache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*memoryCacheEntry).key)
+}
@@ -0,0 +1,65 @@
+package route
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Coalesce returns an Option that lets concurrent identical GET requests to the routes registered after it
+// share one handler execution. Requests are identical if their host, path, query, tenant and vary headers match.
+// All of them receive the response of the first one, so use it for idempotent routes only.
+// Requests carrying Authorization or Cookie headers are not coalesced unless those are vary headers.
+func Coalesce(vary ...string) Option {
+	return func(r *router) error {
+		r.coalesce = &coalescer{vary: vary, calls: map[string]*coalescedCall{}}
+		return nil
+	}
+}
+
+type coalescer struct {
+	vary  []string
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done     chan struct{}
+	response CachedResponse
+}
+
+func (c *coalescer) wrap(info RouteInfo, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !shareable(r, c.vary) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		key := requestKey(info, r, c.vary)
+		c.mu.Lock()
+		if call, ok := c.calls[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-call.done:
+				call.response.writeTo(w)
+			case <-r.Context().Done():
+			}
+			return
+		}
+		call := &coalescedCall{done: make(chan struct{})}
+		c.calls[key] = call
+		c.mu.Unlock()
+
+		defer func() {
+			c.mu.Lock()
+			delete(c.calls, key)
+			c.mu.Unlock()
+			close(call.done)
+		}()
+
+		rec := newResponseRecorder()
+		call.response = CachedResponse{Status: http.StatusInternalServerError}
+		handler.ServeHTTP(rec, r)
+		call.response = rec.response()
+		call.response.writeTo(w)
+	})
+}
@@ -0,0 +1,243 @@
+// Package config reads the operational settings of a router from a YAML or JSON file and
+// translates them into route Options, so operators can tune them without code changes:
+//
+//	defaults:
+//	  timeout: 10s
+//	  max_body_size: 1048576
+//	  trusted_proxies: [10.0.0.0/8]
+//	  cors: {allowed_origins: [https://app.example.com], max_age: 10m}
+//	  rate_limit: {rate: 10, burst: 20}
+//	groups:
+//	  reports:
+//	    priority: batch
+//	    concurrency: {max: 4, queue: 16, queue_timeout: 2s}
+//	    auth: {scopes: [reports:read]}
+//
+// Apply the defaults before the routes and the settings of a group within a route.Group.
+// Auth settings need the route.Authenticate of the application before them:
+//
+//	reports, err := cfg.Group("reports")
+//	...
+//	route.New(route.Authenticate(scopes), cfg.Defaults(), route.Group(reports, route.Get(report)))
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/generikvault/route"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the default settings and the settings of named groups of routes.
+type Config struct {
+	Default Settings            `yaml:"defaults"`
+	Groups  map[string]Settings `yaml:"groups"`
+}
+
+// Settings are operational settings of routes. Zero values leave the respective behavior as is.
+type Settings struct {
+	// Timeout cancels the context of requests running longer.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxBodySize limits request bodies in bytes, see route.MaxBodySize.
+	MaxBodySize int64 `yaml:"max_body_size"`
+	// Bulkhead limits concurrent requests per route without queueing, see route.Bulkhead.
+	// It excludes Concurrency.
+	Bulkhead    int          `yaml:"bulkhead"`
+	Concurrency *Concurrency `yaml:"concurrency"`
+	LoadShed    *LoadShed    `yaml:"load_shed"`
+	// Priority is critical, normal or batch, see route.Priority.
+	Priority string `yaml:"priority"`
+	// RequireTLS is redirect or reject, see route.RequireTLS.
+	RequireTLS     string   `yaml:"require_tls"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	CORS      *CORS      `yaml:"cors"`
+	RateLimit *RateLimit `yaml:"rate_limit"`
+	Auth      *Auth      `yaml:"auth"`
+}
+
+// CORS configures route.CORS, see route.CORSPolicy.
+type CORS struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowedHeaders   []string      `yaml:"allowed_headers"`
+	ExposedHeaders   []string      `yaml:"exposed_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+// RateLimit configures route.RateLimit per client address.
+type RateLimit struct {
+	// Rate is the number of requests per second.
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Auth configures route.RequireScopes. Without scopes it only requires valid credentials.
+type Auth struct {
+	Scopes []string `yaml:"scopes"`
+}
+
+// Concurrency configures route.MaxConcurrent.
+type Concurrency struct {
+	Max          int           `yaml:"max"`
+	Queue        int           `yaml:"queue"`
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+}
+
+// LoadShed configures route.LoadShed.
+type LoadShed struct {
+	MaxInFlight int           `yaml:"max_in_flight"`
+	MaxLatency  time.Duration `yaml:"max_latency"`
+}
+
+// Load reads the config file at path, see Parse.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Parse parses and validates a YAML or JSON config. Unknown keys are rejected to catch typos.
+// Durations are given like 1m30s.
+func Parse(data []byte) (*Config, error) {
+	var config Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	errs := []error{config.Default.validate("defaults")}
+	for _, name := range slices.Sorted(maps.Keys(config.Groups)) {
+		errs = append(errs, config.Groups[name].validate("group "+name))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Defaults returns an Option applying the default settings to the routes registered after it.
+func (c *Config) Defaults() route.Option {
+	return c.Default.Option()
+}
+
+// Group returns an Option applying the settings of the named group to the routes registered after it.
+func (c *Config) Group(name string) (route.Option, error) {
+	settings, ok := c.Groups[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown config group %q", name)
+	}
+	return settings.Option(), nil
+}
+
+func (s Settings) validate(name string) error {
+	var errs []error
+	switch s.Priority {
+	case "", "critical", "normal", "batch":
+	default:
+		errs = append(errs, fmt.Errorf("%s: unknown priority %q, want critical, normal or batch", name, s.Priority))
+	}
+	switch s.RequireTLS {
+	case "", "redirect", "reject":
+	default:
+		errs = append(errs, fmt.Errorf("%s: unknown require_tls %q, want redirect or reject", name, s.RequireTLS))
+	}
+	if s.Timeout < 0 || s.MaxBodySize < 0 || s.Bulkhead < 0 {
+		errs = append(errs, fmt.Errorf("%s: negative limit", name))
+	}
+	if s.Concurrency != nil && s.Concurrency.Max <= 0 {
+		errs = append(errs, fmt.Errorf("%s: concurrency max must be positive", name))
+	}
+	if s.Concurrency != nil && s.Bulkhead > 0 {
+		errs = append(errs, fmt.Errorf("%s: bulkhead and concurrency exclude each other", name))
+	}
+	if s.CORS != nil && len(s.CORS.AllowedOrigins) == 0 {
+		errs = append(errs, fmt.Errorf("%s: cors needs allowed_origins", name))
+	}
+	if s.CORS != nil && s.CORS.AllowCredentials && slices.Contains(s.CORS.AllowedOrigins, "*") {
+		errs = append(errs, fmt.Errorf("%s: cors can't allow credentials for any origin", name))
+	}
+	if s.RateLimit != nil && (s.RateLimit.Rate <= 0 || s.RateLimit.Burst < 1) {
+		errs = append(errs, fmt.Errorf("%s: rate_limit needs a positive rate and burst", name))
+	}
+	return errors.Join(errs...)
+}
+
+// Option returns an Option applying the settings to the routes registered after it.
+func (s Settings) Option() route.Option {
+	var opts []route.Option
+	if len(s.TrustedProxies) > 0 {
+		opts = append(opts, route.TrustedProxies(s.TrustedProxies...))
+	}
+	switch s.RequireTLS {
+	case "redirect":
+		opts = append(opts, route.RequireTLS(true))
+	case "reject":
+		opts = append(opts, route.RequireTLS(false))
+	}
+	switch s.Priority {
+	case "critical":
+		opts = append(opts, route.Priority(route.PriorityCritical))
+	case "normal":
+		opts = append(opts, route.Priority(route.PriorityNormal))
+	case "batch":
+		opts = append(opts, route.Priority(route.PriorityBatch))
+	}
+	if s.LoadShed != nil {
+		opts = append(opts, route.LoadShed(s.LoadShed.MaxInFlight, s.LoadShed.MaxLatency))
+	}
+	if s.Bulkhead > 0 {
+		opts = append(opts, route.Bulkhead(s.Bulkhead))
+	}
+	if s.Concurrency != nil {
+		opts = append(opts, route.MaxConcurrent(s.Concurrency.Max, s.Concurrency.Queue, s.Concurrency.QueueTimeout))
+	}
+	if s.MaxBodySize > 0 {
+		opts = append(opts, route.MaxBodySize(s.MaxBodySize))
+	}
+	if s.CORS != nil {
+		opts = append(opts, route.CORS(route.CORSPolicy{
+			AllowedOrigins:   s.CORS.AllowedOrigins,
+			AllowedHeaders:   s.CORS.AllowedHeaders,
+			ExposedHeaders:   s.CORS.ExposedHeaders,
+			AllowCredentials: s.CORS.AllowCredentials,
+			MaxAge:           s.CORS.MaxAge,
+		}))
+	}
+	if s.RateLimit != nil {
+		opts = append(opts, route.RateLimit(s.RateLimit.Rate, s.RateLimit.Burst, nil))
+	}
+	if s.Auth != nil {
+		opts = append(opts, route.RequireScopes(s.Auth.Scopes...))
+	}
+	if s.Timeout > 0 {
+		opts = append(opts, route.Middleware(timeout(s.Timeout)))
+	}
+	return route.Join(opts...)
+}
+
+// timeout returns middleware canceling the request context after d.
+func timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/generikvault/route"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(`
+defaults:
+  timeout: 50ms
+  max_body_size: 8
+groups:
+  reports:
+    priority: batch
+    concurrency: {max: 2, queue: 4, queue_timeout: 1s}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, Settings{Timeout: 50 * time.Millisecond, MaxBodySize: 8}, cfg.Default)
+	assert.Equal(t, &Concurrency{Max: 2, Queue: 4, QueueTimeout: time.Second}, cfg.Groups["reports"].Concurrency)
+
+	fromJSON, err := Parse([]byte(`{"defaults": {"timeout": "50ms", "max_body_size": 8}}`))
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Default, fromJSON.Default)
+
+	_, err = Parse([]byte("defaults:\n  timout: 1s\n"))
+	assert.ErrorContains(t, err, "field timout not found")
+	_, err = Parse([]byte("groups:\n  a:\n    priority: urgent\n    require_tls: maybe\n"))
+	assert.ErrorContains(t, err, `group a: unknown priority "urgent"`)
+	assert.ErrorContains(t, err, `group a: unknown require_tls "maybe"`)
+	_, err = Parse([]byte("defaults:\n  bulkhead: 2\n  concurrency: {max: 2}\n"))
+	assert.ErrorContains(t, err, "bulkhead and concurrency exclude each other")
+	_, err = Parse([]byte("defaults:\n  cors: {allowed_origins: ['*'], allow_credentials: true}\n  rate_limit: {rate: 5}\n"))
+	assert.ErrorContains(t, err, "defaults: cors can't allow credentials for any origin")
+	assert.ErrorContains(t, err, "defaults: rate_limit needs a positive rate and burst")
+}
+
+func TestOptions(t *testing.T) {
+	cfg, err := Parse([]byte(`
+defaults:
+  timeout: 50ms
+  max_body_size: 8
+groups:
+  reports:
+    priority: batch
+`))
+	require.NoError(t, err)
+	reports, err := cfg.Group("reports")
+	require.NoError(t, err)
+	_, err = cfg.Group("admin")
+	assert.EqualError(t, err, `unknown config group "admin"`)
+
+	handler, err := route.New(
+		route.JSONResponse(),
+		route.ByName("Body", route.JSONBody()),
+		route.PathByNameOfFixedTyped(strings.ToLower),
+		cfg.Defaults(),
+		route.Post(func(ctx context.Context, in struct {
+			Echo route.Fixed
+			Body string
+		}) (bool, error) {
+			_, ok := ctx.Deadline()
+			return ok, nil
+		}),
+		route.Group(reports, route.Get(func(ctx context.Context, in struct{ Reports route.Fixed }) (string, error) {
+			return "reports", nil
+		})),
+	)
+	require.NoError(t, err)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", "/echo", strings.NewReader(body)))
+		return w
+	}
+	assert.Equal(t, "true\n", post(`"abc"`).Body.String())
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(`"abcdefghij"`).Code)
+
+	routes, err := route.Routes(route.PathByNameOfFixedTyped(strings.ToLower), route.JSONResponse(), reports, route.Get(func(ctx context.Context, in struct{ Reports route.Fixed }) (string, error) {
+		return "", nil
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, route.PriorityBatch, routes[0].Priority)
+}
+
+func TestAccessOptions(t *testing.T) {
+	cfg, err := Parse([]byte(`
+defaults:
+  cors: {allowed_origins: [https://app.example.com], max_age: 1m}
+  rate_limit: {rate: 1, burst: 1}
+groups:
+  reports:
+    auth: {scopes: [reports:read]}
+`))
+	require.NoError(t, err)
+	reports, err := cfg.Group("reports")
+	require.NoError(t, err)
+
+	handler, err := route.New(
+		route.JSONResponse(),
+		route.PathByNameOfFixedTyped(strings.ToLower),
+		route.Authenticate(func(r *http.Request) []string {
+			return r.Header.Values("X-Scope")
+		}),
+		cfg.Defaults(),
+		route.Group(reports, route.Get(func(ctx context.Context, in struct{ Reports route.Fixed }) (string, error) {
+			return "reports", nil
+		})),
+	)
+	require.NoError(t, err)
+
+	get := func(remoteAddr, scope string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/reports", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Origin", "https://app.example.com")
+		if scope != "" {
+			req.Header.Set("X-Scope", scope)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+	w := get("192.0.2.1:1234", "reports:read")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, http.StatusTooManyRequests, get("192.0.2.1:1234", "reports:read").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("192.0.2.2:1234", "").Code)
+	assert.Equal(t, http.StatusForbidden, get("192.0.2.3:1234", "profile").Code)
+
+	_, err = route.New(cfg.Defaults(), reports)
+	assert.ErrorContains(t, err, "RequireScopes needs Authenticate before it")
+}
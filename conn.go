@@ -0,0 +1,71 @@
+package route
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+)
+
+// ConnMetadata describes the connection a request arrived on, bound by ConnInfo.
+type ConnMetadata struct {
+	LocalAddr  string
+	RemoteAddr string
+	// Protocol is the protocol of the request, e.g. HTTP/1.1 or HTTP/2.0.
+	Protocol string
+	// ALPN is the protocol negotiated during the TLS handshake, empty without TLS.
+	ALPN string
+	TLS  bool
+	// Request is the number of the request on the connection and Reused reports whether
+	// it is not the first one. Both are only known for servers started with Serve.
+	Request int64
+	Reused  bool
+}
+
+// ConnInfo returns a FieldOption that binds the metadata of the connection the request arrived on,
+// e.g. for diagnostics. Call it with ByType(ConnInfo()).
+func ConnInfo() FieldOption[*ConnMetadata] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*ConnMetadata], error) {
+		return func(r *request, v *ConnMetadata) (func(error) error, error) {
+			*v = ConnMetadata{
+				RemoteAddr: r.RemoteAddr,
+				Protocol:   r.Proto,
+				TLS:        r.TLS != nil,
+			}
+			if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+				v.LocalAddr = addr.String()
+			}
+			if r.TLS != nil {
+				v.ALPN = r.TLS.NegotiatedProtocol
+			}
+			if n, ok := r.Context().Value(connRequestKey{}).(int64); ok {
+				v.Request, v.Reused = n, n > 1
+			}
+			return nil, nil
+		}, nil
+	}
+}
+
+type connStateKey struct{}
+
+type connRequestKey struct{}
+
+// connState counts the requests of a connection.
+type connState struct {
+	requests atomic.Int64
+}
+
+func withConnState(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connStateKey{}, &connState{})
+}
+
+// countConnRequests numbers the requests of each connection for ConnInfo.
+func countConnRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if state, ok := r.Context().Value(connStateKey{}).(*connState); ok {
+			r = r.WithContext(context.WithValue(r.Context(), connRequestKey{}, state.requests.Add(1)))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,75 @@
+package route
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// exchange is the state of a request handled by a route.
+// It is stored in the context passed to handlers and encoders.
+type exchange struct {
+	request *http.Request
+	route   *RouteInfo
+	start   time.Time
+	input   any
+	err     error
+
+	cache     *responseCache
+	cacheTags []string
+
+	trailers http.Header
+	tenant   *Tenant
+	form     url.Values
+	locale   Locale
+}
+
+type exchangeKey struct{}
+
+func withExchange(ctx context.Context, ex *exchange) context.Context {
+	return context.WithValue(ctx, exchangeKey{}, ex)
+}
+
+// exchangeOf returns the exchange of the request, which middleware may have replaced,
+// and a context holding it.
+func exchangeOf(r *http.Request) (context.Context, *exchange) {
+	ctx := r.Context()
+	ex, ok := exchangeFrom(ctx)
+	if !ok {
+		ex = &exchange{start: time.Now()}
+		ctx = withExchange(ctx, ex)
+	}
+	ex.request = r
+	return ctx, ex
+}
+
+func exchangeFrom(ctx context.Context) (*exchange, bool) {
+	ex, ok := ctx.Value(exchangeKey{}).(*exchange)
+	return ex, ok
+}
+
+// RouteFromContext returns the info of the route handling the request, so middleware,
+// closers and encoders can label logs and metrics with the route instead of the raw URL.
+func RouteFromContext(ctx context.Context) (RouteInfo, bool) {
+	ex, ok := exchangeFrom(ctx)
+	if !ok || ex.route == nil {
+		return RouteInfo{}, false
+	}
+	return *ex.route, true
+}
+
+// PatternFromContext returns the pattern of the route handling the request, e.g. /users/{ID}.
+func PatternFromContext(ctx context.Context) (string, bool) {
+	info, ok := RouteFromContext(ctx)
+	return info.Pattern, ok
+}
+
+// StartFromContext returns the time the route started handling the request.
+func StartFromContext(ctx context.Context) (time.Time, bool) {
+	ex, ok := exchangeFrom(ctx)
+	if !ok || ex.route == nil {
+		return time.Time{}, false
+	}
+	return ex.start, true
+}
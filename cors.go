@@ -0,0 +1,96 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy configures the cross-origin requests browsers may make to routes, see CORS.
+type CORSPolicy struct {
+	// AllowedOrigins are the origins like https://app.example.com that may call the routes, "*" allows any.
+	AllowedOrigins []string
+	// AllowedHeaders are the request headers beyond the CORS-safelisted ones that requests may carry.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers beyond the CORS-safelisted ones that scripts may read.
+	ExposedHeaders []string
+	// AllowCredentials lets requests carry cookies and authorization, it excludes the origin "*".
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the answer to a preflight request.
+	MaxAge time.Duration
+}
+
+// CORS returns an Option that lets browsers call the routes registered after it from the allowed origins.
+// Their responses to allowed origins carry the Access-Control headers of the policy and preflight OPTIONS
+// requests are answered for them as long as AutomaticOptions is enabled. Responses to other origins
+// go without, so browsers keep scripts from reading them.
+func CORS(policy CORSPolicy) Option {
+	return func(r *router) error {
+		if len(policy.AllowedOrigins) == 0 {
+			return errors.New("CORS needs allowed origins")
+		}
+		if policy.AllowCredentials && slices.Contains(policy.AllowedOrigins, "*") {
+			return errors.New("CORS can't allow credentials for any origin")
+		}
+		r.cors = &policy
+		return nil
+	}
+}
+
+func (p *CORSPolicy) wrap(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.allowOrigin(w.Header(), r.Header.Get("Origin")) && len(p.ExposedHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// allowOrigin sets the Access-Control-Allow headers for the origin and reports whether it is allowed.
+func (p *CORSPolicy) allowOrigin(header http.Header, origin string) bool {
+	anyOrigin := slices.Contains(p.AllowedOrigins, "*")
+	if !anyOrigin {
+		// the response depends on the origin, caches must not serve it to others
+		header.Add("Vary", "Origin")
+	}
+	if origin == "" || !anyOrigin && !slices.Contains(p.AllowedOrigins, origin) {
+		return false
+	}
+	if anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// preflight answers the preflight request for the policies of the methods allowed at its path.
+func preflight(header http.Header, r *http.Request, policies map[string]*CORSPolicy) {
+	method := r.Header.Get("Access-Control-Request-Method")
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	policy := policies[method]
+	if policy == nil || !policy.allowOrigin(header, r.Header.Get("Origin")) {
+		return
+	}
+	var methods []string
+	for _, m := range []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		if policies[m] == policy {
+			methods = append(methods, m)
+		}
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(policy.AllowedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+	}
+	if policy.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+	}
+}
@@ -0,0 +1,102 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dedupe returns an Option that answers duplicate requests to the routes registered after it with the
+// response of the original one for window after it completed, without invoking the handler twice,
+// e.g. for mobile apps retrying requests whose response got lost. Requests are duplicates if they are
+// sent by the same principal, e.g. the user of a verified token, to the same path and query and key
+// returns the same value for them, e.g. a client generated request id header. Requests for which
+// principal or key return the empty string are not deduplicated, so responses never leak to other clients.
+// Concurrent duplicates wait for the original. Responses with 5xx status codes are not kept.
+func Dedupe(window time.Duration, principal, key func(*http.Request) string) Option {
+	return func(r *router) error {
+		if principal == nil || key == nil {
+			return errors.New("Dedupe requires a principal and a key func")
+		}
+		r.dedupe = &deduper{window: window, principal: principal, key: key, calls: map[string]*dedupedCall{}}
+		return nil
+	}
+}
+
+type deduper struct {
+	window    time.Duration
+	principal func(*http.Request) string
+	key       func(*http.Request) string
+	mu        sync.Mutex
+	calls     map[string]*dedupedCall
+	pruned    time.Time
+}
+
+type dedupedCall struct {
+	done     chan struct{}
+	response CachedResponse
+	expires  time.Time
+}
+
+// expired reports whether the call completed longer than the window ago.
+func (c *dedupedCall) expired(now time.Time) bool {
+	return !c.expires.IsZero() && now.After(c.expires)
+}
+
+func (d *deduper) wrap(info RouteInfo, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, key := d.principal(r), d.key(r)
+		if principal == "" || key == "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		key = strings.Join([]string{
+			info.Method, strconv.Quote(principal), strconv.Quote(r.URL.EscapedPath()),
+			strconv.Quote(r.URL.RawQuery), strconv.Quote(key),
+		}, " ")
+
+		now := time.Now()
+		d.mu.Lock()
+		if now.Sub(d.pruned) > d.window {
+			for k, call := range d.calls {
+				if call.expired(now) {
+					delete(d.calls, k)
+				}
+			}
+			d.pruned = now
+		}
+		if call, ok := d.calls[key]; ok && !call.expired(now) {
+			d.mu.Unlock()
+			select {
+			case <-call.done:
+				w.Header().Set("X-Deduplicated", "true")
+				call.response.writeTo(w)
+			case <-r.Context().Done():
+			}
+			return
+		}
+		call := &dedupedCall{done: make(chan struct{})}
+		d.calls[key] = call
+		d.mu.Unlock()
+
+		rec := newResponseRecorder()
+		call.response = CachedResponse{Status: http.StatusInternalServerError}
+		defer func() {
+			d.mu.Lock()
+			if call.response.Status >= http.StatusInternalServerError {
+				delete(d.calls, key)
+			} else {
+				call.expires = time.Now().Add(d.window)
+			}
+			d.mu.Unlock()
+			close(call.done)
+		}()
+
+		handler.ServeHTTP(rec, r)
+		call.response = rec.response()
+		call.response.writeTo(w)
+	})
+}
@@ -0,0 +1,36 @@
+package route
+
+import (
+	"net/http"
+	"time"
+)
+
+// Deprecated returns an Option that marks the routes registered after it as deprecated.
+// Use it within a Group to deprecate single routes.
+// The routes emit Deprecation, Sunset and Link headers and are flagged in RouteInfo.
+// A zero sunset or an empty link omits the respective header.
+func Deprecated(sunset time.Time, link string) Option {
+	return func(r *router) error {
+		r.deprecation = &deprecation{sunset: sunset, link: link}
+		return nil
+	}
+}
+
+type deprecation struct {
+	sunset time.Time
+	link   string
+}
+
+func (d *deprecation) wrap(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("Deprecation", "true")
+		if !d.sunset.IsZero() {
+			header.Set("Sunset", d.sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.link != "" {
+			header.Add("Link", "<"+d.link+`>; rel="deprecation"`)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
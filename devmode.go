@@ -0,0 +1,113 @@
+package route
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// routeError annotates an error with the state of the route it occurred in.
+type routeError struct {
+	method  string
+	pattern string
+	field   string
+	input   any
+	stack   []byte
+	accept  string
+	err     error
+}
+
+func (e *routeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *routeError) Unwrap() error {
+	return e.err
+}
+
+// DevMode returns an Option that renders detailed error pages showing the failing field option,
+// the route pattern, the stack trace and the bound input values.
+// The page is JSON if the client accepts it and HTML otherwise.
+// Never use it in production, it exposes internals to every client.
+func DevMode() Option {
+	return HandleError(func(ctx context.Context, w http.ResponseWriter, err error) {
+		if ResponseCommitted(w) {
+			return
+		}
+		page := devErrorPage{
+			Status: StatusCode(err),
+			Error:  err.Error(),
+		}
+		accept := ""
+		var routeErr *routeError
+		if errors.As(err, &routeErr) {
+			page.Method = routeErr.method
+			page.Pattern = routeErr.pattern
+			page.Field = routeErr.field
+			page.Input = devInput(routeErr.input)
+			page.Stack = string(routeErr.stack)
+			accept = routeErr.accept
+		}
+
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if strings.Contains(accept, "application/json") {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(page.Status)
+			_ = json.NewEncoder(w).Encode(page)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(page.Status)
+		_ = devErrorTemplate.Execute(w, page)
+	})
+}
+
+// EchoInput returns an Option that lets requests carrying the given header, e.g. X-Echo-Input,
+// receive the bound Input of the routes registered after it as JSON instead of calling the handler.
+// It helps diagnosing why a field ends up zero valued.
+// Like DevMode it exposes internals to every client, never use it in production.
+func EchoInput(header string) Option {
+	return func(r *router) error {
+		r.echoInput = http.CanonicalHeaderKey(header)
+		return nil
+	}
+}
+
+type devErrorPage struct {
+	Status  int    `json:"status"`
+	Error   string `json:"error"`
+	Method  string `json:"method,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Input   string `json:"input,omitempty"`
+	Stack   string `json:"stack,omitempty"`
+}
+
+func devInput(input any) string {
+	if input == nil {
+		return ""
+	}
+	b, err := json.MarshalIndent(input, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%+v", input)
+	}
+	return string(b)
+}
+
+var devErrorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.Error}}</title></head>
+<body>
+<h1>{{.Status}}</h1>
+<p>{{.Error}}</p>
+{{if .Pattern}}<h2>Route</h2><pre>{{.Method}} {{.Pattern}}</pre>{{end}}
+{{if .Field}}<h2>Failing field</h2><pre>{{.Field}}</pre>{{end}}
+{{if .Input}}<h2>Input</h2><pre>{{.Input}}</pre>{{end}}
+{{if .Stack}}<h2>Stack</h2><pre>{{.Stack}}</pre>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,171 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Router is an http.Handler whose routes can be added and removed after construction,
+// e.g. by plugin systems or admin-managed endpoints.
+// Every change builds a new route tree that replaces the served one atomically,
+// so requests in flight finish on the tree they started with.
+type Router struct {
+	mu          sync.Mutex
+	steps       []Option
+	operational map[string][]Option
+	state       wrapperState
+	current     atomic.Pointer[router]
+}
+
+// NewRouter returns a Router serving the routes registered by the given options.
+func NewRouter(opts ...Option) (*Router, error) {
+	r := &Router{}
+	if err := r.Add(opts...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.current.Load().ServeHTTP(w, req)
+}
+
+// Add applies further options to the router, e.g. to register new routes.
+// The options see all settings of the options applied before.
+func (r *Router) Add(opts ...Option) error {
+	return r.update(Join(opts...))
+}
+
+// Remove unregisters the route with the given pattern as reported by RouteInfo.String,
+// e.g. "GET /users/{ID}".
+func (r *Router) Remove(pattern string) error {
+	return r.update(removeRoute(pattern))
+}
+
+// Routes returns the currently registered routes.
+func (r *Router) Routes() []RouteInfo {
+	return r.current.Load().routes
+}
+
+func (r *Router) update(step Option) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	steps := append(slices.Clip(r.steps), step)
+	r.state.build()
+	router, err := newRouter(withOperational(r.operational), withState(&r.state), Join(replayed(r.steps)...), step)
+	if err != nil {
+		return err
+	}
+	r.steps = steps
+	r.current.Store(router)
+	r.state.prune()
+	return nil
+}
+
+// Reconfigure replaces the options of the Reconfigurable of each name in opts, e.g. to tune limits,
+// timeouts or maintenance mode without a restart. The others keep their options. It fails without changes
+// if a name is not used by a Reconfigurable or opts would add or remove routes.
+// Requests in flight finish with the old settings. Stateful behavior like MaxConcurrent, CircuitBreaker,
+// LoadShed or RateLimit keeps its state unless its settings change, which also holds for Add and Remove.
+func (r *Router) Reconfigure(opts map[string][]Option) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	operational := maps.Clone(r.operational)
+	if operational == nil {
+		operational = map[string][]Option{}
+	}
+	maps.Copy(operational, opts)
+	r.state.build()
+	router, err := newRouter(withOperational(operational), withState(&r.state), Join(replayed(r.steps)...))
+	if err != nil {
+		return err
+	}
+	for name := range opts {
+		if !router.reconfigurable[name] {
+			return fmt.Errorf("no Reconfigurable named %q", name)
+		}
+	}
+	current := r.current.Load()
+	if !slices.EqualFunc(current.routes, router.routes, func(a, b RouteInfo) bool {
+		return a.String() == b.String() && a.Variant == b.Variant && a.Handler == b.Handler
+	}) {
+		return errors.New("reconfiguring must not change the routes")
+	}
+	r.operational = operational
+	r.current.Store(router)
+	r.state.prune()
+	return nil
+}
+
+func withOperational(operational map[string][]Option) Option {
+	return func(r *router) error {
+		r.operational = operational
+		return nil
+	}
+}
+
+// replayed returns the steps marked as applied before, so they don't repeat one-off work like Warmup.
+func replayed(steps []Option) []Option {
+	marked := make([]Option, len(steps))
+	for i, step := range steps {
+		marked[i] = func(r *router) error {
+			r.replaying = true
+			defer func() {
+				r.replaying = false
+			}()
+			return step(r)
+		}
+	}
+	return marked
+}
+
+// Reconfigurable returns an Option that applies opts to the routes registered after it like Join
+// until Router.Reconfigure replaces them under name. It marks the operational settings that may change
+// at runtime, e.g. Reconfigurable("defaults", ...) and Reconfigurable("reports", ...) within a Group.
+// Reconfigurables sharing a name are reconfigured together.
+func Reconfigurable(name string, opts ...Option) Option {
+	return func(r *router) error {
+		if r.reconfigurable == nil {
+			r.reconfigurable = map[string]bool{}
+		}
+		r.reconfigurable[name] = true
+		if operational, ok := r.operational[name]; ok {
+			return Join(operational...)(r)
+		}
+		return Join(opts...)(r)
+	}
+}
+
+func removeRoute(pattern string) Option {
+	return func(r *router) error {
+		i := slices.IndexFunc(r.routes, func(info RouteInfo) bool {
+			return info.String() == pattern
+		})
+		if i < 0 {
+			return fmt.Errorf("route %s is not registered", pattern)
+		}
+		info := r.routes[i]
+		tree := r.tree(info.Method)
+		if tree == nil {
+			return fmt.Errorf("route %s is not registered", pattern)
+		}
+		node, ok := tree.nodeOf(info.Pattern)
+		if !ok {
+			return fmt.Errorf("route %s is not registered", pattern)
+		}
+		node.handler = nil
+		if strings.HasSuffix(info.Pattern, "...}") {
+			node.allowRemainder = false
+		}
+		r.routes = slices.Delete(slices.Clone(r.routes), i, i+1)
+		return nil
+	}
+}
@@ -0,0 +1,49 @@
+package route
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Enumer is implemented by types with a fixed set of values. Generated schemas list them as enum.
+// Struct fields can list their values with an enum tag instead, e.g. `enum:"open,closed"`.
+type Enumer interface {
+	EnumValues() []string
+}
+
+// Enum returns a FieldOption that rejects values not in allowed with 400 listing the valid values.
+// Add it after the FieldOption binding the value, e.g. ByType(PathID(parseStatus), Enum(Open, Closed)).
+func Enum[T ~string](allowed ...T) FieldOption[*T] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*T], error) {
+		return func(r *request, v *T) (func(error) error, error) {
+			if slices.Contains(allowed, *v) {
+				return nil, nil
+			}
+			valid := make([]string, len(allowed))
+			for i, value := range allowed {
+				valid[i] = string(value)
+			}
+			return nil, WithStatus(http.StatusBadRequest, Messagef("%s %q is not one of %s", name, string(*v), strings.Join(valid, ", ")))
+		}, nil
+	}
+}
+
+var enumerType = reflect.TypeFor[Enumer]()
+
+// enumValues returns the values of the type if it implements Enumer.
+func enumValues(t reflect.Type) []any {
+	if !t.Implements(enumerType) {
+		return nil
+	}
+	return enumOf(reflect.Zero(t).Interface().(Enumer).EnumValues())
+}
+
+func enumOf(values []string) []any {
+	enum := make([]any, len(values))
+	for i, value := range values {
+		enum[i] = value
+	}
+	return enum
+}
@@ -0,0 +1,41 @@
+package route
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Environment returns an Option that sets the environment the router runs in, e.g. "production" or "staging",
+// which decides the Env groups registered. Set it once before the first Env, typically from a flag or variable.
+func Environment(name string) Option {
+	return func(r *router) error {
+		if r.environment != "" && r.environment != name {
+			return fmt.Errorf("environment already set to %q", r.environment)
+		}
+		r.environment = name
+		return nil
+	}
+}
+
+// Env returns an Option that applies opts like Group, but only if the router runs in one of the environments
+// separated by commas, e.g. Env("dev, staging", Get(debugHandler)). Otherwise their routes are not registered.
+// Spaces around the environments are ignored, empty ones are rejected.
+func Env(environments string, opts ...Option) Option {
+	return func(r *router) error {
+		if r.environment == "" {
+			return fmt.Errorf("Env(%q) requires an Environment set before it", environments)
+		}
+		matches := false
+		for _, environment := range strings.Split(environments, ",") {
+			environment = strings.TrimSpace(environment)
+			if environment == "" {
+				return fmt.Errorf("Env(%q) has an empty environment", environments)
+			}
+			matches = matches || environment == r.environment
+		}
+		if !matches {
+			return nil
+		}
+		return Group(opts...)(r)
+	}
+}
@@ -0,0 +1,75 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// ErrNoContent is returned by handlers to answer with 204 No Content instead of an encoded output.
+// Closers see it like any other error.
+var ErrNoContent = errors.New("no content")
+
+// StatusError is an error that carries the HTTP status code reported to the client.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// WithStatus wraps err so it is reported to the client with the given HTTP status code.
+func WithStatus(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StatusError{Code: code, Err: err}
+}
+
+// StatusCode returns the HTTP status code carried by err or 500 if it carries none.
+// Errors from reading beyond a MaxBodySize carry 413, ErrPreconditionFailed carries 412 and FormErrors 422.
+func StatusCode(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	if errors.Is(err, ErrPreconditionFailed) {
+		return http.StatusPreconditionFailed
+	}
+	var formErrs FormErrors
+	if errors.As(err, &formErrs) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// PanicError is the error of a recovered panic with the stack it was raised at.
+// It unwraps to the panic value if that is an error, so errors.Is and errors.As classify it like a returned one.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func newPanicError(value any) *PanicError {
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
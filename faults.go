@@ -0,0 +1,82 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// Faults configures the faults FaultInjection injects. Rates are the fractions of requests between 0 and 1
+// that get the fault. Delayed requests may fail or be dropped as well.
+type Faults struct {
+	DelayRate float64
+	Delay     time.Duration
+	// ErrorRate of the requests fail with ErrorStatus, 503 Service Unavailable if zero.
+	ErrorRate   float64
+	ErrorStatus int
+	// DropRate of the requests have their connection closed without response.
+	DropRate float64
+}
+
+// FaultInjection returns an Option that injects faults into a fraction of the requests to the routes registered
+// after it while enabled reports true, e.g. to exercise the retry logic of clients in staging. Let enabled check
+// an environment variable or a feature flag so it can never fire in production by accident.
+// Pass nil within a Group to spare routes like health checks.
+func FaultInjection(enabled func(context.Context) bool, faults *Faults) Option {
+	return func(r *router) error {
+		if faults == nil {
+			r.faults = nil
+			return nil
+		}
+		if enabled == nil {
+			return errors.New("FaultInjection requires an enabled func")
+		}
+		for name, rate := range map[string]float64{"delay": faults.DelayRate, "error": faults.ErrorRate, "drop": faults.DropRate} {
+			if rate < 0 || rate > 1 {
+				return fmt.Errorf("fault injection %s rate %v is not between 0 and 1", name, rate)
+			}
+		}
+		if faults.ErrorRate+faults.DropRate > 1 {
+			return errors.New("fault injection error and drop rates add up to more than 1")
+		}
+		r.faults = &faultInjection{enabled: enabled, faults: *faults}
+		return nil
+	}
+}
+
+type faultInjection struct {
+	enabled func(context.Context) bool
+	faults  Faults
+}
+
+func (f *faultInjection) wrap(cfg *config, info RouteInfo, handler http.Handler) http.Handler {
+	status := f.faults.ErrorStatus
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !f.enabled(r.Context()) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if rand.Float64() < f.faults.DelayRate {
+			select {
+			case <-time.After(f.faults.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		switch p := rand.Float64(); {
+		case p < f.faults.DropRate:
+			// the server closes the connection without response
+			panic(http.ErrAbortHandler)
+		case p < f.faults.DropRate+f.faults.ErrorRate:
+			cfg.HandleErr(r.Context(), w, WithStatus(status, Messagef("injected fault for %s", info)))
+		default:
+			handler.ServeHTTP(w, r)
+		}
+	})
+}
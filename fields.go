@@ -1,12 +1,15 @@
 package route
 
 import (
-	"fmt"
 	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
+	"unicode"
 
 	"slices"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 // FieldOption configures the behavior to input field.
@@ -71,16 +74,79 @@ func IntPathIDs() FieldOption[*int] {
 	})
 }
 
+// Slug is a URL slug like hello-world, distinguished from free-form strings.
+type Slug string
+
+// SlugPathIDs returns an FieldOption that enables the route to route slugs.
+// Call it with ByType(SlugPathIDs()). Slugs are lowercased and may consist of
+// letters, digits and single hyphens between them; other slugs are rejected with 400.
+// Slugs are normalized to NFC first, so decomposed letters with diacritics match their precomposed form.
+func SlugPathIDs() FieldOption[*Slug] {
+	return PathID(func(id string, v *Slug) error {
+		slug, err := parseSlug(id)
+		if err != nil {
+			return WithStatus(http.StatusBadRequest, err)
+		}
+		*v = slug
+		return nil
+	})
+}
+
+func parseSlug(s string) (Slug, error) {
+	// clients may send decomposed accents, e.g. from macOS file names
+	s = norm.NFC.String(strings.ToLower(s))
+	if s == "" || strings.HasPrefix(s, "-") || strings.HasSuffix(s, "-") || strings.Contains(s, "--") {
+		return "", Messagef("invalid slug %q", s)
+	}
+	for _, r := range s {
+		if r != '-' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return "", Messagef("invalid slug %q: %q is not allowed", s, r)
+		}
+	}
+	return Slug(s), nil
+}
+
 // PathID returns an FieldOption that adds an id to the path.
 func PathID[T any](f func(id string, v T) error) FieldOption[T] {
 	return func(route *route, name string, field reflect.Type) (fieldModifier[T], error) {
-		route.addVarToPath()
+		route.addVarToPath(name)
 		return func(r *request, v T) (func(error) error, error) {
 			return nil, f(r.popPath(), v)
 		}, nil
 	}
 }
 
+// CompositePathID returns an FieldOption that binds a key spanning several path segments
+// into one field, assembled from the segments, e.g. a date from /2024/05/17.
+// Segments numbered path variables are added; a negative number binds all remaining segments,
+// e.g. an object key below its bucket, and must be the last path field of the route.
+func CompositePathID[T any](segments int, assemble func(segments []string, v T) error) FieldOption[T] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[T], error) {
+		if segments < 0 {
+			route.allowRemainder = true
+			route.segments = append(route.segments, "{"+name+"...}")
+			return func(r *request, v T) (func(error) error, error) {
+				if len(r.pathTail) == 0 {
+					return nil, WithStatus(http.StatusNotFound, Messagef("missing %s", name))
+				}
+				tail := r.pathTail
+				r.pathTail = nil
+				return nil, assemble(tail, v)
+			}, nil
+		}
+		for i := range segments {
+			route.addVarToPath(name + strconv.Itoa(i+1))
+		}
+		return func(r *request, v T) (func(error) error, error) {
+			parts := make([]string, segments)
+			for i := range parts {
+				parts[i] = r.popPath()
+			}
+			return nil, assemble(parts, v)
+		}, nil
+	}
+}
+
 // RequestValue returns a FieldOption to modify the field based on the request.
 func RequestValue[T any](f func(r *http.Request, v T) error) FieldOption[T] {
 	return func(route *route, name string, field reflect.Type) (fieldModifier[T], error) {
@@ -123,6 +189,29 @@ func ByType[T any](opts ...FieldOption[*T]) Option {
 	}
 }
 
+// OverrideByName returns an Option that replaces the field options of fields with the name for all routes
+// registered after it, wherever the options were registered, e.g. to inject a test double.
+// Fields with the name need a field option registered still. Overrides by name beat overrides by type.
+func OverrideByName(name string, opts ...FieldOption[any]) Option {
+	return func(r *router) error {
+		r.addOverride(nameOptionKey(name), func(route *route, name string, field reflect.Type) (fieldModifier[any], error) {
+			return combinedFieldModifier(opts, route, name, field)
+		})
+		return nil
+	}
+}
+
+// OverrideByType returns an Option that replaces the field options of fields of the type for all routes
+// registered after it like OverrideByName.
+func OverrideByType[T any](opts ...FieldOption[*T]) Option {
+	return func(r *router) error {
+		r.addOverride(typeOptionKey(typeOf[T]()), func(route *route, name string, field reflect.Type) (fieldModifier[any], error) {
+			return combinedFieldModifier(opts, route, name, field)
+		})
+		return nil
+	}
+}
+
 func combinedFieldModifier[T any](opts []FieldOption[T], route *route, name string, field reflect.Type) (fieldModifier[any], error) {
 	mods := make([]fieldModifier[T], 0, len(opts))
 	for _, opt := range opts {
@@ -140,7 +229,7 @@ func combinedFieldModifier[T any](opts []FieldOption[T], route *route, name stri
 		closers := make([]func(error) error, 0, len(mods))
 		defer func() {
 			if r := recover(); r != nil {
-				err = fmt.Errorf("panic: %v", r)
+				err = newPanicError(r)
 			}
 
 			for _, closer := range slices.Backward(closers) {
@@ -0,0 +1,111 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// Fixture is a recorded call of a route handler with its input and output, e.g. stored as JSON file
+// for consumer contract tests. Error and Status are set instead of Output if the handler failed,
+// Status is 204 No Content without Error if it answered with ErrNoContent.
+type Fixture struct {
+	Route  string          `json:"route"`
+	Input  json.RawMessage `json:"input"`
+	Output json.RawMessage `json:"output,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Status int             `json:"status,omitempty"`
+}
+
+// RecordFixtures returns an Option that calls record with a Fixture after each handler call of the routes
+// registered after it. Route is the method and pattern like RouteInfo.String. Inputs are marshaled as JSON,
+// so tag input fields that hold dependencies instead of request values with json:"-". Calls whose input or
+// output does not marshal are not recorded.
+func RecordFixtures(record func(context.Context, Fixture)) Option {
+	return func(r *router) error {
+		r.interceptors = append(r.interceptors, interceptor{
+			input:  reflect.TypeFor[any](),
+			output: reflect.TypeFor[any](),
+			intercept: func(ctx context.Context, in any, next func(context.Context, any) (any, error)) (any, error) {
+				out, err := next(ctx, in)
+				info, ok := RouteFromContext(ctx)
+				if !ok || IsWarmup(ctx) {
+					return out, err
+				}
+				fixture := Fixture{Route: info.String()}
+				var marshalErr error
+				if fixture.Input, marshalErr = json.Marshal(in); marshalErr != nil {
+					return out, err
+				}
+				switch {
+				case errors.Is(err, ErrNoContent):
+					fixture.Status = http.StatusNoContent
+				case err != nil:
+					fixture.Error, fixture.Status = err.Error(), StatusCode(err)
+				default:
+					if fixture.Output, marshalErr = json.Marshal(out); marshalErr != nil {
+						return out, err
+					}
+				}
+				record(ctx, fixture)
+				return out, err
+			},
+		})
+		return nil
+	}
+}
+
+// ReplayFixtures returns an Option that answers the routes registered after it from fixtures instead of
+// calling their handlers, so the options of a service with recorded fixtures serve as stub server.
+// A call is answered by the last fixture of its route whose input marshals to the same JSON.
+// Calls without fixture fail with 501 Not Implemented.
+func ReplayFixtures(fixtures []Fixture) Option {
+	return func(r *router) error {
+		r.interceptors = append(r.interceptors, interceptor{
+			input:  reflect.TypeFor[any](),
+			output: reflect.TypeFor[any](),
+			intercept: func(ctx context.Context, in any, next func(context.Context, any) (any, error)) (any, error) {
+				info, ok := RouteFromContext(ctx)
+				if !ok {
+					return next(ctx, in)
+				}
+				input, err := json.Marshal(in)
+				if err != nil {
+					return nil, fmt.Errorf("marshaling input for replay: %w", err)
+				}
+				for i := len(fixtures) - 1; i >= 0; i-- {
+					fixture := fixtures[i]
+					if fixture.Route != info.String() || !equalJSON(fixture.Input, input) {
+						continue
+					}
+					if fixture.Status == http.StatusNoContent {
+						return nil, ErrNoContent
+					}
+					if fixture.Status != 0 {
+						return nil, WithStatus(fixture.Status, errors.New(fixture.Error))
+					}
+					out := reflect.New(info.OutputType)
+					if err := json.Unmarshal(fixture.Output, out.Interface()); err != nil {
+						return nil, fmt.Errorf("unmarshaling fixture output of %s: %w", info, err)
+					}
+					return out.Elem().Interface(), nil
+				}
+				return nil, WithStatus(http.StatusNotImplemented, Messagef("no fixture for %s with input %s", info, input))
+			},
+		})
+		return nil
+	}
+}
+
+// equalJSON reports whether a and b are the same JSON regardless of formatting.
+func equalJSON(a, b []byte) bool {
+	var compactA, compactB bytes.Buffer
+	if json.Compact(&compactA, a) != nil || json.Compact(&compactB, b) != nil {
+		return false
+	}
+	return bytes.Equal(compactA.Bytes(), compactB.Bytes())
+}
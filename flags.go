@@ -0,0 +1,49 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// FeatureFlags returns an Option that sets the provider FeatureFlag asks whether a flag is enabled.
+// The provider gets the request context, so it can roll out by tenant or user.
+func FeatureFlags(enabled func(ctx context.Context, flag string) bool) Option {
+	return func(r *router) error {
+		r.flagProvider = enabled
+		return nil
+	}
+}
+
+// FeatureFlag returns an Option that only serves the routes registered after it while the flag is enabled.
+// Use it within a Group. Requests to disabled routes get 403 if forbidden is set and 404 otherwise.
+// The flag is reported in RouteInfo.
+func FeatureFlag(name string, forbidden bool) Option {
+	return func(r *router) error {
+		if r.flagProvider == nil {
+			return errors.New("FeatureFlag requires the FeatureFlags option")
+		}
+		r.featureFlag = &featureFlag{name: name, forbidden: forbidden, enabled: r.flagProvider}
+		return nil
+	}
+}
+
+type featureFlag struct {
+	name      string
+	forbidden bool
+	enabled   func(ctx context.Context, flag string) bool
+}
+
+func (f *featureFlag) wrap(cfg *config, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.enabled(r.Context(), f.name) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if f.forbidden {
+			cfg.HandleErr(r.Context(), w, WithStatus(http.StatusForbidden, Messagef("forbidden")))
+			return
+		}
+		cfg.HandleErr(r.Context(), w, WithStatus(http.StatusNotFound, Messagef("not found")))
+	})
+}
@@ -0,0 +1,198 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ettle/strcase"
+)
+
+// FormErrors maps form field names to the messages of the values that failed to bind or validate.
+// It is reported with 422 Unprocessable Entity, handlers may return it too, e.g. for a taken user name.
+// LocalizeErrors translates the messages with them as keys.
+type FormErrors map[string]string
+
+func (e FormErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, name := range slices.Sorted(maps.Keys(e)) {
+		messages = append(messages, name+": "+e[name])
+	}
+	return "invalid form: " + strings.Join(messages, ", ")
+}
+
+// FormValidator is implemented by form structs validating their values after they were bound by FormBody.
+type FormValidator interface {
+	ValidateForm() FormErrors
+}
+
+// FormBody returns a FieldOption that binds the submitted form values into a struct field.
+// Fields are named by their form tag or in kebab case and may be strings, bools, numbers or slices of them.
+// Values that do not parse and the errors of FormValidator fail the request with FormErrors.
+func FormBody() FieldOption[any] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[any], error) {
+		if field.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("FormBody requires a struct, got %s", field)
+		}
+		fields := make([]string, field.NumField())
+		for i := range fields {
+			f := field.Field(i)
+			fields[i] = f.Tag.Get("form")
+			if !f.IsExported() || fields[i] == "-" {
+				fields[i] = ""
+				continue
+			}
+			if fields[i] == "" {
+				fields[i] = strcase.ToKebab(f.Name)
+			}
+			t := f.Type
+			if t.Kind() == reflect.Slice {
+				t = t.Elem()
+			}
+			if _, err := parseFormValue(t, ""); err != nil {
+				return nil, fmt.Errorf("form field %s: %w %s", f.Name, err, f.Type)
+			}
+		}
+		return func(r *request, v any) (func(error) error, error) {
+			if err := r.ParseMultipartForm(32 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+				return nil, WithStatus(http.StatusBadRequest, err)
+			}
+			if ex, ok := exchangeFrom(r.Context()); ok {
+				ex.form = r.PostForm
+			}
+			value := reflect.ValueOf(v).Elem()
+			errs := FormErrors{}
+			for i, name := range fields {
+				if name == "" {
+					continue
+				}
+				parsed, err := parseFormValues(field.Field(i).Type, r.PostForm[name])
+				if err != nil {
+					errs[name] = err.Error()
+					continue
+				}
+				value.Field(i).Set(parsed)
+			}
+			if validator, ok := v.(FormValidator); ok && len(errs) == 0 {
+				errs = validator.ValidateForm()
+			}
+			if len(errs) > 0 {
+				return nil, errs
+			}
+			return nil, nil
+		}, nil
+	}
+}
+
+var errUnsupportedFormType = errors.New("unsupported type")
+
+// parseFormValues parses the values of a form field into its type.
+func parseFormValues(t reflect.Type, values []string) (reflect.Value, error) {
+	if t.Kind() == reflect.Slice {
+		s := reflect.MakeSlice(t, len(values), len(values))
+		for i, value := range values {
+			parsed, err := parseFormValue(t.Elem(), value)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			s.Index(i).Set(parsed)
+		}
+		return s, nil
+	}
+	value := ""
+	if len(values) > 0 {
+		value = values[0]
+	}
+	return parseFormValue(t, value)
+}
+
+func parseFormValue(t reflect.Type, value string) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	var err error
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		// unchecked checkboxes are not submitted, checked ones submit on unless they have a value
+		v.SetBool(value != "" && value != "false" && value != "off")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value == "" {
+			break
+		}
+		var n int64
+		if n, err = strconv.ParseInt(value, 10, t.Bits()); err == nil {
+			v.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value == "" {
+			break
+		}
+		var n uint64
+		if n, err = strconv.ParseUint(value, 10, t.Bits()); err == nil {
+			v.SetUint(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		if value == "" {
+			break
+		}
+		var f float64
+		if f, err = strconv.ParseFloat(value, t.Bits()); err == nil {
+			v.SetFloat(f)
+		}
+	default:
+		return reflect.Value{}, errUnsupportedFormType
+	}
+	if err != nil {
+		return reflect.Value{}, errors.New("is not a valid number")
+	}
+	return v, nil
+}
+
+// FormState is rendered by FormPage to show a form again with the submitted values and the errors.
+type FormState struct {
+	Page   string
+	Values url.Values
+	Errors FormErrors
+}
+
+func (s FormState) Template() string {
+	return s.Page
+}
+
+// FormPage returns an Option that answers FormErrors of the routes registered after it by rendering
+// the page again, e.g. with HTMLResponse, with FormState holding the submitted values and the field errors.
+// The response has status 422. Other errors are handled as before. It uses the response encoder set before it.
+func FormPage(page string) Option {
+	return func(r *router) error {
+		encoder := r.responseEncoder
+		if encoder == nil {
+			return errors.New("FormPage requires a response encoder")
+		}
+		cfg := r.config
+		r.handleErr = func(ctx context.Context, w http.ResponseWriter, err error) {
+			var formErrs FormErrors
+			ex, ok := exchangeFrom(ctx)
+			if !errors.As(err, &formErrs) || !ok || ResponseCommitted(w) {
+				cfg.HandleErr(ctx, w, err)
+				return
+			}
+			state := FormState{Page: page, Values: ex.form, Errors: formErrs}
+			sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusUnprocessableEntity}
+			if err := encoder(ctx, sw, state); err != nil {
+				cfg.HandleErr(ctx, w, err)
+				return
+			}
+			if !sw.wroteHeader {
+				sw.WriteHeader(sw.status)
+			}
+		}
+		return nil
+	}
+}
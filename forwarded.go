@@ -0,0 +1,180 @@
+package route
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"strings"
+)
+
+// RequireTLS returns an Option that only lets requests arriving over TLS through to the routes registered after it.
+// Plaintext requests are redirected to https with 308 if redirect is set and rejected with 403 otherwise.
+// X-Forwarded-Proto is honored for requests from TrustedProxies.
+func RequireTLS(redirect bool) Option {
+	return func(r *router) error {
+		r.requireTLS = &requireTLS{redirect: redirect}
+		return nil
+	}
+}
+
+type requireTLS struct {
+	redirect bool
+}
+
+func (t *requireTLS) wrap(cfg *config, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.scheme(r) == "https" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if t.redirect {
+			http.Redirect(w, r, "https://"+cfg.host(r)+r.URL.RequestURI(), http.StatusPermanentRedirect)
+			return
+		}
+		cfg.HandleErr(r.Context(), w, WithStatus(http.StatusForbidden, Messagef("TLS required")))
+	})
+}
+
+// TrustedProxies returns an Option that sets the proxies whose forwarding headers are trusted
+// by the routes registered after it, given as CIDR prefixes or single addresses.
+// It governs ClientIP, ForwardedRequest, RequireTLS and everything else that detects the
+// client address, scheme or host. Without the option only loopback addresses are trusted.
+func TrustedProxies(cidrs ...string) Option {
+	return func(r *router) error {
+		prefixes := make([]netip.Prefix, 0, len(cidrs))
+		for _, cidr := range cidrs {
+			if !strings.Contains(cidr, "/") {
+				addr, err := netip.ParseAddr(cidr)
+				if err != nil {
+					return fmt.Errorf("trusted proxy %q: %w", cidr, err)
+				}
+				prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+				continue
+			}
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return fmt.Errorf("trusted proxy %q: %w", cidr, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+		}
+		r.trustedProxies = prefixes
+		return nil
+	}
+}
+
+// ClientIP returns a FieldOption that binds the address of the client.
+// Addresses in X-Forwarded-For are only taken from TrustedProxies, skipping trusted proxies from the right.
+func ClientIP() FieldOption[*netip.Addr] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*netip.Addr], error) {
+		cfg := route.config
+		return func(r *request, v *netip.Addr) (func(error) error, error) {
+			*v = cfg.clientIP(r.Request)
+			return nil, nil
+		}, nil
+	}
+}
+
+// Forwarded describes where a request came from, taking forwarding headers of TrustedProxies into account.
+type Forwarded struct {
+	ClientIP netip.Addr
+	Scheme   string
+	Host     string
+}
+
+// ForwardedRequest returns a FieldOption that binds Forwarded.
+func ForwardedRequest() FieldOption[*Forwarded] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*Forwarded], error) {
+		cfg := route.config
+		return func(r *request, v *Forwarded) (func(error) error, error) {
+			*v = Forwarded{
+				ClientIP: cfg.clientIP(r.Request),
+				Scheme:   cfg.scheme(r.Request),
+				Host:     cfg.host(r.Request),
+			}
+			return nil, nil
+		}, nil
+	}
+}
+
+var loopback = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("::1/128"),
+}
+
+// fromTrustedProxy reports whether the request was sent by a proxy whose forwarding headers are trusted.
+func (c *config) fromTrustedProxy(r *http.Request) bool {
+	return c.trusted(remoteAddr(r))
+}
+
+func (c *config) trusted(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	trusted := c.trustedProxies
+	if trusted == nil {
+		trusted = loopback
+	}
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// scheme returns the scheme the client used for the request.
+func (c *config) scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if c.fromTrustedProxy(r) {
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			return strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0]))
+		}
+	}
+	return "http"
+}
+
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, _ := netip.ParseAddr(host)
+	return addr.Unmap()
+}
+
+// clientIP returns the address of the client.
+func (c *config) clientIP(r *http.Request) netip.Addr {
+	addr := remoteAddr(r)
+	if !c.trusted(addr) {
+		return addr
+	}
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			return addr
+		}
+		addr = hop.Unmap()
+		if !c.trusted(addr) {
+			return addr
+		}
+	}
+	return addr
+}
+
+// host returns the host the client addressed.
+func (c *config) host(r *http.Request) string {
+	if c.fromTrustedProxy(r) {
+		if host := r.Header.Get("X-Forwarded-Host"); host != "" {
+			return strings.TrimSpace(strings.Split(host, ",")[0])
+		}
+	}
+	return r.Host
+}
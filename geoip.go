@@ -0,0 +1,53 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"reflect"
+)
+
+// Location is the geographic location of a client address bound by GeoIP.
+// Country is an ISO 3166-1 alpha-2 code like DE and Region the ISO 3166-2 subdivision code like BY.
+// It is zero for addresses the resolver does not know, e.g. private ones.
+type Location struct {
+	Country string
+	Region  string
+	City    string
+}
+
+// GeoResolver resolves the location of client addresses, e.g. backed by a MaxMind GeoIP2 or GeoLite2 database.
+type GeoResolver interface {
+	Resolve(ctx context.Context, addr netip.Addr) (Location, bool, error)
+}
+
+// GeoResolverFunc is a function implementing GeoResolver.
+type GeoResolverFunc func(ctx context.Context, addr netip.Addr) (Location, bool, error)
+
+func (f GeoResolverFunc) Resolve(ctx context.Context, addr netip.Addr) (Location, bool, error) {
+	return f(ctx, addr)
+}
+
+// GeoIP returns a FieldOption that binds the Location of the client address resolved with resolver,
+// e.g. for localization or routing requests of some countries differently. Call it with ByType(GeoIP(resolver)).
+// The client address is detected like ClientIP, so forwarding headers are only honored from TrustedProxies.
+func GeoIP(resolver GeoResolver) FieldOption[*Location] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*Location], error) {
+		cfg := route.config
+		return func(r *request, v *Location) (func(error) error, error) {
+			*v = Location{}
+			addr := cfg.clientIP(r.Request)
+			if !addr.IsValid() {
+				return nil, nil
+			}
+			location, ok, err := resolver.Resolve(r.Context(), addr.Unmap())
+			if err != nil {
+				return nil, fmt.Errorf("resolving location of %s: %w", addr, err)
+			}
+			if ok {
+				*v = location
+			}
+			return nil, nil
+		}, nil
+	}
+}
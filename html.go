@@ -0,0 +1,158 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// HTMLConfig configures the templates of HTMLResponse. Patterns are fs.Glob patterns within its file system.
+// Values are escaped by html/template according to the context they are rendered in, e.g. attributes,
+// URLs or scripts. Only values of the types of html/template like template.HTML are rendered as is.
+type HTMLConfig struct {
+	// Pages matches the page templates, e.g. "pages/*.html". A page is named by its file name
+	// without extension, e.g. user for pages/user.html.
+	Pages string
+	// Layout is the file of the template wrapping every page, e.g. "layout.html", empty for none.
+	// It renders the page with {{template "content" .}} which pages define with {{define "content"}}.
+	Layout string
+	// Partials matches the templates shared by all pages, e.g. "partials/*.html".
+	// Pages render them by file name like {{template "nav.html" .}}.
+	Partials string
+	// Funcs are the functions available to all templates.
+	Funcs template.FuncMap
+	// Delims are the action delimiters, {{ and }} if empty.
+	Delims [2]string
+}
+
+// Templated is implemented by outputs choosing the page HTMLResponse renders them with.
+type Templated interface {
+	Template() string
+}
+
+// HTMLResponse returns an Option that renders outputs as HTML with the page of the same name as
+// the output type, case insensitive, e.g. pages/user.html for User, or the page named by Templated outputs.
+// Pages are rendered completely before anything is written, so template errors result in clean error responses.
+// With a layout htmx requests get the content of the page only unless they are boosted, see HTMXRequest.Fragment.
+func HTMLResponse(fsys fs.FS, config HTMLConfig) Option {
+	return func(r *router) error {
+		pages, err := parseHTML(fsys, config)
+		if err != nil {
+			return fmt.Errorf("HTMLResponse: %w", err)
+		}
+		r.responseEncoder = pages.encode
+		return nil
+	}
+}
+
+type htmlPages struct {
+	pages  map[string]*template.Template
+	layout string
+}
+
+func parseHTML(fsys fs.FS, config HTMLConfig) (*htmlPages, error) {
+	base := template.New("").Funcs(config.Funcs).Delims(config.Delims[0], config.Delims[1])
+	var shared []string
+	if config.Partials != "" {
+		partials, err := fs.Glob(fsys, config.Partials)
+		if err != nil {
+			return nil, err
+		}
+		shared = append(shared, partials...)
+	}
+	pages := &htmlPages{pages: map[string]*template.Template{}}
+	if config.Layout != "" {
+		shared = append(shared, config.Layout)
+		pages.layout = path.Base(config.Layout)
+	}
+	if len(shared) > 0 {
+		if _, err := base.ParseFS(fsys, shared...); err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := fs.Glob(fsys, config.Pages)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no pages match %s", config.Pages)
+	}
+	for _, file := range files {
+		page, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := page.ParseFS(fsys, file); err != nil {
+			return nil, err
+		}
+		name := path.Base(file)
+		if pages.layout == "" {
+			page = page.Lookup(name)
+		} else if page.Lookup("content") == nil {
+			return nil, fmt.Errorf("page %s does not define content for layout %s", file, config.Layout)
+		}
+		pages.pages[strings.ToLower(strings.TrimSuffix(name, path.Ext(name)))] = page
+	}
+	return pages, nil
+}
+
+func (p *htmlPages) page(v any) (string, *template.Template, error) {
+	var name string
+	if templated, ok := v.(Templated); ok {
+		name = templated.Template()
+	} else if v != nil {
+		t := reflect.TypeOf(v)
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		name = t.Name()
+		if i := strings.IndexByte(name, '['); i >= 0 {
+			name = name[:i]
+		}
+	}
+	name = strings.ToLower(name)
+	page, ok := p.pages[name]
+	if !ok {
+		return "", nil, fmt.Errorf("no page for output %T", v)
+	}
+	return name, page, nil
+}
+
+func (p *htmlPages) encode(ctx context.Context, w http.ResponseWriter, v any) error {
+	name, page, err := p.page(v)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	switch {
+	case p.layout == "":
+		err = page.Execute(&buf, v)
+	case p.fragment(ctx, w.Header()):
+		err = page.ExecuteTemplate(&buf, "content", v)
+	default:
+		err = page.ExecuteTemplate(&buf, p.layout, v)
+	}
+	if err != nil {
+		return fmt.Errorf("rendering page %s: %w", name, err)
+	}
+	setContentType(w.Header(), "text/html; charset=utf-8")
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// fragment reports whether the page is rendered without layout for an htmx request swapping it into a page.
+func (p *htmlPages) fragment(ctx context.Context, header http.Header) bool {
+	ex, ok := exchangeFrom(ctx)
+	if !ok {
+		return false
+	}
+	header.Add("Vary", "HX-Request")
+	return htmxRequest(ex.request).Fragment()
+}
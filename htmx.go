@@ -0,0 +1,117 @@
+package route
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// HTMXRequest describes a request sent by htmx, bound by HTMX. Request is false for other requests.
+type HTMXRequest struct {
+	Request bool
+	// Boosted is set for requests of hx-boost links and forms.
+	Boosted bool
+	// HistoryRestore is set when htmx restores a page missing from its history cache.
+	HistoryRestore bool
+	// Target, Trigger and TriggerName are the ids of the target and triggering elements and the name of the latter.
+	Target      string
+	Trigger     string
+	TriggerName string
+	// CurrentURL is the URL of the page the request was sent from.
+	CurrentURL string
+	// Prompt is the user response to hx-prompt.
+	Prompt string
+}
+
+// Fragment reports whether htmx swaps the response into a page, so it needs a fragment instead of a full page.
+func (h HTMXRequest) Fragment() bool {
+	return h.Request && !h.Boosted && !h.HistoryRestore
+}
+
+// HTMX returns a FieldOption that binds the htmx request headers. Call it with ByType(HTMX()).
+func HTMX() FieldOption[*HTMXRequest] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*HTMXRequest], error) {
+		return func(r *request, v *HTMXRequest) (func(error) error, error) {
+			*v = htmxRequest(r.Request)
+			return nil, nil
+		}, nil
+	}
+}
+
+func htmxRequest(r *http.Request) HTMXRequest {
+	return HTMXRequest{
+		Request:        r.Header.Get("HX-Request") == "true",
+		Boosted:        r.Header.Get("HX-Boosted") == "true",
+		HistoryRestore: r.Header.Get("HX-History-Restore-Request") == "true",
+		Target:         r.Header.Get("HX-Target"),
+		Trigger:        r.Header.Get("HX-Trigger"),
+		TriggerName:    r.Header.Get("HX-Trigger-Name"),
+		CurrentURL:     r.Header.Get("HX-Current-URL"),
+		Prompt:         r.Header.Get("HX-Prompt"),
+	}
+}
+
+// HTMXHeaders sets the htmx response headers of its non zero fields. Embed it in outputs to control
+// htmx declaratively, e.g. to trigger client side events or to redirect after a form was saved.
+type HTMXHeaders struct {
+	// Redirect and Location navigate to the URL, the latter without a full page reload.
+	Redirect string `json:"-" yaml:"-"`
+	Location string `json:"-" yaml:"-"`
+	// PushURL and ReplaceURL update the browser location and history.
+	PushURL    string `json:"-" yaml:"-"`
+	ReplaceURL string `json:"-" yaml:"-"`
+	Refresh    bool   `json:"-" yaml:"-"`
+	// Retarget and Reswap override the target and swap strategy of the triggering element.
+	Retarget string `json:"-" yaml:"-"`
+	Reswap   string `json:"-" yaml:"-"`
+	// Trigger, TriggerAfterSettle and TriggerAfterSwap trigger client side events by name, with details
+	// if the values are not nil.
+	Trigger            map[string]any `json:"-" yaml:"-"`
+	TriggerAfterSettle map[string]any `json:"-" yaml:"-"`
+	TriggerAfterSwap   map[string]any `json:"-" yaml:"-"`
+}
+
+func (h HTMXHeaders) SetHeader(header http.Header) {
+	for key, value := range map[string]string{
+		"HX-Redirect":    h.Redirect,
+		"HX-Location":    h.Location,
+		"HX-Push-Url":    h.PushURL,
+		"HX-Replace-Url": h.ReplaceURL,
+		"HX-Retarget":    h.Retarget,
+		"HX-Reswap":      h.Reswap,
+	} {
+		if value != "" {
+			header.Set(key, value)
+		}
+	}
+	if h.Refresh {
+		header.Set("HX-Refresh", "true")
+	}
+	for key, events := range map[string]map[string]any{
+		"HX-Trigger":              h.Trigger,
+		"HX-Trigger-After-Settle": h.TriggerAfterSettle,
+		"HX-Trigger-After-Swap":   h.TriggerAfterSwap,
+	} {
+		if value := htmxEvents(events); value != "" {
+			header.Set(key, value)
+		}
+	}
+}
+
+// htmxEvents encodes the events as comma separated names or as JSON object if any has details.
+func htmxEvents(events map[string]any) string {
+	names := slices.Sorted(maps.Keys(events))
+	for _, name := range names {
+		if events[name] != nil {
+			encoded, err := json.Marshal(events)
+			if err != nil {
+				return ""
+			}
+			return string(encoded)
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,167 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Message is an error whose text a MessageCatalog can translate. Key is the fmt format of the
+// English text and also the key of its translations, Args are formatted into the translation.
+// The built-in errors clients see, like not found or invalid query parameters, are Messages.
+type Message struct {
+	Key  string
+	Args []any
+}
+
+// Messagef returns a Message error, e.g. Messagef("order %s is closed", id).
+func Messagef(key string, args ...any) error {
+	return &Message{Key: key, Args: args}
+}
+
+func (m *Message) Error() string {
+	return fmt.Sprintf(m.Key, m.Args...)
+}
+
+// MessageCatalog translates Message keys into a locale. Translations are fmt formats taking the
+// Message arguments in the same order.
+type MessageCatalog interface {
+	Translate(locale, key string) (string, bool)
+}
+
+// Catalog is a MessageCatalog holding the translations by locale and key.
+type Catalog map[string]map[string]string
+
+func (c Catalog) Translate(locale, key string) (string, bool) {
+	translation, ok := c[locale][key]
+	return translation, ok
+}
+
+// Locale is a language tag like de or pt-BR negotiated by AcceptLanguage.
+type Locale string
+
+// AcceptLanguage returns a FieldOption that binds the supported locale the Accept-Language header
+// prefers, the first supported one if it prefers none. A tag like de-AT matches de.
+// LocalizeErrors translates the errors of the request into the bound locale.
+func AcceptLanguage(supported ...string) FieldOption[*Locale] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*Locale], error) {
+		if len(supported) == 0 {
+			return nil, errors.New("AcceptLanguage requires a supported locale")
+		}
+		return func(r *request, v *Locale) (func(error) error, error) {
+			*v = Locale(negotiateLocale(r.Header.Get("Accept-Language"), supported))
+			if ex, ok := exchangeFrom(r.Context()); ok {
+				ex.locale = *v
+			}
+			return nil, nil
+		}, nil
+	}
+}
+
+// negotiateLocale returns the supported locale of the highest quality in the Accept-Language header.
+func negotiateLocale(header string, supported []string) string {
+	best, quality := supported[0], 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= quality {
+			continue
+		}
+		for _, locale := range supported {
+			if strings.EqualFold(tag, locale) || len(tag) > len(locale) && strings.EqualFold(tag[:len(locale)+1], locale+"-") {
+				best, quality = locale, q
+				break
+			}
+		}
+	}
+	return best
+}
+
+// LocalizeErrors returns an Option that translates the Messages and FormErrors of the errors of the routes
+// registered after it with catalog before the error handler set before it handles them. The locale is the
+// one bound by AcceptLanguage or else negotiated from the supported locales, the first being the default.
+// Messages without translation are left as they are. The responses get a Content-Language header.
+func LocalizeErrors(catalog MessageCatalog, supported ...string) Option {
+	return func(r *router) error {
+		if len(supported) == 0 {
+			return errors.New("LocalizeErrors requires a supported locale")
+		}
+		cfg := r.config
+		r.handleErr = func(ctx context.Context, w http.ResponseWriter, err error) {
+			var locale string
+			if ex, ok := exchangeFrom(ctx); ok {
+				locale = string(ex.locale)
+				if locale == "" {
+					locale = negotiateLocale(ex.request.Header.Get("Accept-Language"), supported)
+				}
+			}
+			if locale != "" {
+				w.Header().Set("Content-Language", locale)
+				err = localize(catalog, locale, err)
+			}
+			cfg.HandleErr(ctx, w, err)
+		}
+		return nil
+	}
+}
+
+func localize(catalog MessageCatalog, locale string, err error) error {
+	var formErrs FormErrors
+	if errors.As(err, &formErrs) {
+		translated := make(FormErrors, len(formErrs))
+		for name, message := range formErrs {
+			translated[name] = message
+			if translation, ok := catalog.Translate(locale, message); ok {
+				translated[name] = translation
+			}
+		}
+		return &localizedFormErrors{translated: translated, err: err}
+	}
+	var message *Message
+	if errors.As(err, &message) {
+		if translation, ok := catalog.Translate(locale, message.Key); ok {
+			return &localizedError{message: fmt.Sprintf(translation, message.Args...), err: err}
+		}
+	}
+	return err
+}
+
+// localizedError is an error with its translated message, it unwraps to the original error.
+type localizedError struct {
+	message string
+	err     error
+}
+
+func (e *localizedError) Error() string {
+	return e.message
+}
+
+func (e *localizedError) Unwrap() error {
+	return e.err
+}
+
+// localizedFormErrors is an error with translated FormErrors. It unwraps to the translated FormErrors first,
+// so errors.As finds them instead of the original ones, and then to the original error with its status.
+type localizedFormErrors struct {
+	translated FormErrors
+	err        error
+}
+
+func (e *localizedFormErrors) Error() string {
+	return e.translated.Error()
+}
+
+func (e *localizedFormErrors) Unwrap() []error {
+	return []error{e.translated, e.err}
+}
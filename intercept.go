@@ -0,0 +1,65 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Intercept returns an Option that wraps the handlers of the routes registered after it whose
+// Input and Output are assignable to the interceptor's, so cross-cutting logic like tenant
+// scoping or response filtering can see and modify the decoded Input and Output.
+// Use any to intercept all routes. The first interceptor registered is the outermost.
+func Intercept[Input, Output any](intercept func(ctx context.Context, in Input, next func(context.Context, Input) (Output, error)) (Output, error)) Option {
+	return func(r *router) error {
+		r.interceptors = append(r.interceptors, interceptor{
+			input:  reflect.TypeFor[Input](),
+			output: reflect.TypeFor[Output](),
+			intercept: func(ctx context.Context, in any, next func(context.Context, any) (any, error)) (any, error) {
+				return intercept(ctx, in.(Input), func(ctx context.Context, in Input) (Output, error) {
+					return typedOutput[Output](next(ctx, in))
+				})
+			},
+		})
+		return nil
+	}
+}
+
+type interceptor struct {
+	input, output reflect.Type
+	intercept     func(ctx context.Context, in any, next func(context.Context, any) (any, error)) (any, error)
+}
+
+// intercepted returns the handler wrapped by the interceptors of the config matching its types.
+func intercepted[Input, Output any](cfg *config, handler func(context.Context, Input) (Output, error)) func(context.Context, Input) (Output, error) {
+	input, output := reflect.TypeFor[Input](), reflect.TypeFor[Output]()
+	call := func(ctx context.Context, in any) (any, error) {
+		return handler(ctx, in.(Input))
+	}
+	matched := false
+	for i := len(cfg.interceptors) - 1; i >= 0; i-- {
+		interceptor := cfg.interceptors[i]
+		if !input.AssignableTo(interceptor.input) || !output.AssignableTo(interceptor.output) {
+			continue
+		}
+		matched = true
+		next := call
+		call = func(ctx context.Context, in any) (any, error) {
+			return interceptor.intercept(ctx, in, next)
+		}
+	}
+	if !matched {
+		return handler
+	}
+	return func(ctx context.Context, in Input) (Output, error) {
+		return typedOutput[Output](call(ctx, in))
+	}
+}
+
+func typedOutput[Output any](res any, err error) (Output, error) {
+	out, ok := res.(Output)
+	if !ok && res != nil {
+		return out, fmt.Errorf("interceptor returned %T instead of %s", res, reflect.TypeFor[Output]())
+	}
+	return out, err
+}
@@ -0,0 +1,118 @@
+package route
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// RouteInfo describes a registered route.
+// Providers are the field options binding the input, like "name Body" or "type *sql.Tx".
+type RouteInfo struct {
+	Method      string        `json:"method"`
+	Pattern     string        `json:"pattern"`
+	Handler     string        `json:"handler"`
+	Input       string        `json:"input,omitempty"`
+	Output      string        `json:"output,omitempty"`
+	Middleware  []string      `json:"middleware,omitempty"`
+	Deprecated  bool          `json:"deprecated,omitempty"`
+	Sunset      *time.Time    `json:"sunset,omitempty"`
+	FeatureFlag string        `json:"feature_flag,omitempty"`
+	Variant     string        `json:"variant,omitempty"`
+	Priority    PriorityClass `json:"priority,omitempty"`
+	Providers   []string      `json:"providers,omitempty"`
+
+	InputType  reflect.Type `json:"-"`
+	OutputType reflect.Type `json:"-"`
+}
+
+func (i RouteInfo) String() string {
+	return i.Method + " " + i.Pattern
+}
+
+// Routes returns the routes registered by the given options in registration order.
+// Marshal the result as JSON or pass it to PrintRoutes to debug which routes actually got registered.
+func Routes(opts ...Option) ([]RouteInfo, error) {
+	router, err := newRouter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return router.routes, nil
+}
+
+// PrintRoutes writes the routes as a human-readable table.
+func PrintRoutes(w io.Writer, routes []RouteInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATTERN\tHANDLER\tINPUT\tOUTPUT\tMIDDLEWARE\tDEPRECATED\tFLAG")
+	for _, route := range routes {
+		deprecated := ""
+		if route.Deprecated {
+			deprecated = "yes"
+			if route.Sunset != nil {
+				deprecated = "sunset " + route.Sunset.Format(time.DateOnly)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			route.Method, route.Pattern, route.Handler, route.Input, route.Output,
+			strings.Join(route.Middleware, ", "), deprecated, route.FeatureFlag)
+	}
+	return tw.Flush()
+}
+
+// Dependencies returns the routes depending on each provider and middleware, e.g. to see which routes
+// a change of a shared dependency affects. Providers are keyed like RouteInfo.Providers, middleware like
+// "middleware" followed by its function name.
+func Dependencies(routes []RouteInfo) map[string][]string {
+	dependencies := map[string][]string{}
+	for _, route := range routes {
+		for _, provider := range route.Providers {
+			dependencies[provider] = append(dependencies[provider], route.String())
+		}
+		for _, middleware := range route.Middleware {
+			key := "middleware " + middleware
+			if !slices.Contains(dependencies[key], route.String()) {
+				dependencies[key] = append(dependencies[key], route.String())
+			}
+		}
+	}
+	return dependencies
+}
+
+// PrintDependencyGraph writes the dependencies of the routes as Graphviz DOT graph with edges
+// from the routes to the providers and middleware they depend on.
+func PrintDependencyGraph(w io.Writer, routes []RouteInfo) error {
+	dependencies := Dependencies(routes)
+	var b strings.Builder
+	b.WriteString("digraph routes {\n\trankdir=LR;\n")
+	for _, dependency := range slices.Sorted(maps.Keys(dependencies)) {
+		fmt.Fprintf(&b, "\t%q [shape=box];\n", dependency)
+		for _, route := range dependencies[dependency] {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", route, dependency)
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (r *router) middlewareNames() []string {
+	names := make([]string, len(r.middleware))
+	for i, middleware := range r.middleware {
+		names[i] = funcName(middleware)
+	}
+	return names
+}
+
+func funcName(f any) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return fmt.Sprintf("%T", f)
+	}
+	return fn.Name()
+}
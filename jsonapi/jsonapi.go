@@ -0,0 +1,443 @@
+// Package jsonapi implements the JSON:API media type (https://jsonapi.org) for routes.
+// Use Encode with route.ResponseEncoder, Decode with route.Body and HandleError with route.HandleError.
+//
+// Resources are structs whose fields are tagged with
+//
+//	jsonapi:"primary,<type>"   the resource id and type
+//	jsonapi:"attr,<name>"      an attribute
+//	jsonapi:"relation,<name>"  a relationship to a resource or a slice of resources
+//
+// Related resources are encoded as resource identifiers and added to the included resources.
+package jsonapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/generikvault/route"
+)
+
+// MediaType is the JSON:API media type.
+const MediaType = "application/vnd.api+json"
+
+// Document is a JSON:API top level document.
+type Document struct {
+	Data     any           `json:"data,omitempty"`
+	Included []Resource    `json:"included,omitempty"`
+	Errors   []ErrorObject `json:"errors,omitempty"`
+}
+
+// MarshalJSON writes data as null if it is nil, only error documents go without data.
+func (d Document) MarshalJSON() ([]byte, error) {
+	type document Document
+	if len(d.Errors) > 0 {
+		return json.Marshal(document(d))
+	}
+	return json.Marshal(struct {
+		Data any `json:"data"`
+		document
+	}{d.Data, document(d)})
+}
+
+// Resource is a JSON:API resource object.
+type Resource struct {
+	Type          string                  `json:"type"`
+	ID            string                  `json:"id,omitempty"`
+	Attributes    map[string]any          `json:"attributes,omitempty"`
+	Relationships map[string]Relationship `json:"relationships,omitempty"`
+}
+
+// Relationship is a JSON:API relationship object.
+// Data is an Identifier, a slice of Identifiers or nil.
+type Relationship struct {
+	Data any `json:"data"`
+}
+
+// Identifier is a JSON:API resource identifier object.
+type Identifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// ErrorObject is a JSON:API error object.
+type ErrorObject struct {
+	Status string `json:"status,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Encode writes v as JSON:API document. v is a resource, a pointer to one or a slice of them.
+func Encode(ctx context.Context, w http.ResponseWriter, v any) error {
+	doc, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", MediaType)
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// Marshal returns the JSON:API document of v. v is a resource, a pointer to one or a slice of them.
+func Marshal(v any) (*Document, error) {
+	value, ok := deref(reflect.ValueOf(v))
+	if !ok || !value.IsValid() {
+		return &Document{}, nil
+	}
+
+	inc := &included{seen: map[Identifier]bool{}}
+	if value.Kind() == reflect.Slice {
+		data := make([]Resource, value.Len())
+		for i := range data {
+			resource, err := inc.resource(value.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			data[i] = resource
+		}
+		return &Document{Data: data, Included: inc.without(data...)}, nil
+	}
+
+	resource, err := inc.resource(value)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{Data: resource, Included: inc.without(resource)}, nil
+}
+
+type included struct {
+	seen      map[Identifier]bool
+	resources []Resource
+}
+
+// without returns the included resources except the primary ones.
+func (inc *included) without(primary ...Resource) []Resource {
+	var resources []Resource
+	for _, resource := range inc.resources {
+		if !slices.ContainsFunc(primary, func(p Resource) bool {
+			return p.Type == resource.Type && p.ID == resource.ID
+		}) {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+func (inc *included) resource(value reflect.Value) (Resource, error) {
+	value, ok := deref(value)
+	if !ok {
+		return Resource{}, errors.New("jsonapi: nil resource")
+	}
+	rt, err := typeOf(value.Type())
+	if err != nil {
+		return Resource{}, err
+	}
+	resource := Resource{Type: rt.name}
+	for _, field := range rt.fields {
+		fieldValue := value.Field(field.index)
+		switch field.kind {
+		case primaryField:
+			resource.ID = formatID(fieldValue)
+		case attrField:
+			if resource.Attributes == nil {
+				resource.Attributes = map[string]any{}
+			}
+			resource.Attributes[field.name] = fieldValue.Interface()
+		case relationField:
+			relationship, err := inc.relationship(fieldValue)
+			if err != nil {
+				return Resource{}, fmt.Errorf("relationship %s: %w", field.name, err)
+			}
+			if resource.Relationships == nil {
+				resource.Relationships = map[string]Relationship{}
+			}
+			resource.Relationships[field.name] = relationship
+		}
+	}
+	return resource, nil
+}
+
+func (inc *included) relationship(value reflect.Value) (Relationship, error) {
+	if value.Kind() == reflect.Slice {
+		ids := make([]Identifier, 0, value.Len())
+		for i := range value.Len() {
+			elem, ok := deref(value.Index(i))
+			if !ok {
+				continue
+			}
+			id, err := inc.include(elem)
+			if err != nil {
+				return Relationship{}, err
+			}
+			ids = append(ids, id)
+		}
+		return Relationship{Data: ids}, nil
+	}
+	value, ok := deref(value)
+	if !ok {
+		return Relationship{}, nil
+	}
+	id, err := inc.include(value)
+	if err != nil {
+		return Relationship{}, err
+	}
+	return Relationship{Data: id}, nil
+}
+
+// deref returns the value pointers point to, it reports false for nil pointers.
+func deref(value reflect.Value) (reflect.Value, bool) {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return value, false
+		}
+		value = value.Elem()
+	}
+	return value, true
+}
+
+func (inc *included) include(value reflect.Value) (Identifier, error) {
+	rt, err := typeOf(value.Type())
+	if err != nil {
+		return Identifier{}, err
+	}
+	id := Identifier{Type: rt.name, ID: formatID(value.Field(rt.id))}
+	if inc.seen[id] {
+		return id, nil
+	}
+	inc.seen[id] = true
+	resource, err := inc.resource(value)
+	if err != nil {
+		return Identifier{}, err
+	}
+	inc.resources = append(inc.resources, resource)
+	return id, nil
+}
+
+// Decode reads a JSON:API document with a single resource into v, which must be a pointer to a resource.
+// Relationships are set to resources holding only their id.
+func Decode(r io.Reader, v any) error {
+	var doc struct {
+		Data *rawResource `json:"data"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return err
+	}
+	if doc.Data == nil {
+		return errors.New("jsonapi: document has no data")
+	}
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return fmt.Errorf("jsonapi: expected pointer to resource, got %T", v)
+	}
+	return doc.Data.decode(value.Elem())
+}
+
+type rawResource struct {
+	Type          string                     `json:"type"`
+	ID            string                     `json:"id"`
+	Attributes    map[string]json.RawMessage `json:"attributes"`
+	Relationships map[string]struct {
+		Data json.RawMessage `json:"data"`
+	} `json:"relationships"`
+}
+
+func (raw *rawResource) decode(value reflect.Value) error {
+	rt, err := typeOf(value.Type())
+	if err != nil {
+		return err
+	}
+	if raw.Type != rt.name {
+		return fmt.Errorf("jsonapi: expected resource type %s, got %s", rt.name, raw.Type)
+	}
+	for _, field := range rt.fields {
+		fieldValue := value.Field(field.index)
+		switch field.kind {
+		case primaryField:
+			if raw.ID == "" {
+				continue
+			}
+			if err := parseID(fieldValue, raw.ID); err != nil {
+				return fmt.Errorf("jsonapi: id: %w", err)
+			}
+		case attrField:
+			attr, ok := raw.Attributes[field.name]
+			if !ok {
+				continue
+			}
+			if err := json.Unmarshal(attr, fieldValue.Addr().Interface()); err != nil {
+				return fmt.Errorf("jsonapi: attribute %s: %w", field.name, err)
+			}
+		case relationField:
+			relationship, ok := raw.Relationships[field.name]
+			if !ok {
+				continue
+			}
+			if err := decodeRelationship(fieldValue, relationship.Data); err != nil {
+				return fmt.Errorf("jsonapi: relationship %s: %w", field.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func decodeRelationship(value reflect.Value, data json.RawMessage) error {
+	if value.Kind() == reflect.Slice {
+		var ids []Identifier
+		if err := json.Unmarshal(data, &ids); err != nil {
+			return err
+		}
+		slice := reflect.MakeSlice(value.Type(), len(ids), len(ids))
+		for i, id := range ids {
+			if err := setIdentifier(slice.Index(i), id); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+		return nil
+	}
+	var id *Identifier
+	if err := json.Unmarshal(data, &id); err != nil {
+		return err
+	}
+	if id == nil {
+		value.SetZero()
+		return nil
+	}
+	return setIdentifier(value, *id)
+}
+
+func setIdentifier(value reflect.Value, id Identifier) error {
+	if value.Kind() == reflect.Pointer {
+		value.Set(reflect.New(value.Type().Elem()))
+		value = value.Elem()
+	}
+	rt, err := typeOf(value.Type())
+	if err != nil {
+		return err
+	}
+	if id.Type != rt.name {
+		return fmt.Errorf("expected resource type %s, got %s", rt.name, id.Type)
+	}
+	return parseID(value.Field(rt.id), id.ID)
+}
+
+// HandleError writes err as JSON:API error document with the status of route.StatusCode.
+// Responses that are already committed are left alone.
+func HandleError(ctx context.Context, w http.ResponseWriter, err error) {
+	if route.ResponseCommitted(w) {
+		return
+	}
+	status := route.StatusCode(err)
+	var detail string
+	if status < http.StatusInternalServerError {
+		// server errors may reveal internals
+		detail = err.Error()
+	}
+	w.Header().Set("Content-Type", MediaType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(Document{Errors: []ErrorObject{{
+		Status: strconv.Itoa(status),
+		Title:  http.StatusText(status),
+		Detail: detail,
+	}}})
+}
+
+type fieldKind int
+
+const (
+	primaryField fieldKind = iota
+	attrField
+	relationField
+)
+
+type resourceField struct {
+	index int
+	kind  fieldKind
+	name  string
+}
+
+type resourceType struct {
+	name   string
+	id     int
+	fields []resourceField
+}
+
+var resourceTypes sync.Map
+
+func typeOf(t reflect.Type) (*resourceType, error) {
+	if rt, ok := resourceTypes.Load(t); ok {
+		return rt.(*resourceType), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("jsonapi: expected resource struct, got %s", t)
+	}
+	rt := &resourceType{id: -1}
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("jsonapi")
+		if !ok {
+			continue
+		}
+		kind, name, _ := strings.Cut(tag, ",")
+		field := resourceField{index: i, name: name}
+		switch kind {
+		case "primary":
+			field.kind = primaryField
+			rt.name = name
+			rt.id = i
+		case "attr":
+			field.kind = attrField
+		case "relation":
+			field.kind = relationField
+		default:
+			return nil, fmt.Errorf("jsonapi: unknown tag %q on %s.%s", tag, t, t.Field(i).Name)
+		}
+		rt.fields = append(rt.fields, field)
+	}
+	if rt.id < 0 {
+		return nil, fmt.Errorf("jsonapi: %s has no primary field", t)
+	}
+	resourceTypes.Store(t, rt)
+	return rt, nil
+}
+
+func formatID(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10)
+	default:
+		return fmt.Sprint(value.Interface())
+	}
+}
+
+func parseID(value reflect.Value, id string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(id)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(id, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(id, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(i)
+	default:
+		return fmt.Errorf("unsupported id type %s", value.Type())
+	}
+	return nil
+}
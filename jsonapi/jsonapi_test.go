@@ -0,0 +1,115 @@
+package jsonapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/generikvault/route"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type person struct {
+	ID   int    `jsonapi:"primary,people"`
+	Name string `jsonapi:"attr,name"`
+}
+
+type article struct {
+	ID     string  `jsonapi:"primary,articles"`
+	Title  string  `jsonapi:"attr,title"`
+	Author *person `jsonapi:"relation,author"`
+}
+
+func TestEncode(t *testing.T) {
+	w := httptest.NewRecorder()
+	require.NoError(t, Encode(context.Background(), w, []article{
+		{ID: "1", Title: "Hello", Author: &person{ID: 9, Name: "Ada"}},
+		{ID: "2", Title: "World", Author: &person{ID: 9, Name: "Ada"}},
+	}))
+
+	assert.Equal(t, MediaType, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"data": [
+			{"type": "articles", "id": "1", "attributes": {"title": "Hello"}, "relationships": {"author": {"data": {"type": "people", "id": "9"}}}},
+			{"type": "articles", "id": "2", "attributes": {"title": "World"}, "relationships": {"author": {"data": {"type": "people", "id": "9"}}}}
+		],
+		"included": [
+			{"type": "people", "id": "9", "attributes": {"name": "Ada"}}
+		]
+	}`, w.Body.String())
+}
+
+func TestEncodeNil(t *testing.T) {
+	type book struct {
+		ID      string    `jsonapi:"primary,books"`
+		Authors []*person `jsonapi:"relation,authors"`
+		Editor  **person  `jsonapi:"relation,editor"`
+	}
+	w := httptest.NewRecorder()
+	require.NoError(t, Encode(context.Background(), w, (*article)(nil)))
+	assert.JSONEq(t, `{"data": null}`, w.Body.String())
+
+	var editor *person
+	w = httptest.NewRecorder()
+	require.NoError(t, Encode(context.Background(), w, book{ID: "1", Authors: []*person{nil, {ID: 9, Name: "Ada"}}, Editor: &editor}))
+	assert.JSONEq(t, `{
+		"data": {"type": "books", "id": "1", "relationships": {
+			"authors": {"data": [{"type": "people", "id": "9"}]},
+			"editor": {"data": null}
+		}},
+		"included": [
+			{"type": "people", "id": "9", "attributes": {"name": "Ada"}}
+		]
+	}`, w.Body.String())
+
+	assert.EqualError(t, Encode(context.Background(), httptest.NewRecorder(), []*article{nil}), "jsonapi: nil resource")
+}
+
+func TestHandleError(t *testing.T) {
+	w := httptest.NewRecorder()
+	HandleError(context.Background(), w, route.WithStatus(http.StatusNotFound, errors.New("article 7 not found")))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"errors": [{"status": "404", "title": "Not Found", "detail": "article 7 not found"}]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	HandleError(context.Background(), w, errors.New("connecting to db at 10.0.0.7"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"errors": [{"status": "500", "title": "Internal Server Error"}]}`, w.Body.String())
+}
+
+func TestDecode(t *testing.T) {
+	var a article
+	require.NoError(t, Decode(strings.NewReader(`{"data": {
+		"type": "articles",
+		"id": "1",
+		"attributes": {"title": "Hello"},
+		"relationships": {"author": {"data": {"type": "people", "id": "9"}}}
+	}}`), &a))
+
+	assert.Equal(t, article{ID: "1", Title: "Hello", Author: &person{ID: 9}}, a)
+	assert.Error(t, Decode(strings.NewReader(`{"data": {"type": "people", "id": "9"}}`), &a))
+}
+
+func TestResponseCommitted(t *testing.T) {
+	handler, err := route.New(
+		route.ResponseEncoder(func(ctx context.Context, w http.ResponseWriter, v any) error {
+			_, _ = w.Write([]byte(`{"data":[`))
+			return errors.New("encoding failed")
+		}),
+		route.HandleError(HandleError),
+		route.PathByNameOfFixedTyped(strings.ToLower),
+		route.Get(func(ctx context.Context, in struct{ Articles route.Fixed }) ([]article, error) {
+			return nil, nil
+		}),
+	)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/articles", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"data":[`, w.Body.String())
+}
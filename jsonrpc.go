@@ -0,0 +1,170 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+)
+
+// RPCError is a JSON-RPC 2.0 error object. Handlers may return it to control the error code.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// RPCMethod is a method of a JSON-RPC endpoint.
+type RPCMethod struct {
+	name   string
+	handle func(ctx context.Context, params json.RawMessage) (any, error)
+}
+
+// RPC returns a JSON-RPC method with the given name calling handler with the decoded params.
+func RPC[Input, Output any](name string, handler func(context.Context, Input) (Output, error)) RPCMethod {
+	return RPCMethod{
+		name: name,
+		handle: func(ctx context.Context, params json.RawMessage) (any, error) {
+			var input Input
+			if len(params) > 0 {
+				if err := json.Unmarshal(params, &input); err != nil {
+					return nil, &RPCError{Code: RPCInvalidParams, Message: err.Error()}
+				}
+			}
+			return handler(ctx, input)
+		},
+	}
+}
+
+// JSONRPC returns an Option that mounts a JSON-RPC 2.0 endpoint at path accepting POST requests.
+// Calls are dispatched by method name, batch requests are answered with a batch response
+// and notifications without id get no response.
+func JSONRPC(path string, methods ...RPCMethod) Option {
+	return func(r *router) error {
+		byName := make(map[string]RPCMethod, len(methods))
+		for _, method := range methods {
+			byName[method.name] = method
+		}
+
+		route := r.fixedRoute(http.MethodPost, path)
+		r.register(route.node, RouteInfo{
+			Method:  http.MethodPost,
+			Pattern: route.pattern(),
+			Handler: "JSON-RPC",
+		}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var raw json.RawMessage
+			if err := json.NewDecoder(req.Body).Decode(&raw); err != nil {
+				writeRPC(w, rpcResponse{ID: json.RawMessage("null"), Error: &RPCError{Code: RPCParseError, Message: err.Error()}})
+				return
+			}
+
+			raw = bytes.TrimSpace(raw)
+			if len(raw) == 0 || raw[0] != '[' {
+				if response, ok := callRPC(req.Context(), byName, raw); ok {
+					writeRPC(w, response)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			var batch []json.RawMessage
+			if err := json.Unmarshal(raw, &batch); err != nil || len(batch) == 0 {
+				writeRPC(w, rpcResponse{ID: json.RawMessage("null"), Error: &RPCError{Code: RPCInvalidRequest, Message: "invalid batch"}})
+				return
+			}
+			var responses []rpcResponse
+			for _, call := range batch {
+				if response, ok := callRPC(req.Context(), byName, call); ok {
+					responses = append(responses, response)
+				}
+			}
+			if len(responses) == 0 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			writeRPC(w, responses)
+		}))
+		return nil
+	}
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// callRPC handles a single call and reports whether it expects a response.
+func callRPC(ctx context.Context, methods map[string]RPCMethod, raw json.RawMessage) (rpcResponse, bool) {
+	var call rpcRequest
+	if err := json.Unmarshal(raw, &call); err != nil || call.JSONRPC != "2.0" || call.Method == "" {
+		return rpcResponse{ID: json.RawMessage("null"), Error: &RPCError{Code: RPCInvalidRequest, Message: "invalid request"}}, true
+	}
+	notification := call.ID == nil
+
+	method, ok := methods[call.Method]
+	if !ok {
+		return rpcResponse{ID: call.ID, Error: &RPCError{Code: RPCMethodNotFound, Message: "method not found"}}, !notification
+	}
+
+	result, err := func() (result any, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = &RPCError{Code: RPCInternalError, Message: "internal error"}
+			}
+		}()
+		return method.handle(ctx, call.Params)
+	}()
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{Code: RPCInternalError, Message: err.Error()}
+		}
+		return rpcResponse{ID: call.ID, Error: rpcErr}, !notification
+	}
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	return rpcResponse{ID: call.ID, Result: result}, !notification
+}
+
+func writeRPC(w http.ResponseWriter, response any) {
+	switch response := response.(type) {
+	case rpcResponse:
+		response.JSONRPC = "2.0"
+		writeJSON(w, response)
+	case []rpcResponse:
+		for i := range response {
+			response[i].JSONRPC = "2.0"
+		}
+		writeJSON(w, response)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,81 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// KillSwitches disable routes at runtime without a redeploy, e.g. during incident response.
+// The zero value has all routes enabled and is safe for concurrent use.
+type KillSwitches struct {
+	mu       sync.RWMutex
+	disabled map[string]int
+}
+
+// Disable disables the routes with the given pattern, either with the method as reported by
+// RouteInfo.String like "POST /orders" or for all methods like "/orders". Requests to them are
+// answered with status, which is either 404 Not Found to hide them or 503 Service Unavailable.
+func (s *KillSwitches) Disable(pattern string, status int) error {
+	if status != http.StatusNotFound && status != http.StatusServiceUnavailable {
+		return fmt.Errorf("disabling %s with status %d, want 404 or 503", pattern, status)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.disabled == nil {
+		s.disabled = map[string]int{}
+	}
+	s.disabled[pattern] = status
+	return nil
+}
+
+// Enable enables the routes disabled with the same pattern again.
+func (s *KillSwitches) Enable(pattern string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.disabled, pattern)
+}
+
+// Disabled returns the patterns of the disabled routes with the status they are answered with.
+func (s *KillSwitches) Disabled() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	disabled := make(map[string]int, len(s.disabled))
+	for pattern, status := range s.disabled {
+		disabled[pattern] = status
+	}
+	return disabled
+}
+
+// status returns the status the route is answered with while disabled.
+func (s *KillSwitches) status(info RouteInfo) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if status, ok := s.disabled[info.String()]; ok {
+		return status, true
+	}
+	status, ok := s.disabled[info.Pattern]
+	return status, ok
+}
+
+// KillSwitch returns an Option that lets s disable the routes registered after it at runtime.
+func KillSwitch(s *KillSwitches) Option {
+	return func(r *router) error {
+		r.killSwitches = s
+		return nil
+	}
+}
+
+func (s *KillSwitches) wrap(cfg *config, info RouteInfo, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, disabled := s.status(info)
+		switch {
+		case !disabled:
+			handler.ServeHTTP(w, r)
+		case status == http.StatusNotFound:
+			cfg.HandleErr(r.Context(), w, WithStatus(status, Messagef("not found")))
+		default:
+			cfg.HandleErr(r.Context(), w, WithStatus(status, Messagef("route %s is disabled", info)))
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package route
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// Lazy is an input field whose value is only bound when the handler first calls Get, e.g. to skip
+// parsing a large body or introspecting a token on early-exit paths. Bind it with LazyValue.
+type Lazy[T any] struct {
+	state *lazyState[T]
+}
+
+type lazyState[T any] struct {
+	once  sync.Once
+	load  func() (T, func(error) error, error)
+	value T
+	err   error
+	close func(error) error
+}
+
+// Get binds the value on first use and returns it or the error binding failed with on every call.
+// It fails after the request was handled.
+func (l Lazy[T]) Get() (T, error) {
+	if l.state == nil {
+		var zero T
+		return zero, errors.New("lazy value is not bound")
+	}
+	l.state.once.Do(func() {
+		l.state.value, l.state.close, l.state.err = l.state.load()
+	})
+	return l.state.value, l.state.err
+}
+
+// LazyValue returns a FieldOption that binds a Lazy field with the FieldOptions of its value type
+// when the handler first calls Get. Call it with ByType(LazyValue(RequestValue(parseUser))).
+// Closers of the options run after the request if the value was bound. Lazy fields can not add path segments.
+func LazyValue[T any](opts ...FieldOption[*T]) FieldOption[*Lazy[T]] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*Lazy[T]], error) {
+		segments := len(route.segments)
+		mod, err := combinedFieldModifier(opts, route, name, reflect.TypeFor[T]())
+		if err != nil {
+			return nil, err
+		}
+		if len(route.segments) != segments {
+			return nil, errors.New("lazy fields can not add path segments")
+		}
+		return func(r *request, v *Lazy[T]) (func(error) error, error) {
+			detached := &request{Request: r.Request}
+			state := &lazyState[T]{load: func() (T, func(error) error, error) {
+				var value T
+				close, err := mod(detached, &value)
+				return value, close, err
+			}}
+			*v = Lazy[T]{state: state}
+			return func(err error) error {
+				state.once.Do(func() {
+					state.err = errors.New("lazy value accessed after the request")
+				})
+				if state.close != nil {
+					return state.close(err)
+				}
+				return nil
+			}, nil
+		}, nil
+	}
+}
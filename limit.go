@@ -0,0 +1,140 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// ResponseLimitPolicy decides what happens to responses exceeding MaxResponseBytes.
+type ResponseLimitPolicy int
+
+const (
+	// ResponseLimitError discards the response and reports an error with 500 instead.
+	ResponseLimitError ResponseLimitPolicy = iota
+	// ResponseLimitStream sends the response anyway, streamed without Content-Length.
+	ResponseLimitStream
+)
+
+// MaxResponseBytes returns an Option that guards against the routes registered after it
+// answering with more than n bytes. Responses up to n bytes are buffered and sent with
+// Content-Length, larger ones are handled by the policy and reported to violation, which may be nil.
+// Flushing a buffered response streams it under ResponseLimitStream and is not supported under ResponseLimitError.
+func MaxResponseBytes(n int64, policy ResponseLimitPolicy, violation func(ctx context.Context, info RouteInfo)) Option {
+	return func(r *router) error {
+		r.responseLimit = &responseLimit{n: n, policy: policy, violation: violation}
+		return nil
+	}
+}
+
+type responseLimit struct {
+	n         int64
+	policy    ResponseLimitPolicy
+	violation func(ctx context.Context, info RouteInfo)
+}
+
+func (l *responseLimit) wrap(cfg *config, info RouteInfo, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lw := &limitWriter{ResponseWriter: w, limit: l, header: http.Header{}}
+		handler.ServeHTTP(lw, r)
+
+		if lw.exceeded && l.violation != nil {
+			l.violation(r.Context(), info)
+		}
+		switch {
+		case lw.exceeded && l.policy == ResponseLimitError:
+			cfg.HandleErr(r.Context(), w, fmt.Errorf("response exceeds %d bytes", l.n))
+		case !lw.streaming:
+			if r.Method != http.MethodHead && lw.status != http.StatusNoContent && lw.status != http.StatusNotModified {
+				lw.header.Set("Content-Length", strconv.Itoa(lw.body.Len()))
+			}
+			lw.flush()
+		}
+	})
+}
+
+// limitWriter buffers a response up to the limit before it is sent.
+type limitWriter struct {
+	http.ResponseWriter
+	limit  *responseLimit
+	header http.Header
+	status int
+	body   bytes.Buffer
+
+	exceeded  bool
+	streaming bool
+	streamed  int64 // bytes sent while streaming
+}
+
+func (w *limitWriter) Header() http.Header {
+	if w.streaming {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *limitWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.streaming {
+		// a flushed response may exceed the limit only while streaming
+		w.streamed += int64(len(p))
+		w.exceeded = w.exceeded || w.streamed > w.limit.n
+		return w.ResponseWriter.Write(p)
+	}
+	if w.exceeded {
+		return len(p), nil
+	}
+	if int64(w.body.Len()+len(p)) <= w.limit.n {
+		return w.body.Write(p)
+	}
+
+	w.exceeded = true
+	if w.limit.policy != ResponseLimitStream {
+		w.body.Reset()
+		return len(p), nil
+	}
+	w.flush()
+	w.streaming = true
+	return w.ResponseWriter.Write(p)
+}
+
+// flush sends the header and the buffered body.
+func (w *limitWriter) flush() {
+	header := w.ResponseWriter.Header()
+	for name, values := range w.header {
+		header[name] = values
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	_, _ = w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// FlushError sends the buffered response and streams the rest of it under ResponseLimitStream.
+// Under ResponseLimitError the response may still be discarded, so it is not flushed.
+func (w *limitWriter) FlushError() error {
+	if !w.streaming {
+		if w.limit.policy != ResponseLimitStream {
+			return fmt.Errorf("flushing a response limited to %d bytes: %w", w.limit.n, http.ErrNotSupported)
+		}
+		w.flush()
+		w.streamed = int64(w.body.Len())
+		w.streaming = true
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *limitWriter) Flush() {
+	_ = w.FlushError()
+}
+
+func (w *limitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
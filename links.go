@@ -0,0 +1,123 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// Reverse returns the path of a route pattern as reported by RouteInfo.Pattern
+// with its variable segments replaced by the given values in order.
+// A trailing {name...} segment takes a value containing slashes.
+func Reverse(pattern string, values ...any) (string, error) {
+	if pattern == "/" {
+		if len(values) > 0 {
+			return "", fmt.Errorf("pattern %s takes no values, got %d", pattern, len(values))
+		}
+		return pattern, nil
+	}
+	segments := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	used := 0
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") {
+			continue
+		}
+		if used == len(values) {
+			return "", fmt.Errorf("pattern %s takes more than %d values", pattern, len(values))
+		}
+		value := fmt.Sprint(values[used])
+		used++
+		if strings.HasSuffix(segment, "...}") {
+			parts := strings.Split(value, "/")
+			for j, part := range parts {
+				parts[j] = url.PathEscape(part)
+			}
+			segments[i] = strings.Join(parts, "/")
+			continue
+		}
+		segments[i] = url.PathEscape(value)
+	}
+	if used != len(values) {
+		return "", fmt.Errorf("pattern %s takes %d values, got %d", pattern, used, len(values))
+	}
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+// Linker is implemented by outputs that declare hypermedia links, e.g. self, next or related,
+// by relation name. Use Reverse to build them from route patterns.
+type Linker interface {
+	Links(ctx context.Context) map[string]string
+}
+
+// HypermediaLinks returns an Option that adds the links of Linker outputs as _links to JSON responses.
+// With hal the links are encoded as HAL link objects and the response gets the HAL media type,
+// otherwise _links maps relations to plain URLs.
+// Elements of slice outputs get their own links.
+// It wraps the response encoder set before it.
+func HypermediaLinks(hal bool) Option {
+	return func(r *router) error {
+		encoder := r.responseEncoder
+		if encoder == nil {
+			return errors.New("HypermediaLinks requires a response encoder")
+		}
+		r.responseEncoder = func(ctx context.Context, w http.ResponseWriter, v any) error {
+			linked, ok, err := withLinks(ctx, v, hal)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return encoder(ctx, w, v)
+			}
+			if hal {
+				w.Header().Set("Content-Type", "application/hal+json")
+			}
+			return encoder(ctx, w, linked)
+		}
+		return nil
+	}
+}
+
+func withLinks(ctx context.Context, v any, hal bool) (any, bool, error) {
+	if linker, ok := v.(Linker); ok {
+		generic, err := toGeneric(v)
+		if err != nil {
+			return nil, false, err
+		}
+		object, ok := generic.(map[string]any)
+		if !ok {
+			return v, false, nil
+		}
+		object["_links"] = encodeLinks(linker.Links(ctx), hal)
+		return object, true, nil
+	}
+
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Slice || !value.Type().Elem().Implements(reflect.TypeFor[Linker]()) {
+		return v, false, nil
+	}
+	elements := make([]any, value.Len())
+	for i := range elements {
+		element, _, err := withLinks(ctx, value.Index(i).Interface(), hal)
+		if err != nil {
+			return nil, false, err
+		}
+		elements[i] = element
+	}
+	return elements, true, nil
+}
+
+func encodeLinks(links map[string]string, hal bool) map[string]any {
+	encoded := make(map[string]any, len(links))
+	for rel, href := range links {
+		if hal {
+			encoded[rel] = map[string]string{"href": href}
+			continue
+		}
+		encoded[rel] = href
+	}
+	return encoded
+}
@@ -0,0 +1,143 @@
+package route
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LoadShed returns an Option that monitors the requests to the routes registered after it.
+// The routes are under pressure while more than maxInFlight requests are in flight or the
+// moving average of their latency exceeds maxLatency. Under pressure requests to PriorityBatch
+// routes are rejected with 503 and Retry-After before they add to the load, requests to
+// PriorityNormal routes once the pressure doubles. PriorityCritical routes are never shed.
+// While requests are shed for their latency, one is let through whenever none was admitted for
+// maxLatency, so the moving average recovers once the routes are fast again.
+func LoadShed(maxInFlight int, maxLatency time.Duration) Option {
+	return func(r *router) error {
+		r.shedder = stateOf(r.state, r.state.optionKey("load shed", maxInFlight, maxLatency), func() *loadShedder {
+			return &loadShedder{maxInFlight: int64(maxInFlight), maxLatency: maxLatency}
+		})
+		return nil
+	}
+}
+
+// PriorityClass classifies routes by how important their requests are when the server is under load.
+type PriorityClass string
+
+const (
+	PriorityCritical PriorityClass = "critical"
+	PriorityNormal   PriorityClass = ""
+	PriorityBatch    PriorityClass = "batch"
+)
+
+// Priority returns an Option that classifies the routes registered after it, so LoadShed and
+// MaxConcurrent let batch endpoints yield under pressure before normal and critical ones.
+func Priority(class PriorityClass) Option {
+	return func(r *router) error {
+		switch class {
+		case PriorityCritical, PriorityNormal, PriorityBatch:
+		default:
+			return fmt.Errorf("unknown priority class %q", class)
+		}
+		r.priority = class
+		return nil
+	}
+}
+
+// LowPriority returns an Option that marks the routes registered after it as the first to be shed under load.
+// It is Priority(PriorityBatch).
+func LowPriority() Option {
+	return Priority(PriorityBatch)
+}
+
+type loadShedder struct {
+	maxInFlight int64
+	maxLatency  time.Duration
+
+	inFlight atomic.Int64
+
+	mu       sync.Mutex
+	latency  float64 // exponentially weighted moving average in seconds
+	observed time.Time
+}
+
+func (s *loadShedder) wrap(cfg *config, priority PriorityClass, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.shed(priority) {
+			w.Header().Set("Retry-After", "1")
+			cfg.HandleErr(r.Context(), w, WithStatus(http.StatusServiceUnavailable, Messagef("shedding load")))
+			return
+		}
+
+		s.inFlight.Add(1)
+		start := time.Now()
+		defer func() {
+			s.inFlight.Add(-1)
+			s.observe(time.Since(start))
+		}()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// shed reports whether requests of the priority class are rejected at the current pressure.
+func (s *loadShedder) shed(priority PriorityClass) bool {
+	var limit float64
+	switch priority {
+	case PriorityCritical:
+		return false
+	case PriorityBatch:
+		limit = 1
+	default:
+		limit = 2
+	}
+	inFlight, latency := s.pressure()
+	if inFlight > limit {
+		return true
+	}
+	return latency > limit && !s.probe()
+}
+
+// pressure returns the requests in flight and the latency relative to their limits,
+// each is more than 1 while under pressure.
+func (s *loadShedder) pressure() (inFlight, latency float64) {
+	if s.maxInFlight > 0 {
+		inFlight = float64(s.inFlight.Load()) / float64(s.maxInFlight)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxLatency > 0 {
+		latency = s.latency / s.maxLatency.Seconds()
+	}
+	return inFlight, latency
+}
+
+// probe reports whether a request is let through despite the latency because no request
+// was admitted for maxLatency. Shed requests don't update the moving average, without probes
+// it would never recover.
+func (s *loadShedder) probe() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.observed) < s.maxLatency {
+		return false
+	}
+	s.observed = now
+	return true
+}
+
+func (s *loadShedder) observe(latency time.Duration) {
+	const weight = 0.1
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observed = time.Now()
+	if s.latency == 0 || math.IsNaN(s.latency) {
+		s.latency = latency.Seconds()
+		return
+	}
+	s.latency += weight * (latency.Seconds() - s.latency)
+}
@@ -0,0 +1,149 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// LoadTarget is a request of a load test scenario generated from a route by LoadTargets.
+type LoadTarget struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// LoadTargets returns a request for each route so load tests stay in sync with the routes actually registered.
+// Variable segments are filled with the example of their name, "1" if there is none. Routes with an input
+// field named Body send an example generated from its schema, which clients may replace with realistic ones,
+// e.g. taken from Sampler.
+func LoadTargets(routes []RouteInfo, baseURL string, examples map[string]string) []LoadTarget {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	targets := make([]LoadTarget, 0, len(routes))
+	for _, route := range routes {
+		segments := strings.Split(route.Pattern, "/")
+		for i, segment := range segments {
+			name, ok := strings.CutPrefix(segment, "{")
+			if !ok {
+				continue
+			}
+			name = strings.TrimSuffix(strings.TrimSuffix(name, "}"), "...")
+			segments[i] = "1"
+			if example, ok := examples[name]; ok {
+				segments[i] = example
+			}
+		}
+		target := LoadTarget{Method: route.Method, URL: baseURL + strings.Join(segments, "/")}
+		if route.InputType != nil {
+			if field, ok := route.InputType.FieldByName("Body"); ok {
+				target.Body, _ = json.Marshal(exampleOf(SchemaFor(field.Type)))
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// exampleOf returns a value valid for the schema.
+func exampleOf(s *Schema) any {
+	if len(s.Enum) > 0 {
+		return s.Enum[0]
+	}
+	typ := "null"
+	for _, t := range s.Type {
+		if t != "null" {
+			typ = t
+			break
+		}
+	}
+	switch typ {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			return "2006-01-02T15:04:05Z"
+		case "byte":
+			return ""
+		}
+		example := "example"
+		if s.MinLength != nil && *s.MinLength > len(example) {
+			example += strings.Repeat("x", *s.MinLength-len(example))
+		}
+		if s.MaxLength != nil && *s.MaxLength < len(example) {
+			example = example[:*s.MaxLength]
+		}
+		return example
+	case "integer", "number":
+		if s.Minimum != nil {
+			return *s.Minimum
+		}
+		if s.Maximum != nil && *s.Maximum < 1 {
+			return *s.Maximum
+		}
+		return 1
+	case "boolean":
+		return true
+	case "array":
+		if s.Items == nil {
+			return []any{}
+		}
+		return []any{exampleOf(s.Items)}
+	case "object":
+		object := map[string]any{}
+		for name, property := range s.Properties {
+			object[name] = exampleOf(property)
+		}
+		return object
+	default:
+		return nil
+	}
+}
+
+// vegetaTarget is a target in the JSON format of vegeta attack -format=json.
+type vegetaTarget struct {
+	Method string              `json:"method"`
+	URL    string              `json:"url"`
+	Body   []byte              `json:"body,omitempty"`
+	Header map[string][]string `json:"header,omitempty"`
+}
+
+// WriteVegetaTargets writes the targets in the JSON format of vegeta, one per line, to attack them with
+// vegeta attack -format=json.
+func WriteVegetaTargets(w io.Writer, targets []LoadTarget) error {
+	encoder := json.NewEncoder(w)
+	for _, target := range targets {
+		vt := vegetaTarget{Method: target.Method, URL: target.URL}
+		if target.Body != nil {
+			vt.Body = target.Body
+			vt.Header = http.Header{"Content-Type": {"application/json"}}
+		}
+		if err := encoder.Encode(vt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteK6Script writes a k6 script requesting all targets in each iteration, to run it with k6 run.
+func WriteK6Script(w io.Writer, targets []LoadTarget) error {
+	data, err := json.MarshalIndent(targets, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, `import http from 'k6/http';
+
+const targets = %s;
+
+export default function () {
+  for (const target of targets) {
+    if (target.body === undefined) {
+      http.request(target.method, target.url);
+      continue;
+    }
+    http.request(target.method, target.url, JSON.stringify(target.body), { headers: { 'Content-Type': 'application/json' } });
+  }
+}
+`, data)
+	return err
+}
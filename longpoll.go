@@ -0,0 +1,37 @@
+package route
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// LongPoll returns an Option that registers a long polling GET route.
+// The handler returns a channel the route waits on for up to maxWait:
+// the first value received is the response, on timeout or if the channel is closed
+// the route answers with 204 No Content. Disconnecting clients cancel the wait.
+func LongPoll[Input, Output any](maxWait time.Duration, handler func(context.Context, Input) (<-chan Output, error)) Option {
+	return func(r *router) error {
+		return routeHandler(r, http.MethodGet, &r.get, func(ctx context.Context, in Input) (Output, error) {
+			var zero Output
+			ch, err := handler(ctx, in)
+			if err != nil {
+				return zero, err
+			}
+
+			timer := time.NewTimer(maxWait)
+			defer timer.Stop()
+			select {
+			case v, ok := <-ch:
+				if !ok {
+					return zero, ErrNoContent
+				}
+				return v, nil
+			case <-timer.C:
+				return zero, ErrNoContent
+			case <-ctx.Done():
+				return zero, ctx.Err()
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package route
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Maintenance is a switch for maintenance mode that can be flipped at runtime.
+// The zero value is switched off.
+type Maintenance struct {
+	retryAfter atomic.Int64 // seconds
+	on         atomic.Bool
+}
+
+// Enable switches maintenance mode on. Clients are told to retry after the given duration.
+func (m *Maintenance) Enable(retryAfter time.Duration) {
+	m.retryAfter.Store(int64(retryAfter.Round(time.Second) / time.Second))
+	m.on.Store(true)
+}
+
+// Disable switches maintenance mode off.
+func (m *Maintenance) Disable() {
+	m.on.Store(false)
+}
+
+// Enabled reports whether maintenance mode is switched on.
+func (m *Maintenance) Enabled() bool {
+	return m.on.Load()
+}
+
+// MaintenanceMode returns an Option that answers requests to the routes registered after it
+// with 503 and Retry-After while m is enabled. Pass nil within a Group to keep routes like
+// health checks alive.
+func MaintenanceMode(m *Maintenance) Option {
+	return func(r *router) error {
+		r.maintenance = m
+		return nil
+	}
+}
+
+func (m *Maintenance) wrap(cfg *config, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.Enabled() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if retryAfter := m.retryAfter.Load(); retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		}
+		cfg.HandleErr(r.Context(), w, WithStatus(http.StatusServiceUnavailable, Messagef("down for maintenance")))
+	})
+}
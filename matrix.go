@@ -0,0 +1,91 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/generikvault/route/getter"
+)
+
+// MatrixParams returns an Option that strips matrix parameters like ;color=red;size=m from the path
+// segments before matching, so /items;color=red matches /items. Fields bound with Matrix receive them.
+// Like NormalizePath it applies to the whole router regardless of its position. Matrix parameters are
+// kept by segment position, so segments removed by NormalizePath shift them.
+func MatrixParams() Option {
+	return func(r *router) error {
+		r.matrix = true
+		return nil
+	}
+}
+
+// Matrix returns a FieldOption that binds the matrix parameters of the path segment added by the field
+// before it, e.g. the Items field of /items;color=red. The field is a url.Values or a struct bound as
+// getter.IntoStruct binds query parameters. It requires the MatrixParams option.
+func Matrix() FieldOption[any] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[any], error) {
+		if len(route.segments) == 0 {
+			return nil, fmt.Errorf("matrix parameters of %s need a path segment before them", name)
+		}
+		segment := len(route.segments) - 1
+		return func(r *request, v any) (func(error) error, error) {
+			params, _ := r.Context().Value(matrixKey{}).([]url.Values)
+			var values url.Values
+			if segment < len(params) {
+				values = params[segment]
+			}
+			if target, ok := v.(*url.Values); ok {
+				*target = values
+				return nil, nil
+			}
+			query := &http.Request{URL: &url.URL{RawQuery: values.Encode()}}
+			return nil, WithStatus(http.StatusBadRequest, getter.IntoStruct(query, v))
+		}, nil
+	}
+}
+
+type matrixKey struct{}
+
+// stripMatrix returns the request without matrix parameters in its path, which its context holds instead.
+func stripMatrix(req *http.Request) (*http.Request, error) {
+	escaped := req.URL.EscapedPath()
+	if !strings.Contains(escaped, ";") {
+		return req, nil
+	}
+	segments := strings.Split(escaped, "/")[1:]
+	params := make([]url.Values, len(segments))
+	for i, segment := range segments {
+		segment, matrix, ok := strings.Cut(segment, ";")
+		segments[i] = segment
+		if !ok {
+			continue
+		}
+		params[i] = url.Values{}
+		for _, param := range strings.Split(matrix, ";") {
+			key, value, _ := strings.Cut(param, "=")
+			key, err := url.PathUnescape(key)
+			if err != nil {
+				return nil, err
+			}
+			value, err = url.PathUnescape(value)
+			if err != nil {
+				return nil, err
+			}
+			params[i].Add(key, value)
+		}
+	}
+
+	u := *req.URL
+	u.RawPath = "/" + strings.Join(segments, "/")
+	path, err := url.PathUnescape(u.RawPath)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path
+	stripped := req.WithContext(context.WithValue(req.Context(), matrixKey{}, params))
+	stripped.URL = &u
+	return stripped, nil
+}
@@ -0,0 +1,65 @@
+package route
+
+import (
+	"net/http"
+	"strings"
+)
+
+// AutomaticHead returns an Option that enables or disables answering HEAD requests with the GET routes
+// registered after it, which is enabled by default. Disable it for expensive GET handlers that should
+// not run for HEAD requests, they are rejected with 405 Method Not Allowed then.
+func AutomaticHead(enabled bool) Option {
+	return func(r *router) error {
+		r.noAutoHead = !enabled
+		return nil
+	}
+}
+
+func rejectHead(cfg *config, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Allow", http.MethodGet)
+			cfg.HandleErr(r.Context(), w, WithStatus(http.StatusMethodNotAllowed, Messagef("method not allowed")))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// AutomaticOptions returns an Option that enables or disables answering OPTIONS requests for the routes
+// registered after it, which is enabled by default. OPTIONS requests are answered with 204 No Content
+// and an Allow header listing the methods of the routes matching the path that have it enabled.
+// Paths without such routes are not found.
+func AutomaticOptions(enabled bool) Option {
+	return func(r *router) error {
+		r.noAutoOptions = !enabled
+		return nil
+	}
+}
+
+// serveOptions answers an OPTIONS request for the path and reports whether a route matched.
+// It answers CORS preflight requests too, see CORS.
+func (r *router) serveOptions(w http.ResponseWriter, req *http.Request, path []string) bool {
+	var allow []string
+	policies := map[string]*CORSPolicy{}
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		tree := r.Node(method)
+		if match, ok := tree.lookup(path); ok && match.handler != nil && !match.noAutoOptions {
+			allow = append(allow, method)
+			policies[method] = match.cors
+			if method == http.MethodGet && !match.noAutoHead {
+				allow = append(allow, http.MethodHead)
+				policies[http.MethodHead] = match.cors
+			}
+		}
+	}
+	if len(allow) == 0 {
+		return false
+	}
+	if req.Header.Get("Origin") != "" && req.Header.Get("Access-Control-Request-Method") != "" {
+		preflight(w.Header(), req, policies)
+	}
+	w.Header().Set("Allow", strings.Join(append(allow, http.MethodOptions), ", "))
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
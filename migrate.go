@@ -0,0 +1,96 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// BodyMigration upgrades request bodies of an old version, see MigrateBody.
+type BodyMigration struct {
+	version  string
+	from, to reflect.Type
+	migrate  func(any) (any, error)
+}
+
+// MigrateBody returns a BodyMigration that decodes bodies of the version as Old and migrates them to New.
+// New may be the Old of another migration, so v1 → v2 → v3 chains only need one migration per step.
+func MigrateBody[Old, New any](version string, migrate func(Old) (New, error)) BodyMigration {
+	return BodyMigration{
+		version: version,
+		from:    reflect.TypeFor[Old](),
+		to:      reflect.TypeFor[New](),
+		migrate: func(v any) (any, error) {
+			return migrate(v.(Old))
+		},
+	}
+}
+
+// VersionedJSONBody returns a FieldOption that decodes the JSON request body of the version named by
+// the header and migrates it to the field type, so handlers only see the newest input shape.
+// Bodies of the current version or without the header are decoded into the field directly,
+// unknown versions are rejected with 400.
+func VersionedJSONBody(header, current string, migrations ...BodyMigration) FieldOption[any] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[any], error) {
+		byVersion := map[string]BodyMigration{}
+		byType := map[reflect.Type]BodyMigration{}
+		for _, m := range migrations {
+			if m.version == current {
+				return nil, fmt.Errorf("migration of %s version %s is the current version", name, current)
+			}
+			byVersion[m.version] = m
+			byType[m.from] = m
+		}
+		// chain returns the migrations from the version to the field type.
+		chain := func(m BodyMigration) ([]BodyMigration, error) {
+			steps := []BodyMigration{m}
+			for m.to != field {
+				next, ok := byType[m.to]
+				if !ok || len(steps) > len(migrations) {
+					return nil, fmt.Errorf("migration of %s version %s does not lead to %s", name, steps[0].version, field)
+				}
+				m = next
+				steps = append(steps, m)
+			}
+			return steps, nil
+		}
+		chains := map[string][]BodyMigration{}
+		for version, m := range byVersion {
+			steps, err := chain(m)
+			if err != nil {
+				return nil, err
+			}
+			chains[version] = steps
+		}
+
+		return func(r *request, value any) (func(error) error, error) {
+			version := r.Header.Get(header)
+			if version == "" || version == current {
+				return nil, json.NewDecoder(r.Body).Decode(value)
+			}
+			steps, ok := chains[version]
+			if !ok {
+				return nil, WithStatus(http.StatusBadRequest, Messagef("unknown %s %q", header, version))
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				return nil, err
+			}
+			old := reflect.New(steps[0].from)
+			if err := json.Unmarshal(body, old.Interface()); err != nil {
+				return nil, WithStatus(http.StatusBadRequest, err)
+			}
+			migrated := old.Elem().Interface()
+			for _, step := range steps {
+				migrated, err = step.migrate(migrated)
+				if err != nil {
+					return nil, WithStatus(http.StatusBadRequest, fmt.Errorf("migrating %s body from version %s: %w", name, step.version, err))
+				}
+			}
+			reflect.ValueOf(value).Elem().Set(reflect.ValueOf(migrated))
+			return nil, nil
+		}, nil
+	}
+}
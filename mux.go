@@ -0,0 +1,40 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// MuxPattern returns the route as http.ServeMux pattern, e.g. "GET /users/{ID}".
+func (i RouteInfo) MuxPattern() string {
+	if i.Pattern == "/" {
+		return i.Method + " /{$}"
+	}
+	return i.Method + " " + i.Pattern
+}
+
+// RegisterMux registers the routes of the given options on the mux with their MuxPattern,
+// so the package can be embedded into servers that already use the standard library mux.
+// The mux hands the requests to the router, which matches and binds them as usual.
+func RegisterMux(mux *http.ServeMux, opts ...Option) (err error) {
+	router, err := newRouter(opts...)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("registering on mux: %v", p)
+		}
+	}()
+	registered := map[string]bool{}
+	for _, info := range router.routes {
+		pattern := info.MuxPattern()
+		if registered[pattern] {
+			continue
+		}
+		registered[pattern] = true
+		mux.Handle(pattern, router)
+	}
+	return nil
+}
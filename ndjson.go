@@ -0,0 +1,145 @@
+package route
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"reflect"
+)
+
+// Stream is an input field holding the JSON Lines records of the request body, decoded one at a time
+// while the handler iterates them so bulk imports don't load the whole body into memory. Bind it with NDJSONBody.
+// The records can be iterated once and only during the request.
+type Stream[T any] struct {
+	state *streamState
+}
+
+type streamState struct {
+	decoder  *json.Decoder
+	consumed bool
+	done     bool
+	err      error
+}
+
+// All returns the records. Iteration stops at the first malformed record, check Err afterwards.
+func (s Stream[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		_ = s.Each(func(record T) error {
+			if !yield(record) {
+				return errStopStream
+			}
+			return nil
+		})
+	}
+}
+
+// Err returns the error reading the records stopped with. Malformed records are reported with 400.
+func (s Stream[T]) Err() error {
+	if s.state == nil {
+		return nil
+	}
+	return s.state.err
+}
+
+// Each calls fn for every record and returns the first error of fn or of reading the records.
+func (s Stream[T]) Each(fn func(record T) error) error {
+	if s.state == nil {
+		return errors.New("stream is not bound")
+	}
+	if s.state.done {
+		return errors.New("stream used after the request")
+	}
+	if s.state.consumed {
+		return errors.New("stream already consumed")
+	}
+	s.state.consumed = true
+	for n := 1; ; n++ {
+		var record T
+		err := s.state.decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			s.state.err = WithStatus(http.StatusBadRequest, fmt.Errorf("record %d: %w", n, err))
+			return s.state.err
+		}
+		if err := fn(record); err != nil {
+			if errors.Is(err, errStopStream) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+var errStopStream = errors.New("stop stream")
+
+// NDJSONBody returns a FieldOption that binds the request body as Stream of JSON Lines records,
+// e.g. sent as application/x-ndjson. Call it with ByType(NDJSONBody[Record]()).
+func NDJSONBody[T any]() FieldOption[*Stream[T]] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*Stream[T]], error) {
+		return func(r *request, v *Stream[T]) (func(error) error, error) {
+			state := &streamState{decoder: json.NewDecoder(r.Body)}
+			*v = Stream[T]{state: state}
+			return func(err error) error {
+				state.done = true
+				return nil
+			}, nil
+		}, nil
+	}
+}
+
+// NDJSONResponse returns an Option that encodes outputs as JSON Lines, one line per element of slices,
+// arrays and iter.Seq outputs and a single line for other values. Lines of iter.Seq outputs are flushed
+// as they are produced, so exports can stream large results.
+func NDJSONResponse() Option {
+	return ResponseEncoder(encodeNDJSON)
+}
+
+func encodeNDJSON(ctx context.Context, w http.ResponseWriter, v any) error {
+	setContentType(w.Header(), "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	value := reflect.ValueOf(v)
+	switch {
+	case !value.IsValid():
+		return encoder.Encode(v)
+	case value.Kind() == reflect.Slice || value.Kind() == reflect.Array:
+		for i := range value.Len() {
+			if err := encoder.Encode(value.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case isSeq(value.Type()) && !value.IsNil():
+		controller := http.NewResponseController(w)
+		var err error
+		yield := reflect.MakeFunc(value.Type().In(0), func(args []reflect.Value) []reflect.Value {
+			if err = encoder.Encode(args[0].Interface()); err == nil {
+				if err = controller.Flush(); errors.Is(err, http.ErrNotSupported) {
+					err = nil
+				}
+			}
+			return []reflect.Value{reflect.ValueOf(err == nil && ctx.Err() == nil)}
+		})
+		value.Call([]reflect.Value{yield})
+		if err == nil {
+			err = ctx.Err()
+		}
+		return err
+	default:
+		return encoder.Encode(v)
+	}
+}
+
+// isSeq reports whether t is a func(yield func(T) bool) like iter.Seq.
+func isSeq(t reflect.Type) bool {
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 0 {
+		return false
+	}
+	yield := t.In(0)
+	return yield.Kind() == reflect.Func && yield.NumIn() == 1 && yield.NumOut() == 1 && yield.Out(0).Kind() == reflect.Bool
+}
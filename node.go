@@ -10,23 +10,59 @@ type node struct {
 	child          *node
 	allowRemainder bool
 	handler        http.Handler
+	// noAutoHead and noAutoOptions exclude the route from answering HEAD and OPTIONS requests,
+	// see AutomaticHead and AutomaticOptions.
+	noAutoHead    bool
+	noAutoOptions bool
+	// cors is the policy preflight requests for the route are answered with.
+	cors *CORSPolicy
 }
 
 func (n node) Handler(path []string) (http.Handler, bool) {
+	match, ok := n.lookup(path)
+	if !ok {
+		return nil, false
+	}
+	return match.handler, true
+}
+
+// lookup returns the node handling the path.
+func (n *node) lookup(path []string) (*node, bool) {
 	if len(path) == 0 {
-		return n.handler, n.handler != nil
+		return n, n.handler != nil
 	}
 	first := strings.ToLower(path[0])
 	if child, ok := n.childs[first]; ok {
-		if handler, ok := child.Handler(path[1:]); ok {
-			return handler, true
+		if match, ok := child.lookup(path[1:]); ok {
+			return match, true
 		}
 	}
 	if n.child != nil {
-		return n.child.Handler(path[1:])
+		return n.child.lookup(path[1:])
 	}
 	if n.allowRemainder {
-		return n.handler, true
+		return n, true
 	}
 	return nil, false
 }
+
+// nodeOf returns the node a route pattern was registered at.
+func (n *node) nodeOf(pattern string) (*node, bool) {
+	if pattern == "/" {
+		return n, true
+	}
+	for _, segment := range strings.Split(strings.TrimPrefix(pattern, "/"), "/") {
+		switch {
+		case strings.HasSuffix(segment, "...}"):
+			return n, n.allowRemainder
+		case strings.HasPrefix(segment, "{"):
+			n = n.child
+		default:
+			n = n.childs[segment]
+		}
+		if n == nil {
+			return nil, false
+		}
+	}
+	return n, true
+}
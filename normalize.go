@@ -0,0 +1,102 @@
+package route
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PathNormalization selects how NormalizePath rewrites request paths.
+type PathNormalization uint8
+
+const (
+	// CollapseSlashes merges runs of slashes into one, so /a//b matches /a/b.
+	CollapseSlashes PathNormalization = 1 << iota
+	// ResolveDotSegments removes . segments and lets .. remove the segment before it.
+	// Encoded dots like %2e%2e are resolved as well.
+	ResolveDotSegments
+	// DecodePercent rewrites the escaped path canonically, so only characters that
+	// have to be escaped stay escaped and %61 and a are the same path.
+	DecodePercent
+)
+
+// NormalizePath returns an Option that normalizes request paths before they are matched.
+// The request handed to middleware and handlers carries the normalized URL, so middleware
+// matching on path strings sees the same path the router matched.
+// Unlike most options it applies to the whole router regardless of its position.
+func NormalizePath(normalizations ...PathNormalization) Option {
+	return func(r *router) error {
+		for _, n := range normalizations {
+			r.normalize |= n
+		}
+		return nil
+	}
+}
+
+// StrictPathDecoding returns an Option that rejects request paths with 400 if a segment
+// contains an encoded slash (%2F), backslash (%5C) or NUL byte, so a path ID can never
+// smuggle in a path separator. Without it %2F decodes to a slash inside its path ID.
+// Like NormalizePath it applies to the whole router regardless of its position.
+func StrictPathDecoding() Option {
+	return func(r *router) error {
+		r.strictPaths = true
+		return nil
+	}
+}
+
+// normalizePath returns the request with its URL normalized and the path segments.
+func (r *router) normalizePath(req *http.Request) (*http.Request, []string, error) {
+	n := r.normalize
+	path, err := splitPath(req.URL, r.strictPaths)
+	if err != nil || n == 0 {
+		return req, path, err
+	}
+
+	if n&CollapseSlashes != 0 {
+		collapsed := path[:0:0]
+		for i, segment := range path {
+			if segment != "" || i == len(path)-1 {
+				collapsed = append(collapsed, segment)
+			}
+		}
+		path = collapsed
+	}
+	if n&ResolveDotSegments != 0 {
+		resolved := path[:0:0]
+		for i, segment := range path {
+			last := i == len(path)-1
+			switch segment {
+			case ".":
+			case "..":
+				if len(resolved) > 0 {
+					resolved = resolved[:len(resolved)-1]
+				}
+			default:
+				resolved = append(resolved, segment)
+				continue
+			}
+			if last {
+				resolved = append(resolved, "")
+			}
+		}
+		path = resolved
+	}
+
+	u := *req.URL
+	u.Path = "/" + strings.Join(path, "/")
+	u.RawPath = ""
+	if strings.Contains(strings.Join(path, ""), "/") {
+		escaped := make([]string, len(path))
+		for i, segment := range path {
+			escaped[i] = url.PathEscape(segment)
+		}
+		u.RawPath = "/" + strings.Join(escaped, "/")
+	} else if n&DecodePercent == 0 && req.URL.RawPath != "" && u.Path == req.URL.Path {
+		u.RawPath = req.URL.RawPath
+	}
+
+	normalized := new(http.Request)
+	*normalized = *req
+	normalized.URL = &u
+	return normalized, path, nil
+}
@@ -3,22 +3,40 @@ package route
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"reflect"
 )
 
 // Option is a function that sets a router option.
 type Option func(*router) error
 
 // Join returns an Option that joins multiple options.
+// All options are applied even if some fail, their errors are joined.
 func Join(opts ...Option) Option {
 	return func(r *router) error {
+		var errs []error
 		for _, opt := range opts {
 			if err := opt(r); err != nil {
-				return err
+				errs = append(errs, err)
 			}
 		}
-		return nil
+		return errors.Join(errs...)
+	}
+}
+
+// Group returns an Option that applies opts like Join but confines the settings they make,
+// e.g. middleware, encoders and field options, to the routes registered within the group.
+func Group(opts ...Option) Option {
+	return func(r *router) error {
+		saved := r.config.clone()
+		defer func() {
+			r.config = saved
+		}()
+		return Join(opts...)(r)
 	}
 }
 
@@ -45,14 +63,45 @@ func JSONBody() FieldOption[any] {
 	})
 }
 
-// JSONResponse returns an Option that encodes the response as JSON.
+// JSONResponse returns an Option that encodes the response as JSON with the Content-Type application/json; charset=utf-8.
 func JSONResponse() Option {
 	return ResponseEncoder(func(ctx context.Context, w http.ResponseWriter, v any) error {
+		setContentType(w.Header(), "application/json; charset=utf-8")
 		return json.NewEncoder(w).Encode(v)
 	})
 }
 
+// ContentTyper is implemented by outputs that choose their Content-Type, overriding the one of the response encoder.
+type ContentTyper interface {
+	ContentType() string
+}
+
+// ContentType returns an Option that sets the Content-Type of the responses encoded by the response encoder
+// set before it, instead of leaving it to content sniffing. Outputs implementing ContentTyper or setting it
+// as HeaderSetter take precedence.
+func ContentType(contentType string) Option {
+	return func(r *router) error {
+		encoder := r.responseEncoder
+		if encoder == nil {
+			return errors.New("ContentType requires a response encoder")
+		}
+		r.responseEncoder = func(ctx context.Context, w http.ResponseWriter, v any) error {
+			setContentType(w.Header(), contentType)
+			return encoder(ctx, w, v)
+		}
+		return nil
+	}
+}
+
+// setContentType sets the Content-Type unless an output already set one.
+func setContentType(header http.Header, contentType string) {
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", contentType)
+	}
+}
+
 // HandleError returns an Option that sets the error handler.
+// Use ResponseCommitted to check whether the response was already partially written.
 func HandleError(handleErr func(ctx context.Context, w http.ResponseWriter, err error)) Option {
 	return func(r *router) error {
 		r.handleErr = handleErr
@@ -60,6 +109,61 @@ func HandleError(handleErr func(ctx context.Context, w http.ResponseWriter, err
 	}
 }
 
+// SafeErrors returns an Option that logs errors with all their details to the logger
+// but only sends the status text to the client, so panics and wrapped internals don't leak.
+// Verbose additionally sends the error message and is meant for development only.
+func SafeErrors(logger *slog.Logger, verbose bool) Option {
+	return HandleError(func(ctx context.Context, w http.ResponseWriter, err error) {
+		code := StatusCode(err)
+		logger.ErrorContext(ctx, "handling request", "status", code, "error", err)
+		if ResponseCommitted(w) {
+			return
+		}
+		msg := http.StatusText(code)
+		if verbose {
+			msg = err.Error()
+		}
+		http.Error(w, msg, code)
+	})
+}
+
+// ProblemDetails returns an Option that reports errors as RFC 9457 application/problem+json.
+// The error message is only sent as detail for client errors, server errors only carry the status text.
+// Errors after the response was committed are dropped, see ResponseCommitted.
+func ProblemDetails() Option {
+	return HandleError(func(ctx context.Context, w http.ResponseWriter, err error) {
+		if ResponseCommitted(w) {
+			return
+		}
+		code := StatusCode(err)
+		problem := struct {
+			Type   string `json:"type"`
+			Title  string `json:"title"`
+			Status int    `json:"status"`
+			Detail string `json:"detail,omitempty"`
+		}{
+			Type:   "about:blank",
+			Title:  http.StatusText(code),
+			Status: code,
+		}
+		if code < http.StatusInternalServerError {
+			problem.Detail = err.Error()
+		}
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(problem)
+	})
+}
+
+// MaxBodySize returns an Option that limits the request bodies of the routes registered after it to n bytes.
+// Reading beyond the limit fails with an error reported as 413.
+func MaxBodySize(n int64) Option {
+	return Middleware(func(next http.Handler) http.Handler {
+		return http.MaxBytesHandler(next, n)
+	})
+}
+
 // Middleware returns an Option that adds given middleware.
 func Middleware(middleware ...func(http.Handler) http.Handler) Option {
 	return func(r *router) error {
@@ -67,3 +171,56 @@ func Middleware(middleware ...func(http.Handler) http.Handler) Option {
 		return nil
 	}
 }
+
+// OnResponse returns an Option that passes the Output of the routes registered after it through
+// the hook before it is encoded, so responses can be enriched or masked centrally.
+// Hooks run in the order they were added and receive the Output the previous one returned.
+func OnResponse(hook func(ctx context.Context, info RouteInfo, output any) (any, error)) Option {
+	return func(r *router) error {
+		r.onResponse = append(r.onResponse, hook)
+		return nil
+	}
+}
+
+// AfterCommit returns an Option that calls the hook with the Input and the Output of the routes registered
+// after it once the handler, the response encoding and all closers succeeded, e.g. after a transaction
+// bound by ClosableRequestValue committed. Event publication and notifications can live there instead
+// of the handlers. Hooks run in the order they were added after the response was written.
+// Handlers answering with ErrNoContent succeed as well, their output is nil.
+func AfterCommit(hook func(ctx context.Context, info RouteInfo, input, output any)) Option {
+	return func(r *router) error {
+		r.afterCommit = append(r.afterCommit, hook)
+		return nil
+	}
+}
+
+// OnInput returns an Option that passes a pointer to the bound Input of the routes registered
+// after it to the hook before the handler is called, e.g. to inject defaults.
+func OnInput(hook func(ctx context.Context, input any) error) Option {
+	return func(r *router) error {
+		r.onInput = append(r.onInput, func(ctx context.Context, input reflect.Value) error {
+			return hook(ctx, input.Addr().Interface())
+		})
+		return nil
+	}
+}
+
+// OnInputField returns an Option that passes every Input field of type T of the routes
+// registered after it to the hook before the handler is called, e.g. to trim strings.
+func OnInputField[T any](hook func(ctx context.Context, v *T) error) Option {
+	t := reflect.TypeFor[T]()
+	return func(r *router) error {
+		r.onInput = append(r.onInput, func(ctx context.Context, input reflect.Value) error {
+			for i := 0; i < input.NumField(); i++ {
+				if input.Type().Field(i).Type != t {
+					continue
+				}
+				if err := hook(ctx, input.Field(i).Addr().Interface().(*T)); err != nil {
+					return fmt.Errorf("field %s: %w", input.Type().Field(i).Name, err)
+				}
+			}
+			return nil
+		})
+		return nil
+	}
+}
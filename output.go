@@ -0,0 +1,114 @@
+package route
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HeaderSetter is implemented by outputs that set response headers before they are encoded.
+// Alternatively output struct fields tagged route:"header=X-Total-Count" are written as that header
+// and left out of the encoded body. Zero values are omitted.
+type HeaderSetter interface {
+	SetHeader(header http.Header)
+}
+
+// Responder is implemented by outputs that write the response themselves instead of the response encoder.
+// Responders must not write a body for HEAD requests.
+type Responder interface {
+	Respond(w http.ResponseWriter, r *http.Request) error
+}
+
+// headResponseWriter discards the body the response encoder writes for HEAD requests.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Blob is an output type for binary data held in Data or streamed from Reader.
+// Size is the length of the Reader content, zero if unknown.
+// Without ContentType the content type is sniffed from the data.
+// Readers implementing io.Closer are closed after the response is written.
+type Blob struct {
+	Data        []byte
+	Reader      io.Reader
+	Size        int64
+	ContentType string
+}
+
+func (b Blob) Respond(w http.ResponseWriter, r *http.Request) error {
+	if closer, ok := b.Reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	header := w.Header()
+	contentType := b.ContentType
+	var body io.Reader
+	if b.Reader == nil {
+		if contentType == "" {
+			contentType = http.DetectContentType(b.Data)
+		}
+		header.Set("Content-Length", strconv.Itoa(len(b.Data)))
+	} else {
+		if contentType == "" {
+			buffered := bufio.NewReaderSize(b.Reader, 512)
+			sniff, _ := buffered.Peek(512)
+			contentType = http.DetectContentType(sniff)
+			body = buffered
+		}
+		if b.Size > 0 {
+			header.Set("Content-Length", strconv.FormatInt(b.Size, 10))
+		}
+	}
+	header.Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	if b.Reader == nil {
+		_, err := w.Write(b.Data)
+		return err
+	}
+	if body == nil {
+		body = b.Reader
+	}
+	_, err := io.Copy(w, body)
+	return err
+}
+
+// RangeReader is an output type for large objects read at random positions, e.g. from object storage.
+// Range requests are answered with 206 Partial Content, several ranges as multipart/byteranges,
+// and unsatisfiable ones with 416. Requests with an If-Range header not matching ETag or ModTime get
+// the whole content. Without ContentType the content type is sniffed from the data.
+// Readers implementing io.Closer are closed after the response is written.
+type RangeReader struct {
+	Reader      io.ReaderAt
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	ETag        string
+}
+
+func (rr RangeReader) Respond(w http.ResponseWriter, r *http.Request) error {
+	if closer, ok := rr.Reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if rr.ContentType != "" {
+		w.Header().Set("Content-Type", rr.ContentType)
+	}
+	if rr.ETag != "" {
+		w.Header().Set("ETag", rr.ETag)
+	}
+	http.ServeContent(w, r, "", rr.ModTime, io.NewSectionReader(rr.Reader, 0, rr.Size))
+	return nil
+}
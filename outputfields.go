@@ -0,0 +1,232 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response is an output giving handlers full control over the response: Status is sent instead of 200
+// unless it is zero, Headers are added to the response headers and Body is encoded by the response encoder.
+// Status has to be between 100 and 999. Output structs whose Body field is tagged route:"body" and that have
+// only Status, Headers or header tagged fields besides it are treated alike.
+type Response[T any] struct {
+	Status  int
+	Headers http.Header
+	Body    T
+}
+
+func (Response[T]) responseEnvelope() {}
+
+// responseEnvelope is implemented by Response.
+type responseEnvelope interface {
+	responseEnvelope()
+}
+
+// outputFields describes the fields of an output struct type that are not encoded as body.
+type outputFields struct {
+	headers []outputHeader
+	// status, header and body are the field indexes of a Response like output, body is -1 for other outputs.
+	status, header, body int
+	// stripped is the type of the encoded remainder of other outputs.
+	stripped       reflect.Type
+	strippedFields []int
+	// err reports header tagged fields that are not exported.
+	err error
+}
+
+type outputHeader struct {
+	index int
+	name  string
+}
+
+var (
+	outputFieldsCache    sync.Map
+	httpHeaderType       = reflect.TypeFor[http.Header]()
+	responseEnvelopeType = reflect.TypeFor[responseEnvelope]()
+)
+
+// outputFieldsOf returns the special fields of the output type, nil if it has none.
+// Fields tagged route:"header=Name" are written as header Name.
+func outputFieldsOf(t reflect.Type) *outputFields {
+	if cached, ok := outputFieldsCache.Load(t); ok {
+		return cached.(*outputFields)
+	}
+	var fields *outputFields
+	if t.Kind() == reflect.Struct {
+		fields = &outputFields{status: -1, header: -1, body: -1}
+		var stripped []reflect.StructField
+		envelope, explicit := true, t.Implements(responseEnvelopeType)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if name, ok := headerTag(field); ok {
+				if !field.IsExported() {
+					fields.err = fmt.Errorf("header field %s of %s is not exported", field.Name, t)
+					continue
+				}
+				fields.headers = append(fields.headers, outputHeader{index: i, name: name})
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			stripped = append(stripped, field)
+			fields.strippedFields = append(fields.strippedFields, i)
+			switch {
+			case field.Name == "Body":
+				fields.body = i
+				explicit = explicit || field.Tag.Get("route") == "body"
+			case field.Name == "Status" && field.Type.Kind() == reflect.Int:
+				fields.status = i
+			case field.Name == "Headers" && field.Type == httpHeaderType:
+				fields.header = i
+			default:
+				envelope = false
+			}
+		}
+		switch {
+		case fields.err != nil:
+		case envelope && explicit && fields.body >= 0:
+		case len(fields.headers) == 0:
+			fields = nil
+		default:
+			fields.body = -1
+			for i := range stripped {
+				stripped[i].Index, stripped[i].Offset = nil, 0
+			}
+			fields.stripped = reflect.StructOf(stripped)
+		}
+	}
+	outputFieldsCache.Store(t, fields)
+	return fields
+}
+
+// checkOutputFields reports output types with header fields that can not be written.
+func checkOutputFields(t reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if fields := outputFieldsOf(t); fields != nil {
+		return fields.err
+	}
+	return nil
+}
+
+// bodyType returns the type encoded for outputs of the type.
+func bodyType(t reflect.Type) reflect.Type {
+	elem := t
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	fields := outputFieldsOf(elem)
+	switch {
+	case fields == nil:
+		return t
+	case fields.body >= 0:
+		return elem.Field(fields.body).Type
+	default:
+		return fields.stripped
+	}
+}
+
+// headerTag returns the header name of a field tagged route:"header=Name".
+func headerTag(field reflect.StructField) (string, bool) {
+	kind, name, _ := strings.Cut(field.Tag.Get("route"), "=")
+	return name, kind == "header" && name != ""
+}
+
+// splitOutput writes the header fields of the output to the header and returns the remaining body
+// and the status code of Response like outputs, zero for others.
+func splitOutput(header http.Header, output any) (any, int, error) {
+	v := reflect.ValueOf(output)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() != reflect.Struct {
+		return output, 0, nil
+	}
+	fields := outputFieldsOf(v.Type())
+	if fields == nil {
+		return output, 0, nil
+	}
+	if fields.err != nil {
+		return nil, 0, fields.err
+	}
+	for _, h := range fields.headers {
+		for _, value := range headerValues(v.Field(h.index)) {
+			header.Add(h.name, value)
+		}
+	}
+	if fields.body >= 0 {
+		status := 0
+		if fields.status >= 0 {
+			status = int(v.Field(fields.status).Int())
+			if status != 0 && (status < 100 || status > 999) {
+				return nil, 0, fmt.Errorf("invalid response status %d", status)
+			}
+		}
+		if fields.header >= 0 {
+			for key, values := range v.Field(fields.header).Interface().(http.Header) {
+				for _, value := range values {
+					header.Add(key, value)
+				}
+			}
+		}
+		return v.Field(fields.body).Interface(), status, nil
+	}
+	body := reflect.New(fields.stripped).Elem()
+	for i, index := range fields.strippedFields {
+		body.Field(i).Set(v.Field(index))
+	}
+	return body.Interface(), 0, nil
+}
+
+// headerValues formats the value of a header field, zero values are omitted.
+func headerValues(v reflect.Value) []string {
+	if v.IsZero() {
+		return nil
+	}
+	switch value := v.Interface().(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case time.Time:
+		return []string{value.UTC().Format(http.TimeFormat)}
+	case fmt.Stringer:
+		return []string{value.String()}
+	}
+	if v.Kind() == reflect.Pointer {
+		return headerValues(v.Elem())
+	}
+	return []string{fmt.Sprint(v.Interface())}
+}
+
+// statusResponseWriter sends status instead of 200 once the response encoder writes.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader && status == http.StatusOK {
+		status = w.status
+	}
+	w.wroteHeader = w.wroteHeader || status >= http.StatusOK
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(w.status)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,183 @@
+package route
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Pagination is an input type bound from the page, per_page and cursor query parameters.
+// Bind it with ByType(PaginationQuery(defaultPerPage, maxPerPage)).
+type Pagination struct {
+	Page    int
+	PerPage int
+	Cursor  string
+
+	url *url.URL
+}
+
+// Offset returns the number of items before the requested page.
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// PaginationQuery returns a FieldOption that binds Pagination from the query parameters.
+// The page defaults to 1 and the page size to defaultPerPage; page sizes above maxPerPage are capped.
+func PaginationQuery(defaultPerPage, maxPerPage int) FieldOption[*Pagination] {
+	return RequestValue(func(r *http.Request, p *Pagination) error {
+		query := r.URL.Query()
+		page, err := queryInt(query, "page", 1)
+		if err != nil {
+			return err
+		}
+		perPage, err := queryInt(query, "per_page", defaultPerPage)
+		if err != nil {
+			return err
+		}
+		u := *r.URL
+		u.RawPath = prefixed(r.Context(), r.URL.EscapedPath())
+		if u.Path, err = url.PathUnescape(u.RawPath); err != nil {
+			return err
+		}
+		*p = Pagination{
+			Page:    page,
+			PerPage: min(perPage, maxPerPage),
+			Cursor:  query.Get("cursor"),
+			url:     &u,
+		}
+		return nil
+	})
+}
+
+func queryInt(query url.Values, name string, fallback int) (int, error) {
+	s := query.Get(name)
+	if s == "" {
+		return fallback, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 1 {
+		return 0, WithStatus(http.StatusBadRequest, Messagef("query parameter %s must be a positive integer", name))
+	}
+	return i, nil
+}
+
+// Page is an output type for a page of a collection.
+// It sets Link headers (RFC 5988) to the neighbouring pages.
+// Offset based pages also get a last link and an X-Total-Count header,
+// cursor based pages link the next page if NextCursor is set.
+type Page[T any] struct {
+	Items      []T
+	Total      int    `json:",omitempty"`
+	NextCursor string `json:",omitempty"`
+
+	Pagination Pagination `json:"-"`
+}
+
+func (p Page[T]) SetHeader(header http.Header) {
+	pagination := p.Pagination
+	if pagination.url == nil || pagination.PerPage < 1 {
+		return
+	}
+
+	var links []string
+	link := func(rel string, set map[string]string) {
+		u := *pagination.url
+		query := u.Query()
+		for k, v := range set {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel))
+	}
+	perPage := strconv.Itoa(pagination.PerPage)
+
+	if pagination.Cursor != "" || p.NextCursor != "" {
+		if p.NextCursor != "" {
+			link("next", map[string]string{"cursor": p.NextCursor, "per_page": perPage})
+		}
+	} else {
+		last := max(1, (p.Total+pagination.PerPage-1)/pagination.PerPage)
+		page := func(n int) map[string]string {
+			return map[string]string{"page": strconv.Itoa(n), "per_page": perPage}
+		}
+		link("first", page(1))
+		if pagination.Page > 1 {
+			link("prev", page(min(pagination.Page-1, last)))
+		}
+		if pagination.Page < last {
+			link("next", page(pagination.Page+1))
+		}
+		link("last", page(last))
+		header.Set("X-Total-Count", strconv.Itoa(p.Total))
+	}
+	if len(links) > 0 {
+		header.Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// Cursor is the payload of an opaque pagination cursor, e.g. the sort key of the last item.
+// Clients see it base64url encoded and signed, so they can't forge or alter cursors.
+type Cursor []byte
+
+const cursorMACSize = 16
+
+// Encode returns the cursor signed with key and base64url encoded, e.g. for Page.NextCursor.
+func (c Cursor) Encode(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(append(slices.Clip(c), cursorMAC(key, c)...))
+}
+
+// DecodeCursor returns the cursor encoded by Cursor.Encode with the same key.
+func DecodeCursor(key []byte, s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) < cursorMACSize {
+		return nil, Messagef("malformed cursor")
+	}
+	payload, mac := b[:len(b)-cursorMACSize], b[len(b)-cursorMACSize:]
+	if !hmac.Equal(mac, cursorMAC(key, payload)) {
+		return nil, Messagef("invalid cursor signature")
+	}
+	return Cursor(payload), nil
+}
+
+func cursorMAC(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)[:cursorMACSize]
+}
+
+// CursorQuery returns a FieldOption that binds a Cursor from the query parameter, nil if it is missing.
+// Malformed or forged cursors are rejected with 400.
+func CursorQuery(key []byte, name string) FieldOption[*Cursor] {
+	return RequestValue(func(r *http.Request, v *Cursor) error {
+		s := r.URL.Query().Get(name)
+		if s == "" {
+			*v = nil
+			return nil
+		}
+		cursor, err := DecodeCursor(key, s)
+		if err != nil {
+			return WithStatus(http.StatusBadRequest, err)
+		}
+		*v = cursor
+		return nil
+	})
+}
+
+// CursorPathIDs returns a FieldOption that enables the route to route cursors.
+// Malformed or forged cursors are rejected with 400.
+func CursorPathIDs(key []byte) FieldOption[*Cursor] {
+	return PathID(func(id string, v *Cursor) error {
+		cursor, err := DecodeCursor(key, id)
+		if err != nil {
+			return WithStatus(http.StatusBadRequest, err)
+		}
+		*v = cursor
+		return nil
+	})
+}
@@ -0,0 +1,36 @@
+package route
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Parallel returns a FieldOption that binds the field with opts concurrently to the other fields of the
+// request, e.g. a slow auth or tenant lookup while the body is decoded, shrinking the binding latency to
+// the slowest field. Parallel fields must not depend on other fields or read the request body and
+// can not add path segments. The handler runs once all fields are bound.
+func Parallel[T any](opts ...FieldOption[T]) FieldOption[T] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[T], error) {
+		segments := len(route.segments)
+		mod, err := combinedFieldModifier(opts, route, name, field)
+		if err != nil {
+			return nil, err
+		}
+		if len(route.segments) != segments {
+			return nil, errors.New("parallel fields can not add path segments")
+		}
+		if route.parallel == nil {
+			route.parallel = map[string]bool{}
+		}
+		route.parallel[name] = true
+		return func(r *request, v T) (func(error) error, error) {
+			return mod(r, v)
+		}, nil
+	}
+}
+
+// parallelField is the result of binding a parallel field.
+type parallelField struct {
+	close func(error) error
+	err   error
+}
@@ -0,0 +1,77 @@
+package route
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// StripPrefix returns an Option that removes prefix from request paths before they are matched,
+// e.g. for a router deployed behind an ingress that forwards /api/users as is. Requests outside
+// prefix are not found. Like NormalizePath it applies to the whole router regardless of its position,
+// several path rewrites apply in the order they were added.
+func StripPrefix(prefix string) Option {
+	prefix = "/" + strings.Trim(prefix, "/")
+	return func(r *router) error {
+		r.rewrites = append(r.rewrites, func(path string) (string, string, bool) {
+			if path == prefix {
+				return "/", prefix, true
+			}
+			rest, ok := strings.CutPrefix(path, prefix+"/")
+			return "/" + rest, prefix, ok
+		})
+		return nil
+	}
+}
+
+// RewritePath returns an Option that rewrites request paths with rewrite before they are matched.
+// Rewrite receives and returns the escaped path. Like StripPrefix it applies to the whole router.
+func RewritePath(rewrite func(path string) string) Option {
+	return func(r *router) error {
+		r.rewrites = append(r.rewrites, func(path string) (string, string, bool) {
+			return rewrite(path), "", true
+		})
+		return nil
+	}
+}
+
+// rewritePath returns the request with the path rewrites applied. Paths outside a stripped prefix are not found.
+// The stripped prefixes are kept in the context for prefixed.
+func (r *router) rewritePath(req *http.Request) (*http.Request, error) {
+	if len(r.rewrites) == 0 {
+		return req, nil
+	}
+	path := req.URL.EscapedPath()
+	var prefix string
+	for _, rewrite := range r.rewrites {
+		var stripped string
+		var ok bool
+		if path, stripped, ok = rewrite(path); !ok {
+			return nil, WithStatus(http.StatusNotFound, Messagef("not found"))
+		}
+		prefix += stripped
+	}
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		return nil, WithStatus(http.StatusBadRequest, err)
+	}
+	u := *req.URL
+	u.Path, u.RawPath = unescaped, path
+	ctx := req.Context()
+	if prefix != "" {
+		ctx = context.WithValue(ctx, prefixKey{}, prefix)
+	}
+	rewritten := req.Clone(ctx)
+	rewritten.URL = &u
+	return rewritten, nil
+}
+
+type prefixKey struct{}
+
+// prefixed returns path with the prefixes StripPrefix removed from the request path in front,
+// so Locations built from patterns point at the path the client sees.
+func prefixed(ctx context.Context, path string) string {
+	prefix, _ := ctx.Value(prefixKey{}).(string)
+	return prefix + path
+}
@@ -0,0 +1,38 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// RESTDefaults returns an Option bundling the options most JSON APIs start with:
+//   - JSON responses and RFC 9457 problem details for errors
+//   - request bodies limited to 1 MiB and decoded as JSON into fields named Body, malformed ones rejected with 400
+//   - fields named Query bound from the query parameters with QueryStruct
+//   - Fixed fields matching their lowercase name, int and string path IDs
+//   - Pagination bound with 20 items per page and at most 100
+//
+// Options given after it override single settings.
+func RESTDefaults() Option {
+	return Join(
+		JSONResponse(),
+		ProblemDetails(),
+		MaxBodySize(1<<20),
+		ByName("Body", Body(func(r io.Reader, v any) error {
+			err := json.NewDecoder(r).Decode(v)
+			var maxBytesErr *http.MaxBytesError
+			if err != nil && !errors.As(err, &maxBytesErr) {
+				return WithStatus(http.StatusBadRequest, err)
+			}
+			return err
+		})),
+		ByName("Query", QueryStruct()),
+		PathByNameOfFixedTyped(strings.ToLower),
+		ByType(IntPathIDs()),
+		ByType(StringPathIDs()),
+		ByType(PaginationQuery(20, 100)),
+	)
+}
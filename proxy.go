@@ -0,0 +1,60 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// Proxy returns an Option that forwards all requests below prefix to the upstream target,
+// e.g. to migrate an API from a legacy service path by path.
+// The rewrites are applied in order to the request path before it is appended to the target path.
+// Proxied routes get the middleware and per route behavior of the options before.
+func Proxy(prefix string, target *url.URL, rewrites ...func(path string) string) Option {
+	return func(r *router) error {
+		cfg := r.config
+		proxy := &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				path := pr.In.URL.Path
+				for _, rewrite := range rewrites {
+					path = rewrite(path)
+				}
+				pr.Out.URL.Path = path
+				pr.Out.URL.RawPath = ""
+				pr.SetURL(target)
+				pr.SetXForwarded()
+			},
+			ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+				cfg.HandleErr(req.Context(), w, WithStatus(http.StatusBadGateway, fmt.Errorf("proxying to %s: %w", target.Host, err)))
+			},
+		}
+		r.mount(prefix, proxy, "proxy to "+target.String())
+		return nil
+	}
+}
+
+// Mount returns an Option that hands all requests below prefix to the handler as an opaque subtree,
+// e.g. an existing http.ServeMux, chi or gorilla router while migrating to declarative routes path by path.
+// The request path is passed on unchanged, wrap the handler with http.StripPrefix if it expects relative paths.
+// Routes registered below prefix take precedence over the mounted handler.
+func Mount(prefix string, handler http.Handler) Option {
+	return func(r *router) error {
+		r.mount(prefix, handler, fmt.Sprintf("%T", handler))
+		return nil
+	}
+}
+
+// mount registers handler for all methods at prefix and all paths below it.
+func (r *router) mount(prefix string, handler http.Handler, name string) {
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		route := r.fixedRoute(method, prefix)
+		route.allowRemainder = true
+		r.register(route.node, RouteInfo{
+			Method:  method,
+			Pattern: strings.TrimSuffix(route.pattern(), "/") + "/{path...}",
+			Handler: name,
+		}, handler)
+	}
+}
@@ -0,0 +1,153 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/generikvault/route/getter"
+)
+
+// CanonicalQuery returns an Option that lets canonicalize rewrite the query parameters of
+// every request before they are bound, e.g. with FirstQueryValueWins, LastQueryValueWins or
+// RejectDuplicateQueryParams. Errors are reported with 400 unless they carry a status.
+// Like NormalizePath it applies to the whole router regardless of its position.
+func CanonicalQuery(canonicalize func(url.Values) error) Option {
+	return func(r *router) error {
+		r.canonicalQuery = canonicalize
+		return nil
+	}
+}
+
+// FirstQueryValueWins keeps only the first value of repeated query parameters except for the multi valued ones.
+func FirstQueryValueWins(multi ...string) func(url.Values) error {
+	return func(query url.Values) error {
+		for key, values := range query {
+			if len(values) > 1 && !slices.Contains(multi, key) {
+				query[key] = values[:1]
+			}
+		}
+		return nil
+	}
+}
+
+// LastQueryValueWins keeps only the last value of repeated query parameters except for the multi valued ones.
+func LastQueryValueWins(multi ...string) func(url.Values) error {
+	return func(query url.Values) error {
+		for key, values := range query {
+			if len(values) > 1 && !slices.Contains(multi, key) {
+				query[key] = values[len(values)-1:]
+			}
+		}
+		return nil
+	}
+}
+
+// RejectDuplicateQueryParams rejects repeated query parameters except for the multi valued ones.
+func RejectDuplicateQueryParams(multi ...string) func(url.Values) error {
+	return func(query url.Values) error {
+		for key, values := range query {
+			if len(values) > 1 && !slices.Contains(multi, key) {
+				return Messagef("query parameter %q is given %d times", key, len(values))
+			}
+		}
+		return nil
+	}
+}
+
+// canonicalizeQuery returns the request with its query rewritten by the CanonicalQuery hook.
+func (r *router) canonicalizeQuery(req *http.Request) (*http.Request, error) {
+	if r.canonicalQuery == nil {
+		return req, nil
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, WithStatus(http.StatusBadRequest, err)
+	}
+	if err := r.canonicalQuery(query); err != nil {
+		var status *StatusError
+		if !errors.As(err, &status) {
+			err = WithStatus(http.StatusBadRequest, err)
+		}
+		return nil, err
+	}
+
+	u := *req.URL
+	u.RawQuery = query.Encode()
+	canonical := new(http.Request)
+	*canonical = *req
+	canonical.URL = &u
+	return canonical, nil
+}
+
+// QueryStruct returns a FieldOption that binds the fields of a struct from the query parameters
+// as getter.IntoStruct does. Malformed values are rejected with 400.
+func QueryStruct() FieldOption[any] {
+	return RequestValue(func(r *http.Request, v any) error {
+		return WithStatus(http.StatusBadRequest, getter.IntoStruct(r, v))
+	})
+}
+
+// SortField is a field to sort by.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Sort is an input type bound from the sort query parameter, e.g. ?sort=-created_at,name
+// sorts descending by created_at and then ascending by name.
+type Sort []SortField
+
+// SortQuery returns a FieldOption that binds Sort from the sort query parameter.
+// Sorting by fields that are not allowed is rejected with 400.
+func SortQuery(allowed ...string) FieldOption[*Sort] {
+	return RequestValue(func(r *http.Request, v *Sort) error {
+		param := r.URL.Query().Get("sort")
+		if param == "" {
+			*v = nil
+			return nil
+		}
+		var sort Sort
+		for _, field := range strings.Split(param, ",") {
+			field, desc := strings.CutPrefix(strings.TrimSpace(field), "-")
+			if !slices.Contains(allowed, field) {
+				return WithStatus(http.StatusBadRequest, Messagef("can not sort by %q, allowed are %s", field, strings.Join(allowed, ", ")))
+			}
+			sort = append(sort, SortField{Field: field, Desc: desc})
+		}
+		*v = sort
+		return nil
+	})
+}
+
+// Filter is an input type bound from filter query parameters, e.g. ?filter[status]=open.
+type Filter map[string]string
+
+// FilterQuery returns a FieldOption that binds Filter from the filter[field] query parameters.
+// Filtering by fields that are not allowed or by the same field twice is rejected with 400.
+func FilterQuery(allowed ...string) FieldOption[*Filter] {
+	return RequestValue(func(r *http.Request, v *Filter) error {
+		filter := Filter{}
+		for key, values := range r.URL.Query() {
+			field, ok := strings.CutPrefix(key, "filter[")
+			if !ok {
+				continue
+			}
+			field, ok = strings.CutSuffix(field, "]")
+			if !ok {
+				return WithStatus(http.StatusBadRequest, Messagef("malformed filter parameter %q", key))
+			}
+			if !slices.Contains(allowed, field) {
+				return WithStatus(http.StatusBadRequest, Messagef("can not filter by %q, allowed are %s", field, strings.Join(allowed, ", ")))
+			}
+			if len(values) > 1 {
+				return WithStatus(http.StatusBadRequest, Messagef("filter %q is given %d times", field, len(values)))
+			}
+			filter[field] = values[0]
+		}
+		*v = filter
+		return nil
+	})
+}
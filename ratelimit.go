@@ -0,0 +1,98 @@
+package route
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit returns an Option that limits the requests to each route registered after it to rate
+// per second and key, allowing bursts of up to burst requests. Further requests are rejected with 429
+// and Retry-After. Requests are keyed by key, e.g. an API key, or by their client address if key is nil,
+// which takes TrustedProxies into account.
+func RateLimit(rate float64, burst int, key func(*http.Request) string) Option {
+	return func(r *router) error {
+		if rate <= 0 || burst < 1 {
+			return fmt.Errorf("rate limit of %v per second with bursts of %d lets no request through", rate, burst)
+		}
+		r.rateLimit = &rateLimit{rate: rate, burst: float64(burst), key: key}
+		return nil
+	}
+}
+
+type rateLimit struct {
+	rate  float64
+	burst float64
+	key   func(*http.Request) string
+}
+
+func (l *rateLimit) wrap(cfg *config, info RouteInfo, handler http.Handler) http.Handler {
+	limiter := stateOf(cfg.state, routeKey("rate limit", info, l.rate, l.burst), func() *rateLimiter {
+		return &rateLimiter{rateLimit: l, buckets: map[string]*tokenBucket{}}
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var key string
+		if l.key != nil {
+			key = l.key(r)
+		} else {
+			key = cfg.clientIP(r).String()
+		}
+		if wait, ok := limiter.take(key, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			cfg.HandleErr(r.Context(), w, WithStatus(http.StatusTooManyRequests, Messagef("rate limit exceeded")))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// rateLimiter holds the token buckets of the keys of a route.
+type rateLimiter struct {
+	*rateLimit
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	sweepAt int
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take takes a token of the key's bucket, otherwise it reports how long until the next token.
+func (l *rateLimiter) take(key string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		l.sweep(now)
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second)), false
+	}
+	bucket.tokens--
+	return 0, true
+}
+
+// sweep drops the buckets that refilled, they are no different from new ones.
+// It runs whenever the buckets doubled since the last sweep.
+func (l *rateLimiter) sweep(now time.Time) {
+	if len(l.buckets) < l.sweepAt {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.sweepAt = max(64, 2*len(l.buckets))
+}
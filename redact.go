@@ -0,0 +1,179 @@
+package route
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// RedactScopes returns an Option that omits output struct fields tagged with scope, e.g. `scope:"admin"`,
+// from the response unless the scopes of the request's principal include one of the comma separated tag values.
+// Nested structs, pointers, slices, arrays and maps are redacted too, values behind interfaces and types
+// implementing json.Marshaler are not inspected. It wraps the response encoder set before it.
+func RedactScopes(scopes func(*http.Request) []string) Option {
+	return func(r *router) error {
+		encoder := r.responseEncoder
+		if encoder == nil {
+			return errors.New("RedactScopes requires a response encoder")
+		}
+		r.responseEncoder = func(ctx context.Context, w http.ResponseWriter, v any) error {
+			if v == nil || !hasScopes(reflect.TypeOf(v)) {
+				return encoder(ctx, w, v)
+			}
+			var granted []string
+			if ex, ok := exchangeFrom(ctx); ok {
+				granted = scopes(ex.request)
+			}
+			redacted, err := redact(v, granted)
+			if err != nil {
+				return err
+			}
+			return encoder(ctx, w, redacted)
+		}
+		return nil
+	}
+}
+
+// redact returns a copy of v in a type without the fields whose scopes are not granted.
+func redact(v any, granted []string) (any, error) {
+	value := reflect.ValueOf(v)
+	to, err := redactType(value.Type(), granted, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return convertRedacted(value, to).Interface(), nil
+}
+
+var scopedTypes sync.Map
+
+// hasScopes reports whether the type contains fields tagged with scope.
+func hasScopes(t reflect.Type) bool {
+	if scoped, ok := scopedTypes.Load(t); ok {
+		return scoped.(bool)
+	}
+	scoped := hasScopesVisiting(t, map[reflect.Type]bool{})
+	scopedTypes.Store(t, scoped)
+	return scoped
+}
+
+func hasScopesVisiting(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] || t.Implements(reflect.TypeFor[json.Marshaler]()) {
+		return false
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return hasScopesVisiting(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.IsExported() && (field.Tag.Get("scope") != "" || hasScopesVisiting(field.Type, visiting)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redactType returns the type without the fields whose scopes are not granted.
+func redactType(t reflect.Type, granted []string, visiting map[reflect.Type]bool) (reflect.Type, error) {
+	if !hasScopes(t) {
+		return t, nil
+	}
+	if visiting[t] {
+		return nil, fmt.Errorf("recursive type %s cannot be redacted", t)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		elem, err := redactType(t.Elem(), granted, visiting)
+		if err != nil {
+			return nil, err
+		}
+		switch t.Kind() {
+		case reflect.Pointer:
+			return reflect.PointerTo(elem), nil
+		case reflect.Slice:
+			return reflect.SliceOf(elem), nil
+		case reflect.Array:
+			return reflect.ArrayOf(t.Len(), elem), nil
+		default:
+			return reflect.MapOf(t.Key(), elem), nil
+		}
+	}
+
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if scope := field.Tag.Get("scope"); scope != "" && !slices.ContainsFunc(strings.Split(scope, ","), func(s string) bool {
+			return slices.Contains(granted, strings.TrimSpace(s))
+		}) {
+			continue
+		}
+		redacted, err := redactType(field.Type, granted, visiting)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, reflect.StructField{Name: field.Name, Type: redacted, Tag: field.Tag, Anonymous: field.Anonymous})
+	}
+	return reflect.StructOf(fields), nil
+}
+
+// convertRedacted copies the value into the redacted type.
+func convertRedacted(v reflect.Value, to reflect.Type) reflect.Value {
+	if v.Type() == to {
+		return v
+	}
+	switch to.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return reflect.Zero(to)
+		}
+		p := reflect.New(to.Elem())
+		p.Elem().Set(convertRedacted(v.Elem(), to.Elem()))
+		return p
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(to)
+		}
+		s := reflect.MakeSlice(to, v.Len(), v.Len())
+		for i := range v.Len() {
+			s.Index(i).Set(convertRedacted(v.Index(i), to.Elem()))
+		}
+		return s
+	case reflect.Array:
+		a := reflect.New(to).Elem()
+		for i := range v.Len() {
+			a.Index(i).Set(convertRedacted(v.Index(i), to.Elem()))
+		}
+		return a
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(to)
+		}
+		m := reflect.MakeMapWithSize(to, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			m.SetMapIndex(iter.Key(), convertRedacted(iter.Value(), to.Elem()))
+		}
+		return m
+	}
+	s := reflect.New(to).Elem()
+	for i := range to.NumField() {
+		field := to.Field(i)
+		original, _ := v.Type().FieldByName(field.Name)
+		s.Field(i).Set(convertRedacted(v.FieldByIndex(original.Index), field.Type))
+	}
+	return s
+}
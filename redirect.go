@@ -0,0 +1,122 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Redirects returns an Option that answers requests to moved endpoints with a redirect of status,
+// e.g. Redirects(map[string]string{"/users/{id}": "/accounts/{id}"}, http.StatusPermanentRedirect).
+// Keys are the old route patterns and values the new ones. The Location is built with Reverse from
+// the path values of the old pattern by variable name and keeps the query string.
+// Use 308 to keep the method and body of non GET requests, clients may turn them into GET on 301.
+// The old patterns must not be routed otherwise.
+func Redirects(moved map[string]string, status int) Option {
+	return func(r *router) error {
+		if status < 300 || status > 399 {
+			return fmt.Errorf("redirect status %d is not a 3xx status", status)
+		}
+		var errs []error
+		for _, from := range slices.Sorted(maps.Keys(moved)) {
+			if err := r.redirect(from, moved[from], status); err != nil {
+				errs = append(errs, fmt.Errorf("redirect %s: %w", from, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// redirect registers the redirect from the old to the new pattern for all methods.
+func (r *router) redirect(from, to string, status int) error {
+	cfg := r.config
+	names := patternVars(from)
+	positions := map[string]int{}
+	remainder := ""
+	for i, segment := range strings.Split(strings.Trim(from, "/"), "/") {
+		if !strings.HasPrefix(segment, "{") {
+			continue
+		}
+		name := strings.Trim(segment, "{}")
+		if rest, ok := strings.CutSuffix(name, "..."); ok {
+			if i != strings.Count(strings.Trim(from, "/"), "/") {
+				return fmt.Errorf("variable %s must be the last segment", segment)
+			}
+			remainder = rest
+			name = rest
+		}
+		positions[name] = i
+	}
+	var order []string
+	for _, name := range patternVars(to) {
+		if _, ok := positions[name]; !ok {
+			return fmt.Errorf("variable %s of %s is not part of the old pattern", name, to)
+		}
+		order = append(order, name)
+	}
+	if len(names) != len(positions) {
+		return errors.New("duplicate variable names")
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		route := route{node: r.tree(method), method: method}
+		for _, segment := range strings.Split(strings.Trim(from, "/"), "/") {
+			switch {
+			case segment == "":
+			case strings.HasSuffix(segment, "...}"):
+				route.allowRemainder = true
+				route.segments = append(route.segments, segment)
+			case strings.HasPrefix(segment, "{"):
+				route.addVarToPath(strings.Trim(segment, "{}"))
+			default:
+				route.addFixedToPath(strings.ToLower(segment))
+			}
+		}
+		if route.handler != nil {
+			return fmt.Errorf("%s %s is already routed", method, route.pattern())
+		}
+		r.register(route.node, RouteInfo{
+			Method:  method,
+			Pattern: route.pattern(),
+			Handler: "redirect to " + to,
+		}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			path, err := splitPath(req.URL, false)
+			if err != nil {
+				cfg.HandleErr(req.Context(), w, WithStatus(http.StatusBadRequest, err))
+				return
+			}
+			values := make([]any, len(order))
+			for i, name := range order {
+				if name == remainder {
+					values[i] = strings.Join(path[positions[name]:], "/")
+					continue
+				}
+				values[i] = path[positions[name]]
+			}
+			location, err := Reverse(to, values...)
+			if err != nil {
+				cfg.HandleErr(req.Context(), w, err)
+				return
+			}
+			if req.URL.RawQuery != "" {
+				location += "?" + req.URL.RawQuery
+			}
+			http.Redirect(w, req, prefixed(req.Context(), location), status)
+		}))
+	}
+	return nil
+}
+
+// patternVars returns the names of the variable segments of a route pattern in order.
+func patternVars(pattern string) []string {
+	var names []string
+	for _, segment := range strings.Split(strings.Trim(pattern, "/"), "/") {
+		if strings.HasPrefix(segment, "{") {
+			names = append(names, strings.TrimSuffix(strings.Trim(segment, "{}"), "..."))
+		}
+	}
+	return names
+}
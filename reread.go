@@ -0,0 +1,59 @@
+package route
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// RereadableBody returns an Option that buffers request bodies of up to max bytes of the routes registered
+// after it, so every FieldOption reads the whole body independently, e.g. one verifying its signature
+// and one decoding it as JSON. Larger bodies are passed through unbuffered and can only be read once.
+func RereadableBody(max int64) Option {
+	return Middleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+			buffered, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+			switch {
+			case err != nil:
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(buffered), errReader{err}), r.Body}
+			case int64(len(buffered)) > max:
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(buffered), r.Body), r.Body}
+			default:
+				_ = r.Body.Close()
+				r.Body = &rereadableBody{Reader: bytes.NewReader(buffered)}
+				r.GetBody = func() (io.ReadCloser, error) {
+					return io.NopCloser(bytes.NewReader(buffered)), nil
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+}
+
+// rereadableBody is a buffered request body that is rewound before each field is bound.
+type rereadableBody struct {
+	*bytes.Reader
+}
+
+func (b *rereadableBody) Close() error {
+	return nil
+}
+
+// rewind rewinds the body if it is rereadable.
+func rewind(body io.Reader) {
+	if b, ok := body.(*rereadableBody); ok {
+		_, _ = b.Seek(0, io.SeekStart)
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
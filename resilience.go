@@ -0,0 +1,211 @@
+package route
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bulkhead returns an Option that limits each route registered after it to n concurrent requests,
+// so a slow dependency can't exhaust the server. It is MaxConcurrent(n, 0, 0): further requests are
+// rejected with 429 and Retry-After right away. It replaces a MaxConcurrent set before and vice versa.
+func Bulkhead(n int) Option {
+	return MaxConcurrent(n, 0, 0)
+}
+
+// MaxConcurrent returns an Option that limits each route registered after it to n concurrent requests,
+// e.g. for heavy report generation. Up to queue further requests wait at most timeout for a slot,
+// the rest and those timing out are rejected with 429 and Retry-After.
+// Requests to PriorityBatch routes do not queue, they are rejected right away while all slots are taken.
+func MaxConcurrent(n, queue int, timeout time.Duration) Option {
+	return func(r *router) error {
+		r.concurrency = &concurrencyLimit{n: n, queue: int64(queue), timeout: timeout}
+		return nil
+	}
+}
+
+type concurrencyLimit struct {
+	n       int
+	queue   int64
+	timeout time.Duration
+}
+
+// concurrencySlots are the slots of a route and the number of requests queued for them.
+type concurrencySlots struct {
+	slots  chan struct{}
+	queued atomic.Int64
+}
+
+func (l concurrencyLimit) wrap(cfg *config, info RouteInfo, handler http.Handler) http.Handler {
+	if cfg.priority == PriorityBatch {
+		l.queue = 0
+	}
+	state := stateOf(cfg.state, routeKey("concurrency", info, l.n), func() *concurrencySlots {
+		return &concurrencySlots{slots: make(chan struct{}, l.n)}
+	})
+	slots, queued := state.slots, &state.queued
+	reject := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		cfg.HandleErr(r.Context(), w, WithStatus(http.StatusTooManyRequests, Messagef("too many concurrent requests")))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			if queued.Add(1) > l.queue {
+				queued.Add(-1)
+				reject(w, r)
+				return
+			}
+			timer := time.NewTimer(l.timeout)
+			select {
+			case slots <- struct{}{}:
+				timer.Stop()
+				queued.Add(-1)
+			case <-timer.C:
+				queued.Add(-1)
+				reject(w, r)
+				return
+			case <-r.Context().Done():
+				timer.Stop()
+				queued.Add(-1)
+				cfg.HandleErr(r.Context(), w, WithStatus(http.StatusServiceUnavailable, r.Context().Err()))
+				return
+			}
+		}
+		defer func() { <-slots }()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// CircuitBreaker returns an Option that gives each route registered after it a circuit breaker.
+// The breaker opens once at least minRequests requests within window have been answered
+// and the share of 5xx responses among them reaches threshold, e.g. 0.5.
+// While open, requests are rejected with 503 and Retry-After. After cooldown a single probe request
+// is let through; it closes the breaker if it succeeds and opens it again otherwise.
+func CircuitBreaker(threshold float64, minRequests int, window, cooldown time.Duration) Option {
+	return func(r *router) error {
+		r.breaker = &breakerSettings{
+			threshold:   threshold,
+			minRequests: minRequests,
+			window:      window,
+			cooldown:    cooldown,
+		}
+		return nil
+	}
+}
+
+type breakerSettings struct {
+	threshold   float64
+	minRequests int
+	window      time.Duration
+	cooldown    time.Duration
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type circuitBreaker struct {
+	breakerSettings
+
+	mu          sync.Mutex
+	state       breakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openUntil   time.Time
+}
+
+func newCircuitBreaker(settings breakerSettings) *circuitBreaker {
+	return &circuitBreaker{breakerSettings: settings}
+}
+
+func (b *circuitBreaker) wrap(cfg *config, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		retryAfter, probe, ok := b.allow()
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			cfg.HandleErr(r.Context(), w, WithStatus(http.StatusServiceUnavailable, Messagef("circuit breaker open")))
+			return
+		}
+		failed := true
+		defer func() {
+			b.record(failed, probe)
+		}()
+		sw := &statusWriter{ResponseWriter: w}
+		handler.ServeHTTP(sw, r)
+		failed = sw.Status() >= http.StatusInternalServerError
+	})
+}
+
+// allow reports whether a request may pass and whether it is the probe of a half-open breaker,
+// otherwise how long the breaker stays open.
+func (b *circuitBreaker) allow() (retryAfter time.Duration, probe, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if wait := time.Until(b.openUntil); wait > 0 {
+			return wait, false, false
+		}
+		b.state = breakerHalfOpen
+		return 0, true, true
+	case breakerHalfOpen:
+		// a probe is in flight
+		return b.cooldown, false, false
+	default:
+		return 0, false, true
+	}
+}
+
+func (b *circuitBreaker) record(failed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if probe {
+		if failed {
+			b.open(now)
+			return
+		}
+		b.state = breakerClosed
+		b.reset(now)
+		return
+	}
+	if b.state != breakerClosed {
+		// the request was let through before the breaker opened
+		return
+	}
+
+	if now.Sub(b.windowStart) > b.window {
+		b.reset(now)
+	}
+	b.requests++
+	if failed {
+		b.failures++
+	}
+	if b.requests >= b.minRequests && float64(b.failures)/float64(b.requests) >= b.threshold {
+		b.open(now)
+	}
+}
+
+func (b *circuitBreaker) open(now time.Time) {
+	b.state = breakerOpen
+	b.openUntil = now.Add(b.cooldown)
+	b.reset(now)
+}
+
+func (b *circuitBreaker) reset(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+}
@@ -2,105 +2,213 @@ package route
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"reflect"
+	"slices"
 	"strings"
+	"sync"
 )
 
 func New(opts ...Option) (http.HandlerFunc, error) {
-	router := router{}
-	for _, opt := range opts {
-		if err := opt(&router); err != nil {
-			return nil, err
-		}
+	router, err := newRouter(opts...)
+	if err != nil {
+		return nil, err
 	}
-	return func(w http.ResponseWriter, r *http.Request) {
-		path, err := splitPath(r.URL)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+	return router.ServeHTTP, nil
+}
 
-		handler, ok := router.Node(r.Method).Handler(path)
-		if !ok {
-			http.Error(w, "not found", http.StatusNotFound)
-			return
-		}
-		handler.ServeHTTP(w, r)
-	}, nil
+// newRouter applies all options and reports the errors of every failing one,
+// so all setup mistakes can be fixed at once.
+func newRouter(opts ...Option) (*router, error) {
+	router := &router{}
+	router.root = &router.config
+	if err := Join(opts...)(router); err != nil {
+		return nil, err
+	}
+	return router, nil
 }
 
-func routeHandler[Input, Output any](router *router, node *node, handler func(context.Context, Input) (Output, error)) error {
+func routeHandler[Input, Output any](router *router, method string, node *node, handler func(context.Context, Input) (Output, error)) error {
 	input := typeOf[Input]()
+	cfg := router.config
+	cfg.live = router.root
+	call := intercepted(&cfg, handler)
 
 	route := route{
 		node:   node,
+		method: method,
+		config: &cfg,
 		fields: make([]fieldModifier[any], input.NumField()),
+		names:  make([]string, input.NumField()),
 	}
 
+	var errs []error
+	var providers []string
 	for i := 0; i < input.NumField(); i++ {
 		field := input.Field(i)
 		if !field.IsExported() {
-			return fmt.Errorf("field %s is not exported", field.Name)
+			errs = append(errs, fmt.Errorf("%s %s: field %s is not exported", method, route.pattern(), field.Name))
+			continue
 		}
-		if option, ok := router.routeOption(field); ok {
+		if option, key, ok := router.routeOption(field); ok {
+			if !slices.Contains(providers, key) {
+				providers = append(providers, key)
+			}
 			option, err := option(&route, field.Name, field.Type)
 			if err != nil {
-				return err
+				errs = append(errs, fmt.Errorf("%s %s: field %s: %w", method, route.pattern(), field.Name, err))
+				continue
 			}
 			route.fields[i] = option
+			route.names[i] = field.Name
 			continue
 		}
 
-		return fmt.Errorf("no option for field %s type %s", field.Name, field.Type)
+		errs = append(errs, router.missingOption(&route, field))
+	}
+	if cfg.tenancy != nil {
+		if err := cfg.tenancy.check(route.pattern()); err != nil {
+			errs = append(errs, fmt.Errorf("%s %w", method, err))
+		}
+	}
+	if err := checkOutputFields(reflect.TypeFor[Output]()); err != nil {
+		errs = append(errs, fmt.Errorf("%s %s: %w", method, route.pattern(), err))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if cfg.responseEncoder == nil && !reflect.TypeFor[Output]().Implements(reflect.TypeFor[Responder]()) {
+		router.unencoded = append(router.unencoded, fmt.Errorf("%s %s: no response encoder for output %s", method, route.pattern(), reflect.TypeFor[Output]()))
 	}
 
-	var httpHandler http.Handler
-	httpHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if err := handleRoute(r, w, route, handler, router.responseEncoder); err != nil {
-			router.HandleErr(r.Context(), w, err)
+	router.register(route.node, RouteInfo{
+		Method:     method,
+		Pattern:    route.pattern(),
+		Handler:    funcName(handler),
+		Input:      input.String(),
+		Output:     reflect.TypeFor[Output]().String(),
+		Providers:  providers,
+		InputType:  input,
+		OutputType: reflect.TypeFor[Output](),
+	}, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		w := &committedWriter{ResponseWriter: rw}
+		if err := handleRoute(r, w, route, call, cfg); err != nil {
+			if errors.Is(err, ErrNoContent) && !w.committed {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if ex, ok := exchangeFrom(r.Context()); ok {
+				ex.err = err
+			}
+			cfg.HandleErr(r.Context(), w, err)
 			return
 		}
-	})
-	for _, middleware := range router.middleware {
-		httpHandler = middleware(httpHandler)
-	}
-	route.node.handler = httpHandler
+	}))
 	return nil
 }
 
-func handleRoute[Input, Output any](r *http.Request, w http.ResponseWriter, route route, handler func(context.Context, Input) (Output, error), responseEncoder func(context.Context, http.ResponseWriter, any) error) (mErr error) {
-	ctx := r.Context()
+func handleRoute[Input, Output any](r *http.Request, w http.ResponseWriter, route route, handler func(context.Context, Input) (Output, error), cfg config) (mErr error) {
+	ctx, ex := exchangeOf(r)
 	var input Input
+	var field string
+	var stack []byte
 
 	defer func() {
-		if r := recover(); r != nil && mErr == nil {
-			mErr = fmt.Errorf("panic: %v", r)
+		if p := recover(); p != nil && mErr == nil {
+			mErr = newPanicError(p)
+		}
+		var panicErr *PanicError
+		if errors.As(mErr, &panicErr) {
+			stack = panicErr.Stack
+		}
+		if mErr != nil {
+			mErr = &routeError{
+				method:  route.method,
+				pattern: route.pattern(),
+				field:   field,
+				input:   input,
+				stack:   stack,
+				accept:  r.Header.Get("Accept"),
+				err:     mErr,
+			}
 		}
 	}()
 
+	// after commit hooks run after the closers, so only once transactions they commit succeeded.
+	var res any
+	var encoded bool
+	if len(cfg.afterCommit) > 0 {
+		defer func() {
+			// warmup requests that skip the handler have no output to publish
+			if !encoded || mErr != nil || skipHandler(ctx) {
+				return
+			}
+			info, _ := RouteFromContext(ctx)
+			for _, hook := range cfg.afterCommit {
+				hook(ctx, info, input, res)
+			}
+		}()
+	}
+
 	inputValue := reflect.ValueOf(&input).Elem()
 
-	path, err := splitPath(r.URL)
+	path, err := splitPath(r.URL, false)
 	if err != nil {
 		return err
 	}
+	bindCtx, endBind := cfg.span(ctx, "bind")
 	request := request{
 		Request:  r,
 		pathTail: path,
 	}
-	for i, fieldMod := range route.fields {
-		field := inputValue.Field(i)
-		close, err := fieldMod(&request, field.Addr().Interface())
+	if bindCtx != ctx {
+		request.Request = r.WithContext(bindCtx)
+	}
+	var wg sync.WaitGroup
+	parallel := make([]parallelField, len(route.fields))
+	if len(route.parallel) > 0 {
+		defer func() {
+			wg.Wait()
+			for i := len(parallel) - 1; i >= 0; i-- {
+				if close := parallel[i].close; close != nil {
+					if err := close(mErr); err != nil && mErr == nil {
+						mErr = err
+					}
+				}
+			}
+		}()
+	}
+	for i := range route.fields {
+		field = route.names[i]
+		if route.parallel[field] {
+			detached := request
+			detached.pathTail = nil
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					if p := recover(); p != nil {
+						parallel[i].err = newPanicError(p)
+					}
+				}()
+				parallel[i].close, parallel[i].err = cfg.bindField(ctx, route, i, &detached, inputValue.Field(i).Addr().Interface())
+			}()
+			continue
+		}
+		rewind(request.Body)
+		close, err := cfg.bindField(ctx, route, i, &request, inputValue.Field(i).Addr().Interface())
 		if err != nil {
+			endBind(err)
 			return fmt.Errorf("applying input option: %w", err)
 		}
 		if close != nil {
 			defer func() {
 				if r := recover(); r != nil && mErr == nil {
-					mErr = fmt.Errorf("panic: %v", r)
+					mErr = newPanicError(r)
 				}
 				if err := close(mErr); err != nil && mErr == nil {
 					mErr = err
@@ -109,32 +217,121 @@ func handleRoute[Input, Output any](r *http.Request, w http.ResponseWriter, rout
 		}
 	}
 
-	if r.Method == http.MethodHead {
-		return
+	wg.Wait()
+	for i, bound := range parallel {
+		if bound.err != nil {
+			field = route.names[i]
+			endBind(bound.err)
+			return fmt.Errorf("applying input option: %w", bound.err)
+		}
 	}
 
-	res, err := handler(ctx, input)
-	if err != nil {
-		return fmt.Errorf("handling request: %w", err)
+	field = ""
+	for _, hook := range cfg.onInput {
+		if err := hook(bindCtx, inputValue); err != nil {
+			endBind(err)
+			return fmt.Errorf("input hook: %w", err)
+		}
+	}
+	endBind(nil)
+	ex.input = input
+
+	if cfg.echoInput != "" && r.Header.Get(cfg.echoInput) != "" {
+		writeJSON(w, input)
+		return nil
+	}
+
+	var output Output
+	if !skipHandler(ctx) {
+		handleCtx, endHandle := cfg.span(ctx, "handle")
+		output, err = handler(handleCtx, input)
+		endHandle(err)
+		if errors.Is(err, ErrNoContent) {
+			// no content is a success, closers commit and after commit hooks run
+			w.WriteHeader(http.StatusNoContent)
+			encoded = true
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("handling request: %w", err)
+		}
+	}
+
+	encodeCtx, endEncode := cfg.span(ctx, "encode")
+	defer func() { endEncode(mErr) }()
+	res = output
+	if len(cfg.onResponse) > 0 && !skipHandler(ctx) {
+		info, _ := RouteFromContext(ctx)
+		for _, hook := range cfg.onResponse {
+			if res, err = hook(encodeCtx, info, res); err != nil {
+				return fmt.Errorf("response hook: %w", err)
+			}
+		}
 	}
 
-	if err := responseEncoder(ctx, w, res); err != nil {
+	if typer, ok := res.(ContentTyper); ok {
+		w.Header().Set("Content-Type", typer.ContentType())
+	}
+	if setter, ok := res.(HeaderSetter); ok {
+		setter.SetHeader(w.Header())
+	}
+	if responder, ok := res.(Responder); ok {
+		if err := responder.Respond(w, r); err != nil {
+			return fmt.Errorf("writing response: %w", err)
+		}
+		encoded = true
+		return nil
+	}
+	var status int
+	if res, status, err = splitOutput(w.Header(), res); err != nil {
+		return err
+	}
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.WriteHeader(status)
+		encoded = true
+		return nil
+	}
+	var sw *statusResponseWriter
+	if status != 0 {
+		sw = &statusResponseWriter{ResponseWriter: w, status: status}
+		w = sw
+	}
+	if r.Method == http.MethodHead {
+		w = headResponseWriter{w}
+	}
+	encoder := cfg.encoder()
+	if encoder == nil {
+		return fmt.Errorf("no response encoder for output %T", res)
+	}
+	if err := encoder(encodeCtx, w, res); err != nil {
 		return fmt.Errorf("encoding response: %w", err)
 	}
+	if sw != nil && !sw.wroteHeader {
+		sw.WriteHeader(status)
+	}
+	encoded = true
 
 	return nil
 }
 
-func splitPath(link *url.URL) ([]string, error) {
-	if link.RawPath == "" {
-		return strings.Split(link.Path, "/")[1:], nil
+// splitPath splits the escaped path of the URL into unescaped segments, so an encoded slash
+// stays within its segment no matter whether the URL carries a RawPath.
+// In strict mode encoded slashes, backslashes and NUL bytes are rejected as well as a
+// RawPath that is not an encoding of Path.
+func splitPath(link *url.URL, strict bool) ([]string, error) {
+	escaped := link.EscapedPath()
+	if strict && link.RawPath != "" && escaped != link.RawPath {
+		return nil, fmt.Errorf("raw path %q does not match path %q", link.RawPath, link.Path)
 	}
-	path := strings.Split(link.RawPath, "/")[1:]
+	path := strings.Split(escaped, "/")[1:]
 	for i, p := range path {
 		s, err := url.PathUnescape(p)
 		if err != nil {
 			return nil, fmt.Errorf("url.PathUnescape: %w", err)
 		}
+		if strict && strings.ContainsAny(s, "/\\\x00") {
+			return nil, Messagef("path segment %q contains an encoded slash, backslash or NUL", p)
+		}
 		path[i] = s
 	}
 	return path, nil
@@ -142,35 +339,36 @@ func splitPath(link *url.URL) ([]string, error) {
 
 func Post[Input, Output any](handler func(context.Context, Input) (Output, error)) Option {
 	return func(r *router) error {
-		return routeHandler(r, &r.post, handler)
+		return routeHandler(r, http.MethodPost, &r.post, handler)
 	}
 }
 
 func Put[Input, Output any](handler func(context.Context, Input) (Output, error)) Option {
 	return func(r *router) error {
-		return routeHandler(r, &r.put, handler)
+		return routeHandler(r, http.MethodPut, &r.put, handler)
 	}
 }
 
 func Get[Input, Output any](handler func(context.Context, Input) (Output, error)) Option {
 	return func(r *router) error {
-		return routeHandler(r, &r.get, handler)
+		return routeHandler(r, http.MethodGet, &r.get, handler)
 	}
 }
 
 func Delete[Input, Output any](handler func(context.Context, Input) (Output, error)) Option {
 	return func(r *router) error {
-		return routeHandler(r, &r.delete, handler)
+		return routeHandler(r, http.MethodDelete, &r.delete, handler)
 	}
 }
 
 func Handle(handler http.Handler) Option {
 	return func(r *router) error {
-		for _, middleware := range r.middleware {
-			handler = middleware(handler)
-		}
-		r.get.handler = handler
 		r.get.allowRemainder = true
+		r.register(&r.get, RouteInfo{
+			Method:  http.MethodGet,
+			Pattern: "/{path...}",
+			Handler: fmt.Sprintf("%T", handler),
+		}, handler)
 		return nil
 	}
 }
@@ -2,14 +2,31 @@ package route
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
+	"iter"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"reflect"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -188,3 +205,5261 @@ func TestIterDefer(t *testing.T) {
 	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, values)
 
 }
+
+func TestSafeErrors(t *testing.T) {
+	var logged strings.Builder
+	handler, err := New(
+		SafeErrors(slog.New(slog.NewTextHandler(&logged, nil)), false),
+		JSONResponse(),
+		Get(func(ctx context.Context, in struct{}) (string, error) {
+			panic("secret internals")
+		}),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "http://example.com", nil))
+
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, http.StatusText(http.StatusInternalServerError), strings.TrimSpace(string(body)))
+	assert.Contains(t, logged.String(), "secret internals")
+}
+
+func TestDevMode(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			DevMode(),
+			Get(func(ctx context.Context, in struct {
+				Stuff Fixed
+				ID    int
+			}) (string, error) {
+				return "Hello World", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com/stuff/seven", nil)
+	req.Header.Set("Accept", "application/json")
+	handler(w, req)
+
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Contains(t, string(body), `"pattern":"/stuff/{ID}"`)
+	assert.Contains(t, string(body), `"field":"ID"`)
+}
+
+func TestRoutes(t *testing.T) {
+	routes, err := Routes(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (string, error) {
+				return "", nil
+			}),
+			Post(func(ctx context.Context, in struct {
+				Users Fixed
+				Body  struct{ Name string }
+			}) (string, error) {
+				return "", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("Routes() error = %v", err)
+		return
+	}
+
+	var patterns []string
+	for _, route := range routes {
+		patterns = append(patterns, route.String())
+	}
+	assert.Equal(t, []string{"GET /users/{ID}", "POST /users"}, patterns)
+
+	var table strings.Builder
+	assert.NoError(t, PrintRoutes(&table, routes))
+	assert.Contains(t, table.String(), "GET     /users/{ID}")
+}
+
+func TestRouter(t *testing.T) {
+	router, err := NewRouter(testOptions())
+	if err != nil {
+		t.Errorf("NewRouter() error = %v", err)
+		return
+	}
+
+	serve := func() int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/plugin", nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve())
+	assert.NoError(t, router.Add(Get(func(ctx context.Context, in struct {
+		Plugin Fixed
+	}) (string, error) {
+		return "Hello Plugin", nil
+	})))
+	assert.Equal(t, http.StatusOK, serve())
+	assert.NoError(t, router.Remove("GET /plugin"))
+	assert.Equal(t, http.StatusNotFound, serve())
+	assert.Error(t, router.Remove("GET /plugin"))
+}
+
+func TestDeprecated(t *testing.T) {
+	sunset := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	handler, err := New(
+		testOptions(
+			Group(
+				Deprecated(sunset, "https://example.com/migration"),
+				Get(func(ctx context.Context, in struct {
+					Old Fixed
+				}) (string, error) {
+					return "old", nil
+				}),
+			),
+			Get(func(ctx context.Context, in struct {
+				New Fixed
+			}) (string, error) {
+				return "new", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "http://example.com/old", nil))
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Tue, 01 Jan 2030 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(t, `<https://example.com/migration>; rel="deprecation"`, w.Header().Get("Link"))
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "http://example.com/new", nil))
+	assert.Empty(t, w.Header().Get("Deprecation"))
+}
+
+func TestPagination(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			ByType(PaginationQuery(10, 50)),
+			Get(func(ctx context.Context, in struct {
+				Items Fixed
+				Page  Pagination
+			}) (Page[int], error) {
+				return Page[int]{
+					Items:      []int{in.Page.Offset()},
+					Total:      95,
+					Pagination: in.Page,
+				}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "http://example.com/items?page=2&per_page=20", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "95", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, `</items?page=1&per_page=20>; rel="first", </items?page=1&per_page=20>; rel="prev", `+
+		`</items?page=3&per_page=20>; rel="next", </items?page=5&per_page=20>; rel="last"`, w.Header().Get("Link"))
+	assert.Equal(t, `{"Items":[20],"Total":95}`, strings.TrimSpace(w.Body.String()))
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "http://example.com/items?page=0", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+type linkedUser struct {
+	ID   int
+	Name string
+}
+
+func (u linkedUser) Links(ctx context.Context) map[string]string {
+	self, _ := Reverse("/users/{ID}", u.ID)
+	return map[string]string{"self": self}
+}
+
+func TestHypermediaLinks(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			HypermediaLinks(true),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (linkedUser, error) {
+				return linkedUser{ID: in.ID, Name: "Ada"}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "http://example.com/users/7", nil))
+
+	assert.Equal(t, "application/hal+json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"ID":7,"Name":"Ada","_links":{"self":{"href":"/users/7"}}}`, w.Body.String())
+}
+
+func TestBlob(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Image Fixed
+			}) (Blob, error) {
+				return Blob{Data: []byte("\x89PNG\r\n\x1a\n")}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	for _, method := range []string{"GET", "HEAD"} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, "http://example.com/image", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.Equal(t, "8", w.Header().Get("Content-Length"))
+		if method == "HEAD" {
+			assert.Empty(t, w.Body.Bytes())
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	var records []AuditRecord
+	handler, err := New(
+		testOptions(
+			Audit(
+				func(r *http.Request) string { return r.Header.Get("X-User") },
+				func(ctx context.Context, record AuditRecord) { records = append(records, record) },
+			),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (string, error) {
+				return "Hello", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/users/7", nil)
+	req.Header.Set("X-User", "ada")
+	handler(httptest.NewRecorder(), req)
+
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "ada", records[0].Principal)
+		assert.Equal(t, "/users/{ID}", records[0].Pattern)
+		assert.Equal(t, http.StatusOK, records[0].Status)
+		assert.Equal(t, struct {
+			Users Fixed
+			ID    int
+		}{ID: 7}, records[0].Input)
+	}
+}
+
+func TestBodyLogger(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+	})
+	for _, tt := range []struct {
+		name       string
+		limit      int
+		redact     []string
+		body       string
+		wantLogged string
+	}{
+		{
+			name:       "nested",
+			limit:      1024,
+			redact:     []string{"password", "token"},
+			body:       `{"user":{"name":"ada","Password":"secret"},"sessions":[{"token":"t1"}]}`,
+			wantLogged: `{"sessions":[{"token":"[REDACTED]"}],"user":{"Password":"[REDACTED]","name":"ada"}}`,
+		},
+		{
+			name:       "capped",
+			limit:      8,
+			body:       `{"name":"ada"}`,
+			wantLogged: `{"name":`,
+		},
+		{
+			name:       "capped with redaction",
+			limit:      8,
+			redact:     []string{"password"},
+			body:       `{"password":"secret"}`,
+			wantLogged: "[REDACTED]",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs strings.Builder
+			handler := BodyLogger(slog.New(slog.NewJSONHandler(&logs, nil)), tt.limit, tt.redact...)(echo)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("POST", "/users", strings.NewReader(tt.body)))
+			// the handler and the client get the whole body regardless of the limit
+			assert.Equal(t, tt.body, w.Body.String())
+
+			var record struct {
+				Status   int
+				Request  string
+				Response string
+			}
+			assert.NoError(t, json.Unmarshal([]byte(logs.String()), &record))
+			assert.Equal(t, http.StatusCreated, record.Status)
+			assert.Equal(t, tt.wantLogged, record.Request)
+			assert.Equal(t, tt.wantLogged, record.Response)
+		})
+	}
+}
+
+func TestSlowRequest(t *testing.T) {
+	var records []SlowRecord
+	handler, err := New(
+		testOptions(
+			SlowRequest(20*time.Millisecond, func(ctx context.Context, record SlowRecord) {
+				records = append(records, record)
+			}),
+			Get(func(ctx context.Context, in struct {
+				Reports Fixed
+				ID      int
+			}) (string, error) {
+				if in.ID == 2 {
+					time.Sleep(30 * time.Millisecond)
+				}
+				return "report", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/reports/1", nil))
+	assert.Empty(t, records, "fast requests are not recorded")
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/reports/2", nil))
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "GET", records[0].Method)
+		assert.Equal(t, "/reports/{ID}", records[0].Pattern)
+		assert.Equal(t, "/reports/2", records[0].Path)
+		assert.GreaterOrEqual(t, records[0].Duration, 30*time.Millisecond)
+		assert.Equal(t, struct {
+			Reports Fixed
+			ID      int
+		}{ID: 2}, records[0].Input)
+	}
+}
+
+func TestNonce(t *testing.T) {
+	secret := []byte("secret")
+	handler, err := New(
+		testOptions(
+			Nonce(secret, time.Minute, NewMemoryNonceStore()),
+			Post(func(ctx context.Context, in struct {
+				Hook Fixed
+			}) (string, error) {
+				return "ok", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	send := func(signature string) int {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req := httptest.NewRequest("POST", "http://example.com/hook", strings.NewReader(`{}`))
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Nonce", "n1")
+		if signature == "" {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write([]byte(timestamp + ".n1.{}"))
+			signature = hex.EncodeToString(mac.Sum(nil))
+		}
+		req.Header.Set("X-Signature", signature)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, send("00"))
+	assert.Equal(t, http.StatusOK, send(""))
+	assert.Equal(t, http.StatusConflict, send(""))
+
+	req := httptest.NewRequest("POST", "http://example.com/hook", strings.NewReader(strings.Repeat("x", nonceBodyLimit+1)))
+	req.Header.Set("X-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set("X-Nonce", "n2")
+	req.Header.Set("X-Signature", "00")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestResponseCache(t *testing.T) {
+	calls := 0
+	handler, err := New(
+		testOptions(
+			ResponseCache(NewMemoryCache(10), time.Minute),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (int, error) {
+				calls++
+				CacheTags(ctx, "users")
+				return calls, nil
+			}),
+			Delete(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (string, error) {
+				return "deleted", InvalidateCache(ctx, "users")
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func() string {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "http://example.com/users/7", nil))
+		return w.Header().Get("X-Cache") + " " + strings.TrimSpace(w.Body.String())
+	}
+
+	assert.Equal(t, "MISS 1", get())
+	assert.Equal(t, "HIT 1", get())
+	handler(httptest.NewRecorder(), httptest.NewRequest("DELETE", "http://example.com/users/7", nil))
+	assert.Equal(t, "MISS 2", get())
+}
+
+type cacheHeaderOutput struct {
+	Calls  int
+	header http.Header
+}
+
+func (o cacheHeaderOutput) SetHeader(header http.Header) {
+	for name, values := range o.header {
+		header[name] = values
+	}
+}
+
+func TestResponseCachePrivate(t *testing.T) {
+	calls := 0
+	handler, err := New(
+		testOptions(
+			ResponseCache(NewMemoryCache(10), time.Minute),
+			Get(func(ctx context.Context, in struct {
+				Pages Fixed
+				ID    string
+			}) (cacheHeaderOutput, error) {
+				calls++
+				header := http.Header{}
+				switch in.ID {
+				case "cookie":
+					header.Set("Set-Cookie", "session=1")
+				case "private":
+					header.Set("Cache-Control", "max-age=60, private")
+				case "no-store":
+					header.Set("Cache-Control", "no-store")
+				case "hop":
+					header.Set("Connection", "close")
+				}
+				return cacheHeaderOutput{Calls: calls, header: header}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(id, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/pages/"+id, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	for _, id := range []string{"cookie", "private", "no-store"} {
+		get(id, "")
+		assert.Equal(t, "MISS", get(id, "").Header().Get("X-Cache"), id)
+	}
+	get("hop", "")
+	w := get("hop", "")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Empty(t, w.Header().Get("Connection"))
+
+	assert.Contains(t, get("secret", "Bearer alice").Body.String(), `"Calls":8`)
+	w = get("secret", "Bearer bob")
+	assert.Empty(t, w.Header().Get("X-Cache"))
+	assert.Contains(t, w.Body.String(), `"Calls":9`)
+}
+
+func TestCoalesce(t *testing.T) {
+	var calls atomic.Int32
+	var gate sync.RWMutex
+	handler, err := New(
+		testOptions(
+			Coalesce(),
+			Get(func(ctx context.Context, in struct {
+				Report Fixed
+			}) (int32, error) {
+				gate.RLock()
+				defer gate.RUnlock()
+				return calls.Add(1), nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	concurrent := func(authorization ...string) []string {
+		gate.Lock()
+		var wg sync.WaitGroup
+		bodies := make([]string, 3)
+		for i := range bodies {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest("GET", "http://example.com/report", nil)
+				if len(authorization) > 0 {
+					r.Header.Set("Authorization", authorization[i])
+				}
+				handler(w, r)
+				bodies[i] = strings.TrimSpace(w.Body.String())
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+		gate.Unlock()
+		wg.Wait()
+		return bodies
+	}
+
+	assert.Equal(t, []string{"1", "1", "1"}, concurrent())
+	assert.Equal(t, int32(1), calls.Load())
+
+	// requests of different users never share a response
+	bodies := concurrent("Bearer alice", "Bearer bob", "Bearer carol")
+	assert.Equal(t, int32(4), calls.Load())
+	slices.Sort(bodies)
+	assert.Equal(t, []string{"2", "3", "4"}, bodies)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			CircuitBreaker(0.5, 2, time.Minute, time.Minute),
+			Get(func(ctx context.Context, in struct {
+				Flaky Fixed
+			}) (string, error) {
+				return "", fmt.Errorf("dependency down")
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	var codes []int
+	for range 3 {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "http://example.com/flaky", nil))
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(t, []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusServiceUnavailable}, codes)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	handler, err = New(
+		testOptions(
+			CircuitBreaker(0.5, 2, time.Minute, 10*time.Millisecond),
+			Get(func(ctx context.Context, in struct {
+				Flaky Fixed
+				Mode  string
+			}) (string, error) {
+				if in.Mode == "slow" {
+					started <- struct{}{}
+					<-release
+					return "", nil
+				}
+				return "", fmt.Errorf("dependency down")
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+	get := func(mode string) int {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/flaky/"+mode, nil))
+		return w.Code
+	}
+	slow := func() (done chan struct{}) {
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			assert.Equal(t, http.StatusOK, get("slow"))
+		}()
+		<-started
+		return done
+	}
+
+	early := slow()
+	assert.Equal(t, http.StatusInternalServerError, get("fail"))
+	assert.Equal(t, http.StatusInternalServerError, get("fail"))
+	time.Sleep(10 * time.Millisecond)
+	probe := slow()
+	// a request let through before the breaker opened doesn't close it
+	release <- struct{}{}
+	<-early
+	assert.Equal(t, http.StatusServiceUnavailable, get("fail"))
+	release <- struct{}{}
+	<-probe
+	assert.Equal(t, http.StatusInternalServerError, get("fail"))
+}
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.Path)
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL + "/v1")
+
+	handler, err := New(
+		testOptions(
+			Proxy("/legacy", target, func(path string) string {
+				return strings.TrimPrefix(path, "/legacy")
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("PUT", "http://example.com/legacy/users/7", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "PUT /v1/users/7", w.Body.String())
+}
+
+func TestJSONRPC(t *testing.T) {
+	handler, err := New(
+		JSONRPC("/rpc",
+			RPC("sum", func(ctx context.Context, in []int) (int, error) {
+				sum := 0
+				for _, i := range in {
+					sum += i
+				}
+				return sum, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "http://example.com/rpc", strings.NewReader(`[
+		{"jsonrpc": "2.0", "method": "sum", "params": [1, 2, 3], "id": 1},
+		{"jsonrpc": "2.0", "method": "sum", "params": [1]},
+		{"jsonrpc": "2.0", "method": "missing", "id": "b"}
+	]`)))
+
+	assert.JSONEq(t, `[
+		{"jsonrpc": "2.0", "result": 6, "id": 1},
+		{"jsonrpc": "2.0", "error": {"code": -32601, "message": "method not found"}, "id": "b"}
+	]`, w.Body.String())
+}
+
+func TestLongPoll(t *testing.T) {
+	events := make(chan string, 1)
+	handler, err := New(
+		testOptions(
+			LongPoll(20*time.Millisecond, func(ctx context.Context, in struct {
+				Events Fixed
+			}) (<-chan string, error) {
+				return events, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "http://example.com/events", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	events <- "ping"
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "http://example.com/events", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"ping"`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestTrailers(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Trailers("X-Checksum"),
+			Get(func(ctx context.Context, in struct {
+				Export Fixed
+			}) (string, error) {
+				SetTrailer(ctx, "X-Checksum", "abc")
+				return "data", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/export")
+	if err != nil {
+		t.Errorf("http.Get() error = %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	_, _ = io.ReadAll(resp.Body)
+
+	assert.Equal(t, "abc", resp.Trailer.Get("X-Checksum"))
+}
+
+func TestTrustedProxies(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			TrustedProxies("10.0.0.0/8"),
+			ByType(ForwardedRequest()),
+			Get(func(ctx context.Context, in struct {
+				Whoami    Fixed
+				Forwarded Forwarded
+			}) (string, error) {
+				return fmt.Sprintf("%s %s %s", in.Forwarded.ClientIP, in.Forwarded.Scheme, in.Forwarded.Host), nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	whoami := func(remoteAddr string) string {
+		req := httptest.NewRequest("GET", "http://internal/whoami", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.2")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", "example.com")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		unquoted, _ := strconv.Unquote(strings.TrimSpace(w.Body.String()))
+		return unquoted
+	}
+
+	assert.Equal(t, "203.0.113.9 https example.com", whoami("10.0.0.1:1234"))
+	assert.Equal(t, "198.51.100.1 http internal", whoami("198.51.100.1:1234"))
+}
+
+func TestNormalizePath(t *testing.T) {
+	var seen []string
+	handler, err := New(
+		testOptions(
+			NormalizePath(CollapseSlashes, ResolveDotSegments, DecodePercent),
+			Middleware(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					seen = append(seen, r.URL.EscapedPath())
+					next.ServeHTTP(w, r)
+				})
+			}),
+			Get(func(ctx context.Context, in struct {
+				Admin Fixed
+				Users Fixed
+			}) (string, error) {
+				return "admin", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	for _, path := range []string{"/admin/users", "//admin///users", "/public/../admin/./users", "/public/%2e%2e/%61dmin/users"} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+	assert.Equal(t, []string{"/admin/users", "/admin/users", "/admin/users", "/admin/users"}, seen)
+}
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		link    *url.URL
+		strict  bool
+		want    []string
+		wantErr bool
+	}{
+		{name: "path only", link: &url.URL{Path: "/files/a b"}, want: []string{"files", "a b"}},
+		{name: "raw path", link: mustParseURL("/files/a%2Fb"), want: []string{"files", "a/b"}},
+		{name: "path with literal percent", link: &url.URL{Path: "/files/a%2Fb"}, want: []string{"files", "a%2Fb"}},
+		{name: "strict raw path", link: mustParseURL("/files/a%20b"), strict: true, want: []string{"files", "a b"}},
+		{name: "strict encoded slash", link: mustParseURL("/files/a%2Fb"), strict: true, wantErr: true},
+		{name: "strict encoded backslash", link: mustParseURL("/files/a%5Cb"), strict: true, wantErr: true},
+		{name: "strict mismatching raw path", link: &url.URL{Path: "/files/a", RawPath: "/files/b"}, strict: true, wantErr: true},
+		{name: "invalid raw path", link: &url.URL{Path: "/a%zz", RawPath: "/a%zz"}, want: []string{"a%zz"}},
+		{name: "strict invalid raw path", link: &url.URL{Path: "/a%zz", RawPath: "/a%zz"}, strict: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitPath(tt.link, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("splitPath() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func mustParseURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestSortQuery(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			ByType(SortQuery("name", "created_at")),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				Sort  Sort
+			}) (Sort, error) {
+				return in.Sort, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	for _, tt := range []struct {
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{query: "", wantStatus: http.StatusOK, wantBody: "null"},
+		{query: "?sort=name", wantStatus: http.StatusOK, wantBody: `[{"Field":"name","Desc":false}]`},
+		{query: "?sort=-created_at,%20name", wantStatus: http.StatusOK, wantBody: `[{"Field":"created_at","Desc":true},{"Field":"name","Desc":false}]`},
+		{query: "?sort=age", wantStatus: http.StatusBadRequest, wantBody: `can not sort by "age", allowed are name, created_at`},
+		{query: "?sort=name,", wantStatus: http.StatusBadRequest, wantBody: `can not sort by "", allowed are name, created_at`},
+	} {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "/users"+tt.query, nil))
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestFilterQuery(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			ByType(FilterQuery("status", "owner")),
+			Get(func(ctx context.Context, in struct {
+				Tickets Fixed
+				Filter  Filter
+			}) (Filter, error) {
+				return in.Filter, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	for _, tt := range []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "none", query: "?page=2", wantStatus: http.StatusOK, wantBody: "{}"},
+		{name: "allowed", query: "?filter[status]=open&filter[owner]=alice", wantStatus: http.StatusOK, wantBody: `{"owner":"alice","status":"open"}`},
+		{name: "disallowed", query: "?filter[secret]=x", wantStatus: http.StatusBadRequest, wantBody: `can not filter by "secret", allowed are status, owner`},
+		{name: "twice", query: "?filter[status]=open&filter[status]=closed", wantStatus: http.StatusBadRequest, wantBody: `filter "status" is given 2 times`},
+		{name: "malformed bracket", query: "?filter[status=open", wantStatus: http.StatusBadRequest, wantBody: `malformed filter parameter "filter[status"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "/tickets"+tt.query, nil))
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := []struct {
+		name         string
+		canonicalize func(url.Values) error
+		wantStatus   int
+		wantBody     string
+	}{
+		{name: "first wins", canonicalize: FirstQueryValueWins(), wantStatus: http.StatusOK, wantBody: `"1"`},
+		{name: "last wins", canonicalize: LastQueryValueWins(), wantStatus: http.StatusOK, wantBody: `"2"`},
+		{name: "reject", canonicalize: RejectDuplicateQueryParams(), wantStatus: http.StatusBadRequest, wantBody: `query parameter "id" is given 2 times`},
+		{name: "multi valued", canonicalize: RejectDuplicateQueryParams("id"), wantStatus: http.StatusOK, wantBody: `"1,2"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := New(
+				testOptions(
+					CanonicalQuery(tt.canonicalize),
+					ByType(RequestValue(func(r *http.Request, v *url.Values) error {
+						*v = r.URL.Query()
+						return nil
+					})),
+					Get(func(ctx context.Context, in struct {
+						Items Fixed
+						Query url.Values
+					}) (string, error) {
+						return strings.Join(in.Query["id"], ","), nil
+					}),
+				),
+			)
+			if err != nil {
+				t.Errorf("New() error = %v", err)
+				return
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "/items?id=1&id=2", nil))
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantBody, strings.TrimSpace(w.Body.String()))
+		})
+	}
+}
+
+func TestEchoInput(t *testing.T) {
+	called := false
+	handler, err := New(
+		testOptions(
+			EchoInput("X-Echo-Input"),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (string, error) {
+				called = true
+				return "user", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	req.Header.Set("X-Echo-Input", "1")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	assert.False(t, called)
+	assert.JSONEq(t, `{"Users": {}, "ID": 42}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/users/42", nil))
+	assert.True(t, called)
+	assert.Equal(t, `"user"`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestRouteFromContext(t *testing.T) {
+	var pattern string
+	var started bool
+	handler, err := New(
+		testOptions(
+			Middleware(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					next.ServeHTTP(w, r)
+					pattern, _ = PatternFromContext(r.Context())
+					_, started = StartFromContext(r.Context())
+				})
+			}),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (string, error) {
+				info, _ := RouteFromContext(ctx)
+				return info.Method, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/users/42", nil))
+	assert.Equal(t, `"GET"`, strings.TrimSpace(w.Body.String()))
+	assert.Equal(t, "/users/{ID}", pattern)
+	assert.True(t, started)
+
+	_, ok := PatternFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func TestIntercept(t *testing.T) {
+	type userInput struct {
+		Users Fixed
+		ID    int
+	}
+	var seen []string
+	handler, err := New(
+		testOptions(
+			Intercept(func(ctx context.Context, in any, next func(context.Context, any) (any, error)) (any, error) {
+				seen = append(seen, fmt.Sprintf("%T", in))
+				return next(ctx, in)
+			}),
+			Intercept(func(ctx context.Context, in userInput, next func(context.Context, userInput) (string, error)) (string, error) {
+				in.ID++
+				out, err := next(ctx, in)
+				return strings.ToUpper(out), err
+			}),
+			Get(func(ctx context.Context, in userInput) (string, error) {
+				return fmt.Sprintf("user %d", in.ID), nil
+			}),
+			Get(func(ctx context.Context, in struct {
+				Items Fixed
+			}) (int, error) {
+				return 7, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/users/41", nil))
+	assert.Equal(t, `"USER 42"`, strings.TrimSpace(w.Body.String()))
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/items", nil))
+	assert.Equal(t, `7`, strings.TrimSpace(w.Body.String()))
+
+	assert.Equal(t, []string{"route.userInput", "struct { Items route.Fixed }"}, seen)
+}
+
+type sparseUser struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func TestSparseFields(t *testing.T) {
+	_, err := New(SparseFields())
+	assert.EqualError(t, err, "SparseFields requires a response encoder")
+
+	handler, err := New(
+		testOptions(
+			SparseFields(),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+			}) ([]sparseUser, error) {
+				return []sparseUser{{ID: 1, Name: "alice", Email: "alice@example.com"}, {ID: 2, Name: "bob", Email: "bob@example.com"}}, nil
+			}),
+			Get(func(ctx context.Context, in struct {
+				Me Fixed
+			}) (sparseUser, error) {
+				return sparseUser{ID: 1, Name: "alice", Email: "alice@example.com"}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	for _, tt := range []struct {
+		path     string
+		wantBody string
+	}{
+		{path: "/me", wantBody: `{"id":1,"name":"alice","email":"alice@example.com"}`},
+		{path: "/me?fields=id,%20NAME", wantBody: `{"id":1,"name":"alice"}`},
+		{path: "/me?fields=unknown", wantBody: `{}`},
+		{path: "/users?fields=name", wantBody: `[{"name":"alice"},{"name":"bob"}]`},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", tt.path, nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantBody+"\n", w.Body.String())
+		})
+	}
+}
+
+func TestOnResponse(t *testing.T) {
+	type user struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	handler, err := New(
+		testOptions(
+			OnResponse(func(ctx context.Context, info RouteInfo, output any) (any, error) {
+				if u, ok := output.(user); ok {
+					u.Email = "***"
+					return u, nil
+				}
+				return output, nil
+			}),
+			OnResponse(func(ctx context.Context, info RouteInfo, output any) (any, error) {
+				return map[string]any{"route": info.Pattern, "data": output}, nil
+			}),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (user, error) {
+				return user{Name: "ada", Email: "ada@example.com"}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/users/1", nil))
+	assert.JSONEq(t, `{"route": "/users/{ID}", "data": {"name": "ada", "email": "***"}}`, w.Body.String())
+}
+
+func TestOnInput(t *testing.T) {
+	type input struct {
+		Users Fixed
+		Name  string
+		Limit int
+	}
+	handler, err := New(
+		testOptions(
+			ByName("Limit", RequestValue(func(r *http.Request, v any) error {
+				*v.(*int), _ = strconv.Atoi(r.URL.Query().Get("limit"))
+				return nil
+			})),
+			OnInputField(func(ctx context.Context, v *string) error {
+				*v = strings.ToLower(strings.TrimSpace(*v))
+				return nil
+			}),
+			OnInput(func(ctx context.Context, in any) error {
+				if in, ok := in.(*input); ok && in.Limit == 0 {
+					in.Limit = 10
+				}
+				return nil
+			}),
+			Get(func(ctx context.Context, in input) (string, error) {
+				return fmt.Sprintf("%s %d", in.Name, in.Limit), nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/users/%20Ada%20", nil))
+	assert.Equal(t, `"ada 10"`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestRESTDefaults(t *testing.T) {
+	handler, err := New(
+		RESTDefaults(),
+		Get(func(ctx context.Context, in struct {
+			Users      Fixed
+			ID         int
+			Query      struct{ Active bool }
+			Pagination Pagination
+		}) (string, error) {
+			return fmt.Sprintf("%d %t %d", in.ID, in.Query.Active, in.Pagination.PerPage), nil
+		}),
+		Post(func(ctx context.Context, in struct {
+			Users Fixed
+			Body  struct{ Name string }
+		}) (string, error) {
+			return in.Body.Name, nil
+		}),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/users/7?active=true", nil))
+	assert.Equal(t, `"7 true 20"`, strings.TrimSpace(w.Body.String()))
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/users", strings.NewReader(`{"Name":`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/users", strings.NewReader(`{"Name":"`+strings.Repeat("a", 2<<20)+`"}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestMissingOptionDiagnostics(t *testing.T) {
+	_, err := New(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+				Bdy   struct{ Name string }
+			}) (string, error) {
+				return "", nil
+			}),
+		),
+	)
+	assert.EqualError(t, err, `GET /users/{ID}: no option for field Bdy type struct { Name string }, did you mean name Body?; register one with ByName("Bdy", ...) or ByType[struct { Name string }](...)`)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(
+		JSONResponse(),
+		PathByNameOfFixedTyped(strings.ToLower),
+		ByType(IntPathIDs()),
+		Get(func(ctx context.Context, in struct {
+			Users Fixed
+			ID    int
+		}) (string, error) {
+			return "", nil
+		}),
+	))
+
+	err := Validate(
+		PathByNameOfFixedTyped(strings.ToLower),
+		ByType(IntPathIDs()),
+		ByType(StringPathIDs()),
+		ByName("Body", JSONBody()),
+		Get(func(ctx context.Context, in struct {
+			Users Fixed
+			ID    int
+		}) (string, error) {
+			return "", nil
+		}),
+		JSONResponse(),
+		Get(func(ctx context.Context, in struct {
+			Users Fixed
+			ID    int
+		}) (string, error) {
+			return "", nil
+		}),
+		Get(func(ctx context.Context, in struct {
+			Users Fixed
+			Name  string
+			Posts Fixed
+		}) (string, error) {
+			return "", nil
+		}),
+	)
+	assert.EqualError(t, err, strings.Join([]string{
+		"GET /users/{ID} is registered more than once, only the last one is reachable",
+		"GET /users/{Name}/posts names the variable segment {Name} that other routes name {ID}",
+		"field option for name Body is not used by any route",
+	}, "\n"))
+
+	// routes fall back to a response encoder set after them, there is none here
+	err = Validate(
+		PathByNameOfFixedTyped(strings.ToLower),
+		Get(func(ctx context.Context, in struct {
+			Users Fixed
+		}) (string, error) {
+			return "", nil
+		}),
+	)
+	assert.EqualError(t, err, "GET /users: no response encoder for output string")
+}
+
+func TestNewJoinsErrors(t *testing.T) {
+	_, err := New(
+		JSONResponse(),
+		PathByNameOfFixedTyped(strings.ToLower),
+		TrustedProxies("not an address"),
+		Get(func(ctx context.Context, in struct {
+			Users Fixed
+			ID    int
+			Name  string
+		}) (string, error) {
+			return "", nil
+		}),
+	)
+	if !assert.Error(t, err) {
+		return
+	}
+	lines := strings.Split(err.Error(), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], `trusted proxy "not an address": `))
+	assert.Equal(t, []string{
+		"GET /users: no option for field ID type int; register one with ByName(\"ID\", ...) or ByType[int](...)",
+		"GET /users: no option for field Name type string; register one with ByName(\"Name\", ...) or ByType[string](...)",
+	}, lines[1:])
+}
+
+func TestRegisterMux(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	})
+	err := RegisterMux(mux,
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+			}) (string, error) {
+				return "users", nil
+			}),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (string, error) {
+				return strconv.Itoa(in.ID), nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("RegisterMux() error = %v", err)
+		return
+	}
+
+	for path, want := range map[string]string{"/users": `"users"`, "/users/5": `"5"`, "/health": "ok"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, want, strings.TrimSpace(w.Body.String()), path)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/other", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMount(t *testing.T) {
+	legacy := http.NewServeMux()
+	legacy.HandleFunc("GET /legacy/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "legacy "+r.PathValue("id"))
+	})
+	handler, err := New(
+		testOptions(
+			Mount("/legacy", legacy),
+			Get(func(ctx context.Context, in struct {
+				Legacy Fixed
+				Orders Fixed
+			}) (string, error) {
+				return "orders", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	for path, want := range map[string]string{"/legacy/users/3": "legacy 3", "/legacy/orders": `"orders"`} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, want, strings.TrimSpace(w.Body.String()), path)
+	}
+}
+
+func TestTenantsResponseCache(t *testing.T) {
+	calls := 0
+	handler, err := New(
+		testOptions(
+			Tenants(TenantHeader("X-Tenant"), func(ctx context.Context, id string) (Tenant, error) {
+				return Tenant{ID: id}, nil
+			}),
+			ResponseCache(NewMemoryCache(10), time.Minute),
+			Get(func(ctx context.Context, in struct {
+				Settings Fixed
+			}) (string, error) {
+				calls++
+				tenant, _ := TenantFromContext(ctx)
+				return tenant.ID + " settings", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(host, tenant string) string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "http://"+host+"/settings", nil)
+		r.Header.Set("X-Tenant", tenant)
+		handler(w, r)
+		return w.Body.String()
+	}
+	assert.Equal(t, `"acme settings"`+"\n", get("example.com", "acme"))
+	assert.Equal(t, `"tiny settings"`+"\n", get("example.com", "tiny"))
+	assert.Equal(t, `"acme settings"`+"\n", get("example.com", "acme"))
+	assert.Equal(t, 2, calls)
+	get("example.org", "acme")
+	assert.Equal(t, 3, calls, "hosts are cached separately")
+}
+
+func TestTenants(t *testing.T) {
+	lookup := func(ctx context.Context, id string) (Tenant, error) {
+		switch id {
+		case "acme":
+			return Tenant{ID: id, Tier: "enterprise"}, nil
+		case "tiny":
+			return Tenant{ID: id, Tier: "free"}, nil
+		}
+		return Tenant{}, WithStatus(http.StatusNotFound, errors.New("unknown tenant"))
+	}
+	handler, err := New(
+		testOptions(
+			Tenants(TenantPathPrefix(), lookup),
+			ByType(RequestTenant()),
+			Get(func(ctx context.Context, in struct {
+				Tenant Tenant
+				Users  Fixed
+			}) (string, error) {
+				return in.Tenant.ID + " users", nil
+			}),
+			Group(
+				ForTenantTiers("enterprise"),
+				Get(func(ctx context.Context, in struct {
+					Tenant Tenant
+					Audit  Fixed
+				}) (string, error) {
+					tenant, _ := TenantFromContext(ctx)
+					return tenant.ID + " audit", nil
+				}),
+			),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{path: "/acme/users", wantStatus: http.StatusOK, wantBody: `"acme users"`},
+		{path: "/tiny/users", wantStatus: http.StatusOK, wantBody: `"tiny users"`},
+		{path: "/acme/audit", wantStatus: http.StatusOK, wantBody: `"acme audit"`},
+		{path: "/tiny/audit", wantStatus: http.StatusNotFound, wantBody: "not found"},
+		{path: "/other/users", wantStatus: http.StatusNotFound, wantBody: `looking up tenant "other": unknown tenant`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", tt.path, nil))
+		assert.Equal(t, tt.wantStatus, w.Code, tt.path)
+		assert.Equal(t, tt.wantBody, strings.TrimSpace(w.Body.String()), tt.path)
+	}
+
+	handler, err = New(
+		testOptions(
+			Tenants(TenantSubdomain("example.com"), lookup),
+			ByType(RequestTenant()),
+			Get(func(ctx context.Context, in struct {
+				Users  Fixed
+				Tenant Tenant
+			}) (string, error) {
+				return in.Tenant.ID, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "http://acme.example.com/users", nil))
+	assert.Equal(t, `"acme"`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestFeatureFlag(t *testing.T) {
+	enabled := map[string]bool{}
+	opts := testOptions(
+		FeatureFlags(func(ctx context.Context, flag string) bool {
+			return enabled[flag]
+		}),
+		Group(
+			FeatureFlag("new-checkout", false),
+			Post(func(ctx context.Context, in struct {
+				Checkout Fixed
+			}) (string, error) {
+				return "checked out", nil
+			}),
+		),
+		Group(
+			FeatureFlag("reports", true),
+			Get(func(ctx context.Context, in struct {
+				Reports Fixed
+			}) (string, error) {
+				return "reports", nil
+			}),
+		),
+	)
+	handler, err := New(opts)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/checkout", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/reports", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	enabled["new-checkout"] = true
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/checkout", nil))
+	assert.Equal(t, `"checked out"`, strings.TrimSpace(w.Body.String()))
+
+	routes, err := Routes(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new-checkout", "reports"}, []string{routes[0].FeatureFlag, routes[1].FeatureFlag})
+}
+
+func TestVariant(t *testing.T) {
+	var variants []string
+	handler, err := New(
+		testOptions(
+			Middleware(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					variant, _ := VariantFromContext(r.Context())
+					variants = append(variants, variant)
+					next.ServeHTTP(w, r)
+				})
+			}),
+			Get(func(ctx context.Context, in struct {
+				Checkout Fixed
+			}) (string, error) {
+				return "control", nil
+			}),
+			Variant("one-click", 50, func(r *http.Request) string { return r.Header.Get("X-User") },
+				Get(func(ctx context.Context, in struct {
+					Checkout Fixed
+				}) (string, error) {
+					return "one-click", nil
+				}),
+			),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	counts := map[string]int{}
+	for i := range 200 {
+		req := httptest.NewRequest("GET", "/checkout", nil)
+		req.Header.Set("X-User", strconv.Itoa(i))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		first := w.Body.String()
+		w = httptest.NewRecorder()
+		handler(w, req)
+		assert.Equal(t, first, w.Body.String(), "variant must be deterministic")
+		counts[strings.TrimSpace(first)]++
+	}
+	assert.InDelta(t, 100, counts[`"one-click"`], 30)
+	assert.InDelta(t, 100, counts[`"control"`], 30)
+	assert.Equal(t, 400, len(variants))
+	assert.Equal(t, 2*counts[`"one-click"`], len(slices.DeleteFunc(variants, func(v string) bool { return v == "" })))
+
+	_, err = New(testOptions(Variant("orphan", 10, func(r *http.Request) string { return "" },
+		Get(func(ctx context.Context, in struct{ Checkout Fixed }) (string, error) { return "", nil }),
+	)))
+	assert.EqualError(t, err, "variant orphan: no route GET /checkout to split traffic with")
+
+	for _, percent := range []int{-1, 101} {
+		_, err = New(testOptions(Variant("invalid", percent, func(r *http.Request) string { return "" })))
+		assert.EqualError(t, err, fmt.Sprintf("variant invalid: percent %d is not between 0 and 100", percent))
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	maintenance := &Maintenance{}
+	handler, err := New(
+		testOptions(
+			MaintenanceMode(maintenance),
+			Get(func(ctx context.Context, in struct {
+				Orders Fixed
+			}) (string, error) {
+				return "orders", nil
+			}),
+			Group(
+				MaintenanceMode(nil),
+				Get(func(ctx context.Context, in struct {
+					Health Fixed
+				}) (string, error) {
+					return "ok", nil
+				}),
+			),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get("/orders").Code)
+	maintenance.Enable(2 * time.Minute)
+	w := get("/orders")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "120", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, get("/health").Code)
+	maintenance.Disable()
+	assert.Equal(t, http.StatusOK, get("/orders").Code)
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	handler, err := New(
+		testOptions(
+			MaxConcurrent(1, 1, 50*time.Millisecond),
+			Get(func(ctx context.Context, in struct {
+				Reports Fixed
+			}) (string, error) {
+				started <- struct{}{}
+				<-release
+				return "report", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	codes := make(chan int, 3)
+	get := func() {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/reports", nil))
+		codes <- w.Code
+	}
+
+	go get()
+	<-started
+	go get() // queued
+	time.Sleep(10 * time.Millisecond)
+	get() // queue full
+	assert.Equal(t, http.StatusTooManyRequests, <-codes)
+	assert.Equal(t, http.StatusTooManyRequests, <-codes, "queued request times out")
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-codes)
+
+	go get()
+	<-started
+	assert.Equal(t, http.StatusOK, <-codes)
+}
+
+func TestBulkhead(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler, err := New(
+		testOptions(
+			Bulkhead(1),
+			Get(func(ctx context.Context, in struct {
+				Reports Fixed
+			}) (string, error) {
+				started <- struct{}{}
+				<-release
+				return "report", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	codes := make(chan int, 2)
+	go func() {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/reports", nil))
+		codes <- w.Code
+	}()
+	<-started
+
+	// further requests are rejected right away instead of queueing
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/reports", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-codes)
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/reports", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		policy     ResponseLimitPolicy
+		size       int
+		wantStatus int
+		wantLength string
+		violations int
+	}{
+		{name: "small", policy: ResponseLimitError, size: 10, wantStatus: http.StatusOK, wantLength: "13"},
+		{name: "error", policy: ResponseLimitError, size: 100, wantStatus: http.StatusInternalServerError, violations: 1},
+		{name: "stream", policy: ResponseLimitStream, size: 100, wantStatus: http.StatusOK, violations: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := 0
+			handler, err := New(
+				testOptions(
+					MaxResponseBytes(50, tt.policy, func(ctx context.Context, info RouteInfo) {
+						violations++
+					}),
+					Get(func(ctx context.Context, in struct {
+						Export Fixed
+					}) (string, error) {
+						return strings.Repeat("a", tt.size), nil
+					}),
+				),
+			)
+			if err != nil {
+				t.Errorf("New() error = %v", err)
+				return
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "/export", nil))
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantLength, w.Header().Get("Content-Length"))
+			assert.Equal(t, tt.violations, violations)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, `"`+strings.Repeat("a", tt.size)+`"`, strings.TrimSpace(w.Body.String()))
+			}
+		})
+	}
+}
+
+func TestMaxResponseBytesFlush(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		policy     ResponseLimitPolicy
+		size       int
+		wantLength string
+		flushed    bool
+		violations int
+	}{
+		{name: "error", policy: ResponseLimitError, size: 10, wantLength: "11"},
+		{name: "stream", policy: ResponseLimitStream, size: 10, flushed: true},
+		{name: "stream exceeded", policy: ResponseLimitStream, size: 100, flushed: true, violations: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := 0
+			handler, err := New(
+				testOptions(
+					MaxResponseBytes(50, tt.policy, func(ctx context.Context, info RouteInfo) {
+						violations++
+					}),
+					ResponseEncoder(func(ctx context.Context, w http.ResponseWriter, v any) error {
+						w.Header().Set("Content-Type", "text/plain")
+						_, _ = w.Write([]byte("a"))
+						_ = http.NewResponseController(w).Flush()
+						_, err := w.Write([]byte(v.(string)))
+						return err
+					}),
+					Get(func(ctx context.Context, in struct {
+						Export Fixed
+					}) (string, error) {
+						return strings.Repeat("b", tt.size), nil
+					}),
+				),
+			)
+			if err != nil {
+				t.Errorf("New() error = %v", err)
+				return
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "/export", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantLength, w.Header().Get("Content-Length"))
+			assert.Equal(t, tt.flushed, w.Flushed)
+			assert.Equal(t, tt.violations, violations)
+			assert.Equal(t, "a"+strings.Repeat("b", tt.size), w.Body.String())
+		})
+	}
+}
+
+func TestYAML(t *testing.T) {
+	type config struct {
+		Name     string `yaml:"name" json:"name"`
+		Replicas int    `yaml:"replicas" json:"replicas"`
+	}
+	handler, err := New(
+		NegotiatedResponse(),
+		ByName("Body", NegotiatedBody()),
+		PathByNameOfFixedTyped(strings.ToLower),
+		Put(func(ctx context.Context, in struct {
+			Configs Fixed
+			Body    config
+		}) (config, error) {
+			in.Body.Replicas++
+			return in.Body, nil
+		}),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	req := httptest.NewRequest("PUT", "/configs", strings.NewReader("name: web\nreplicas: 2\n"))
+	req.Header.Set("Content-Type", "application/yaml")
+	req.Header.Set("Accept", "application/yaml")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, "application/yaml", w.Header().Get("Content-Type"))
+	assert.Equal(t, "name: web\nreplicas: 3\n", w.Body.String())
+
+	req = httptest.NewRequest("PUT", "/configs", strings.NewReader(`{"name":"web","replicas":2}`))
+	req.Header.Set("Accept", "application/json, application/yaml")
+	w = httptest.NewRecorder()
+	handler(w, req)
+	assert.JSONEq(t, `{"name":"web","replicas":3}`, w.Body.String())
+}
+
+func TestJSONSchemaBody(t *testing.T) {
+	type item struct {
+		SKU      string `json:"sku"`
+		Quantity int    `json:"quantity"`
+	}
+	type order struct {
+		Customer string  `json:"customer"`
+		Note     *string `json:"note"`
+		Items    []item  `json:"items"`
+	}
+	minLength := 3
+	handler, err := New(
+		JSONResponse(),
+		PathByNameOfFixedTyped(strings.ToLower),
+		ByName("Body", JSONSchemaBody(nil)),
+		Post(func(ctx context.Context, in struct {
+			Orders Fixed
+			Body   order
+		}) (int, error) {
+			return len(in.Body.Items), nil
+		}),
+		ByName("Body", JSONSchemaBody(&Schema{
+			Type:       SchemaType{"object"},
+			Properties: map[string]*Schema{"name": {Type: SchemaType{"string"}, MinLength: &minLength}},
+			Required:   []string{"name"},
+		})),
+		Post(func(ctx context.Context, in struct {
+			Tags Fixed
+			Body map[string]any
+		}) (string, error) {
+			return in.Body["name"].(string), nil
+		}),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	tests := []struct {
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{path: "/orders", body: `{"customer":"ada","items":[{"sku":"a","quantity":2}]}`, wantStatus: http.StatusOK, wantBody: "1"},
+		{path: "/orders", body: `{"customer":1,"items":[{"sku":"a","quantity":2.5},{"sku":"b"}],"extra":true}`, wantStatus: http.StatusBadRequest, wantBody: strings.Join([]string{
+			"applying input option: /customer: must be of type string",
+			"/extra: is not allowed",
+			"/items/0/quantity: must be of type integer",
+			`/items/1: missing required property "quantity"`,
+		}, "\n")},
+		{path: "/tags", body: `{"name":"go"}`, wantStatus: http.StatusBadRequest, wantBody: "applying input option: /name: must be at least 3 characters long"},
+		{path: "/tags", body: `{"name":"golang"}`, wantStatus: http.StatusOK, wantBody: `"golang"`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+		assert.Equal(t, tt.wantStatus, w.Code, tt.body)
+		assert.Equal(t, tt.wantBody, strings.TrimSpace(w.Body.String()), tt.body)
+	}
+}
+
+func TestSchemaFor(t *testing.T) {
+	type node struct {
+		Name     string    `json:"name"`
+		Tags     []string  `json:"tags,omitempty"`
+		Created  time.Time `json:"created"`
+		Parent   *node     `json:"parent"`
+		internal int
+	}
+	schema, err := json.Marshal(SchemaFor(reflect.TypeFor[node]()))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"tags": {"type": ["array", "null"], "items": {"type": "string"}},
+			"created": {"type": "string", "format": "date-time"},
+			"parent": {}
+		},
+		"required": ["name", "created"],
+		"additionalProperties": {"not": {}}
+	}`, string(schema))
+
+	routes, err := Routes(testOptions(Get(func(ctx context.Context, in struct {
+		Nodes Fixed
+		ID    int
+	}) (node, error) {
+		return node{}, nil
+	})))
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaFor(reflect.TypeFor[node]()), routes[0].OutputSchema())
+	assert.Equal(t, SchemaType{"integer"}, routes[0].InputSchema().Properties["ID"].Type)
+}
+
+type orderStatus string
+
+func (orderStatus) EnumValues() []string {
+	return []string{"open", "closed"}
+}
+
+func TestEnum(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			ByType(PathID(func(id string, v *orderStatus) error {
+				*v = orderStatus(id)
+				return nil
+			}), Enum[orderStatus]("open", "closed")),
+			Get(func(ctx context.Context, in struct {
+				Orders Fixed
+				Status orderStatus
+			}) (string, error) {
+				return string(in.Status), nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/orders/open", nil))
+	assert.Equal(t, `"open"`, strings.TrimSpace(w.Body.String()))
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/orders/lost", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `applying input option: Status "lost" is not one of open, closed`, strings.TrimSpace(w.Body.String()))
+
+	schema := SchemaFor(reflect.TypeFor[struct {
+		Status   orderStatus `json:"status"`
+		Priority string      `json:"priority" enum:"low,high"`
+	}]())
+	assert.Equal(t, []any{"open", "closed"}, schema.Properties["status"].Enum)
+	assert.Equal(t, []any{"low", "high"}, schema.Properties["priority"].Enum)
+}
+
+func TestSlugPathIDs(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			ByType(SlugPathIDs()),
+			Get(func(ctx context.Context, in struct {
+				Posts Fixed
+				Slug  Slug
+			}) (Slug, error) {
+				return in.Slug, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	for path, want := range map[string]string{
+		"/posts/Hello-World":      `"hello-world"`,
+		"/posts/gr%C3%BC%C3%9Fe":  `"grüße"`,
+		"/posts/gru%CC%88%C3%9Fe": `"grüße"`,
+		"/posts/q%CC%88":          "400",
+		"/posts/hello--world":     "400",
+		"/posts/hello_world":      "400",
+		"/posts/-hello":           "400",
+	} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			assert.Equal(t, want, strconv.Itoa(w.Code), path)
+			continue
+		}
+		assert.Equal(t, want, strings.TrimSpace(w.Body.String()), path)
+	}
+}
+
+func TestCompositePathID(t *testing.T) {
+	type objectKey string
+	handler, err := New(
+		testOptions(
+			ByType(CompositePathID(3, func(segments []string, v *time.Time) error {
+				date, err := time.Parse("2006/01/02", strings.Join(segments, "/"))
+				if err != nil {
+					return WithStatus(http.StatusBadRequest, err)
+				}
+				*v = date
+				return nil
+			})),
+			ByType(CompositePathID(-1, func(segments []string, v *objectKey) error {
+				*v = objectKey(strings.Join(segments, "/"))
+				return nil
+			})),
+			Get(func(ctx context.Context, in struct {
+				Archive Fixed
+				Day     time.Time
+			}) (string, error) {
+				return in.Day.Format(time.DateOnly), nil
+			}),
+			Get(func(ctx context.Context, in struct {
+				Files  Fixed
+				Bucket string
+				Key    objectKey
+			}) (string, error) {
+				return in.Bucket + ":" + string(in.Key), nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	for path, want := range map[string]string{
+		"/archive/2024/05/17":         `"2024-05-17"`,
+		"/files/media/img/2024/a.png": `"media:img/2024/a.png"`,
+		"/files/media/a.png":          `"media:a.png"`,
+	} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, want, strings.TrimSpace(w.Body.String()), path)
+	}
+
+	for path, want := range map[string]int{"/archive/2024/05": http.StatusNotFound, "/archive/2024/13/01": http.StatusBadRequest, "/files/media": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, want, w.Code, path)
+	}
+
+	routes, err := Routes(testOptions(
+		ByType(CompositePathID(-1, func(segments []string, v *objectKey) error { return nil })),
+		Get(func(ctx context.Context, in struct {
+			Files Fixed
+			Key   objectKey
+		}) (string, error) {
+			return "", nil
+		}),
+	))
+	assert.NoError(t, err)
+	assert.Equal(t, "/files/{Key...}", routes[0].Pattern)
+}
+
+func TestMatrixParams(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			MatrixParams(),
+			ByName("Filter", Matrix()),
+			ByName("Params", Matrix()),
+			Get(func(ctx context.Context, in struct {
+				Items  Fixed
+				Filter struct {
+					Color string
+					Size  string
+				}
+			}) (string, error) {
+				return in.Filter.Color + " " + in.Filter.Size, nil
+			}),
+			Get(func(ctx context.Context, in struct {
+				Cars   Fixed
+				ID     int
+				Params url.Values
+			}) (string, error) {
+				return fmt.Sprintf("%d %s", in.ID, in.Params.Get("year")), nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	for path, want := range map[string]string{
+		"/items;color=red;size=m": `"red m"`,
+		"/items":                  "applying input option: field Color: no value",
+		"/cars/7;year=2012":       `"7 2012"`,
+	} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, want, strings.TrimSpace(w.Body.String()), path)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	key := []byte("secret")
+	handler, err := New(
+		testOptions(
+			ByType(CursorQuery(key, "after")),
+			Get(func(ctx context.Context, in struct {
+				Events Fixed
+				After  Cursor
+			}) (Page[string], error) {
+				next := Cursor("event-" + strconv.Itoa(len(in.After)))
+				return Page[string]{Items: []string{string(in.After)}, NextCursor: next.Encode(key)}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/events", nil))
+	var page Page[string]
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, []string{""}, page.Items)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/events?after="+page.NextCursor, nil))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, []string{"event-0"}, page.Items)
+
+	forged := base64.RawURLEncoding.EncodeToString(append([]byte("event-9"), make([]byte, 16)...))
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/events?after="+forged, nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSignedURLs(t *testing.T) {
+	key := []byte("secret")
+	handler, err := New(
+		testOptions(
+			SignedURLs(key),
+			Get(func(ctx context.Context, in struct {
+				Downloads Fixed
+				ID        int
+			}) (string, error) {
+				return "file " + strconv.Itoa(in.ID), nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	signed, err := SignURL(key, time.Now().Add(time.Minute), "/downloads/{ID}", 7)
+	assert.NoError(t, err)
+	assert.Equal(t, `"file 7"`, strings.TrimSpace(get(signed).Body.String()))
+
+	assert.Equal(t, http.StatusForbidden, get("/downloads/7").Code)
+	assert.Equal(t, http.StatusForbidden, get(strings.Replace(signed, "/7?", "/8?", 1)).Code)
+
+	expired, err := SignURL(key, time.Now().Add(-time.Minute), "/downloads/{ID}", 7)
+	assert.NoError(t, err)
+	assert.Equal(t, "URL expired", strings.TrimSpace(get(expired).Body.String()))
+
+	withQuery, err := SignPath(key, time.Now().Add(time.Minute), "/downloads/7?inline=1")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get(withQuery).Code)
+	assert.Equal(t, http.StatusForbidden, get(withQuery+"&inline=0").Code)
+}
+
+func TestVersionedJSONBody(t *testing.T) {
+	type userV1 struct {
+		Name string `json:"name"`
+	}
+	type userV2 struct {
+		First string `json:"first"`
+		Last  string `json:"last"`
+	}
+	type user struct {
+		First string `json:"first"`
+		Last  string `json:"last"`
+		Email string `json:"email"`
+	}
+	migrations := []BodyMigration{
+		MigrateBody("1", func(old userV1) (userV2, error) {
+			first, last, ok := strings.Cut(old.Name, " ")
+			if !ok {
+				return userV2{}, errors.New("name needs first and last name")
+			}
+			return userV2{First: first, Last: last}, nil
+		}),
+		MigrateBody("2", func(old userV2) (user, error) {
+			return user{First: old.First, Last: old.Last}, nil
+		}),
+	}
+	handler, err := New(
+		JSONResponse(),
+		ByName("Body", VersionedJSONBody("Api-Version", "3", migrations...)),
+		PathByNameOfFixedTyped(strings.ToLower),
+		Post(func(ctx context.Context, in struct {
+			Users Fixed
+			Body  user
+		}) (user, error) {
+			return in.Body, nil
+		}),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	post := func(version, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/users", strings.NewReader(body))
+		if version != "" {
+			req.Header.Set("Api-Version", version)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+	assert.JSONEq(t, `{"first":"Ada","last":"Lovelace","email":""}`, post("1", `{"name":"Ada Lovelace"}`).Body.String())
+	assert.JSONEq(t, `{"first":"Ada","last":"Lovelace","email":""}`, post("2", `{"first":"Ada","last":"Lovelace"}`).Body.String())
+	assert.JSONEq(t, `{"first":"Ada","last":"Lovelace","email":"ada@example.com"}`, post("", `{"first":"Ada","last":"Lovelace","email":"ada@example.com"}`).Body.String())
+	assert.JSONEq(t, `{"first":"Ada","last":"Lovelace","email":"ada@example.com"}`, post("3", `{"first":"Ada","last":"Lovelace","email":"ada@example.com"}`).Body.String())
+	assert.Equal(t, http.StatusBadRequest, post("1", `{"name":"Ada"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post("0", `{}`).Code)
+
+	_, err = New(
+		ByName("Body", VersionedJSONBody("Api-Version", "3", migrations[0])),
+		PathByNameOfFixedTyped(strings.ToLower),
+		Post(func(ctx context.Context, in struct {
+			Users Fixed
+			Body  user
+		}) (user, error) {
+			return in.Body, nil
+		}),
+	)
+	assert.ErrorContains(t, err, "migration of Body version 1 does not lead to")
+	_, err = New(
+		ByName("Body", VersionedJSONBody("Api-Version", "2", migrations...)),
+		PathByNameOfFixedTyped(strings.ToLower),
+		Post(func(ctx context.Context, in struct {
+			Users Fixed
+			Body  user
+		}) (user, error) {
+			return in.Body, nil
+		}),
+	)
+	assert.ErrorContains(t, err, "migration of Body version 2 is the current version")
+}
+
+func TestRedactScopes(t *testing.T) {
+	type address struct {
+		City   string `json:"city"`
+		Street string `json:"street" scope:"admin,support"`
+	}
+	type user struct {
+		Name      string    `json:"name"`
+		Email     string    `json:"email" scope:"admin"`
+		Addresses []address `json:"addresses"`
+		Manager   *address  `json:"manager,omitempty"`
+	}
+	handler, err := New(
+		testOptions(
+			RedactScopes(func(r *http.Request) []string {
+				return strings.Split(r.Header.Get("Scopes"), ",")
+			}),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (user, error) {
+				return user{
+					Name:      "ada",
+					Email:     "ada@example.com",
+					Addresses: []address{{City: "London", Street: "Baker Street"}},
+					Manager:   &address{City: "Paris", Street: "Rue de Rivoli"},
+				}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(scopes string) string {
+		req := httptest.NewRequest("GET", "/users/1", nil)
+		req.Header.Set("Scopes", scopes)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Body.String()
+	}
+	assert.JSONEq(t, `{"name":"ada","addresses":[{"city":"London"}],"manager":{"city":"Paris"}}`, get(""))
+	assert.JSONEq(t, `{"name":"ada","addresses":[{"city":"London","street":"Baker Street"}],"manager":{"city":"Paris","street":"Rue de Rivoli"}}`, get("support"))
+	assert.JSONEq(t, `{"name":"ada","email":"ada@example.com","addresses":[{"city":"London","street":"Baker Street"}],"manager":{"city":"Paris","street":"Rue de Rivoli"}}`, get("admin"))
+}
+
+func TestIfMatch(t *testing.T) {
+	type document struct {
+		Text string `json:"text"`
+	}
+	stored := Versioned[document]{Version: "1", Value: document{Text: "draft"}}
+	handler, err := New(
+		testOptions(
+			ByType(IfMatch(true)),
+			ByName("Body", JSONBody()),
+			Put(func(ctx context.Context, in struct {
+				Documents Fixed
+				ID        int
+				Version   Version
+				Body      document
+			}) (Versioned[document], error) {
+				if err := in.Version.Check(stored.Version); err != nil {
+					return Versioned[document]{}, err
+				}
+				stored = Versioned[document]{Version: stored.Version + "1", Value: in.Body}
+				return stored, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	put := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/documents/1", strings.NewReader(`{"text":"final"}`))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	w := put(`"1"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"11"`, w.Header().Get("ETag"))
+	assert.JSONEq(t, `{"text":"final"}`, w.Body.String())
+
+	assert.Equal(t, http.StatusPreconditionFailed, put(`"1"`).Code)
+	assert.Equal(t, http.StatusPreconditionRequired, put("").Code)
+	assert.Equal(t, http.StatusBadRequest, put(`W/"11"`).Code)
+	assert.Equal(t, http.StatusOK, put("*").Code)
+}
+
+func TestBatch(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+	handler, err := New(
+		testOptions(
+			Batch("/batch", 3),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (user, error) {
+				return user{Name: "user " + strconv.Itoa(in.ID)}, nil
+			}),
+			Post(func(ctx context.Context, in struct {
+				Users Fixed
+				Body  user
+			}) (user, error) {
+				return in.Body, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", "/batch", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`[
+		{"method":"GET","path":"/users/1"},
+		{"method":"POST","path":"/users","body":{"name":"ada"}},
+		{"method":"GET","path":"/batch"}
+	]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var responses []BatchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &responses))
+	if assert.Len(t, responses, 3) {
+		assert.Equal(t, http.StatusOK, responses[0].Status)
+		assert.JSONEq(t, `{"name":"user 1"}`, string(responses[0].Body))
+		assert.JSONEq(t, `{"name":"ada"}`, string(responses[1].Body))
+		assert.Equal(t, http.StatusBadRequest, responses[2].Status)
+		assert.JSONEq(t, `"nested batch"`, string(responses[2].Body))
+	}
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(`[{},{},{},{}]`).Code)
+}
+
+func TestAsync(t *testing.T) {
+	type report struct {
+		Rows int `json:"rows"`
+	}
+	release := make(chan struct{})
+	jobs := NewJobs(&MemoryJobStore{}, 1, 1)
+	defer jobs.Close()
+	var handled error
+	handler, err := New(
+		testOptions(
+			HandleError(func(ctx context.Context, w http.ResponseWriter, err error) {
+				handled = err
+				http.Error(w, http.StatusText(StatusCode(err)), StatusCode(err))
+			}),
+			AsyncJobs("/jobs", jobs),
+			Post(Async(jobs, func(ctx context.Context, in struct {
+				Reports Fixed
+				Body    report
+			}) (report, error) {
+				<-release
+				if in.Body.Rows < 0 {
+					return report{}, WithStatus(http.StatusBadRequest, Messagef("negative rows"))
+				}
+				if in.Body.Rows == 0 {
+					panic("no rows")
+				}
+				return report{Rows: in.Body.Rows * 2}, nil
+			})),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	await := func(location string) Job {
+		var job Job
+		assert.Eventually(t, func() bool {
+			_ = json.Unmarshal(serve("GET", location, "").Body.Bytes(), &job)
+			return job.Status == JobSucceeded || job.Status == JobFailed
+		}, time.Second, time.Millisecond)
+		return job
+	}
+
+	w := serve("POST", "/reports", `{"rows":21}`)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	location := w.Header().Get("Location")
+	assert.Regexp(t, `^/jobs/[0-9a-f]{32}$`, location)
+	assert.Equal(t, http.StatusAccepted, serve("GET", location+"/result", "").Code)
+
+	release <- struct{}{}
+	assert.Equal(t, JobSucceeded, await(location).Status)
+	w = serve("GET", location+"/result", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"rows":42}`, w.Body.String())
+
+	location = serve("POST", "/reports", `{"rows":-1}`).Header().Get("Location")
+	release <- struct{}{}
+	assert.Equal(t, "negative rows", await(location).Error)
+	assert.Equal(t, http.StatusBadRequest, serve("GET", location+"/result", "").Code)
+
+	location = serve("POST", "/reports", `{"rows":0}`).Header().Get("Location")
+	release <- struct{}{}
+	job := await(location)
+	assert.Equal(t, JobFailed, job.Status)
+	assert.Equal(t, "Internal Server Error", job.Error, "internals don't reach clients")
+	assert.Equal(t, http.StatusInternalServerError, serve("GET", location+"/result", "").Code)
+	var panicErr *PanicError
+	assert.ErrorAs(t, handled, &panicErr, "the error handler gets the error of the job")
+
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/jobs/unknown", "").Code)
+}
+
+func TestDedupe(t *testing.T) {
+	calls := 0
+	handler, err := New(
+		testOptions(
+			Dedupe(time.Minute, func(r *http.Request) string {
+				return r.Header.Get("User")
+			}, func(r *http.Request) string {
+				return r.Header.Get("Request-Id")
+			}),
+			Post(func(ctx context.Context, in struct {
+				Payments Fixed
+			}) (int, error) {
+				calls++
+				if calls == 2 {
+					return 0, errors.New("unavailable")
+				}
+				return calls, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	post := func(target, user, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", target, nil)
+		req.Header.Set("User", user)
+		req.Header.Set("Request-Id", id)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	assert.Equal(t, "1\n", post("/payments", "alice", "a").Body.String())
+	w := post("/payments", "alice", "a")
+	assert.Equal(t, "1\n", w.Body.String())
+	assert.Equal(t, "true", w.Header().Get("X-Deduplicated"))
+	assert.Equal(t, 1, calls)
+
+	assert.Equal(t, http.StatusInternalServerError, post("/payments", "alice", "b").Code)
+	assert.Equal(t, "3\n", post("/payments", "alice", "b").Body.String())
+	assert.Equal(t, "4\n", post("/payments", "alice", "").Body.String())
+	assert.Equal(t, "5\n", post("/payments", "alice", "").Body.String())
+
+	w = post("/payments", "bob", "a")
+	assert.Equal(t, "6\n", w.Body.String())
+	assert.Empty(t, w.Header().Get("X-Deduplicated"))
+	assert.Equal(t, "7\n", post("/payments?retry=1", "alice", "a").Body.String())
+	assert.Equal(t, "8\n", post("/payments", "", "a").Body.String())
+	assert.Equal(t, "9\n", post("/payments", "", "a").Body.String())
+
+	_, err = New(testOptions(Dedupe(time.Minute, nil, func(r *http.Request) string { return "" })))
+	assert.ErrorContains(t, err, "Dedupe requires a principal and a key func")
+}
+
+func TestAfterCommit(t *testing.T) {
+	type tx struct{}
+	var events []string
+	handler, err := New(
+		testOptions(
+			ByType(ClosableRequestValue(func(r *http.Request, v **tx) (func(error) error, error) {
+				return func(err error) error {
+					if err != nil {
+						return nil
+					}
+					if r.Header.Get("Commit") == "fail" {
+						return errors.New("commit failed")
+					}
+					events = append(events, "commit")
+					return nil
+				}, nil
+			})),
+			AfterCommit(func(ctx context.Context, info RouteInfo, input, output any) {
+				events = append(events, fmt.Sprintf("%s %s %v", info.Method, info.Pattern, output))
+			}),
+			Post(func(ctx context.Context, in struct {
+				Orders Fixed
+				Tx     *tx
+				Body   string
+			}) (string, error) {
+				if in.Body == "invalid" {
+					return "", WithStatus(http.StatusBadRequest, errors.New("invalid order"))
+				}
+				return "created " + in.Body, nil
+			}),
+			Delete(func(ctx context.Context, in struct {
+				Orders Fixed
+				ID     int
+				Tx     *tx
+			}) (string, error) {
+				return "", ErrNoContent
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	post := func(body, commit string) {
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(strconv.Quote(body)))
+		req.Header.Set("Commit", commit)
+		handler(httptest.NewRecorder(), req)
+	}
+	post("book", "")
+	post("invalid", "")
+	post("pen", "fail")
+	assert.Equal(t, []string{"commit", "POST /orders created book"}, events)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("DELETE", "/orders/7", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"commit", "POST /orders created book", "commit", "DELETE /orders/{ID} <nil>"}, events)
+}
+
+func TestTracing(t *testing.T) {
+	type spanKey struct{}
+	var spans []string
+	tracer := TracerFunc(func(ctx context.Context, name string) (context.Context, func(error)) {
+		if parent, ok := ctx.Value(spanKey{}).(string); ok {
+			name = parent + " > " + name
+		}
+		return context.WithValue(ctx, spanKey{}, name), func(err error) {
+			if err != nil {
+				name += ": " + err.Error()
+			}
+			spans = append(spans, name)
+		}
+	})
+	handler, err := New(
+		testOptions(
+			Tracing(tracer),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (string, error) {
+				if in.ID == 0 {
+					return "", errors.New("no user")
+				}
+				return "user", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/1", nil))
+	assert.Equal(t, []string{
+		"GET /users/{ID} > bind",
+		"GET /users/{ID} > handle",
+		"GET /users/{ID} > encode",
+		"GET /users/{ID}",
+	}, spans)
+
+	spans = nil
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/0", nil))
+	assert.Equal(t, []string{
+		"GET /users/{ID} > bind",
+		"GET /users/{ID} > handle: no user",
+		"GET /users/{ID}: handling request: no user",
+	}, spans)
+}
+
+func TestPanicError(t *testing.T) {
+	var handled error
+	handler, err := New(
+		testOptions(
+			HandleError(func(ctx context.Context, w http.ResponseWriter, err error) {
+				handled = err
+				w.WriteHeader(StatusCode(err))
+			}),
+			Get(func(ctx context.Context, in struct {
+				Items Fixed
+				ID    int
+			}) (string, error) {
+				switch in.ID {
+				case 1:
+					panic(WithStatus(http.StatusConflict, io.ErrUnexpectedEOF))
+				case 2:
+					panic(orderStatus("corrupt"))
+				}
+				return "item", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/items/1", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.ErrorIs(t, handled, io.ErrUnexpectedEOF)
+	var panicErr *PanicError
+	if assert.ErrorAs(t, handled, &panicErr) {
+		assert.Contains(t, string(panicErr.Stack), "TestPanicError")
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/items/2", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	if assert.ErrorAs(t, handled, &panicErr) {
+		assert.Equal(t, orderStatus("corrupt"), panicErr.Value)
+		assert.EqualError(t, panicErr, "panic: corrupt")
+	}
+}
+
+func TestResponseCommitted(t *testing.T) {
+	var committed []bool
+	handler, err := New(
+		testOptions(
+			ResponseEncoder(func(ctx context.Context, w http.ResponseWriter, v any) error {
+				if v == "partial" {
+					_, _ = w.Write([]byte(`{"items":[`))
+				}
+				return errors.New("encoding failed")
+			}),
+			HandleError(func(ctx context.Context, w http.ResponseWriter, err error) {
+				committed = append(committed, ResponseCommitted(w))
+			}),
+			Get(func(ctx context.Context, in struct {
+				Items Fixed
+				Kind  string
+			}) (string, error) {
+				return in.Kind, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/items/empty", nil))
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/items/partial", nil))
+	assert.Equal(t, []bool{false, true}, committed)
+
+	// flushes refused while MaxResponseBytes buffers the response don't commit it
+	committed = nil
+	handler, err = New(
+		testOptions(
+			MaxResponseBytes(100, ResponseLimitError, nil),
+			ResponseEncoder(func(ctx context.Context, w http.ResponseWriter, v any) error {
+				_ = http.NewResponseController(w).Flush()
+				return errors.New("encoding failed")
+			}),
+			HandleError(func(ctx context.Context, w http.ResponseWriter, err error) {
+				committed = append(committed, ResponseCommitted(w))
+			}),
+			Get(func(ctx context.Context, in struct {
+				Items Fixed
+			}) (string, error) {
+				return "", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/items", nil))
+	assert.Equal(t, []bool{false}, committed)
+
+	for name, errorHandler := range map[string]Option{
+		"problem details": ProblemDetails(),
+		"dev mode":        DevMode(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			handler, err := New(
+				testOptions(
+					errorHandler,
+					ResponseEncoder(func(ctx context.Context, w http.ResponseWriter, v any) error {
+						_, _ = w.Write([]byte(`{"items":[`))
+						return errors.New("encoding failed")
+					}),
+					Get(func(ctx context.Context, in struct {
+						Items Fixed
+					}) (string, error) {
+						return "", nil
+					}),
+				),
+			)
+			if err != nil {
+				t.Errorf("New() error = %v", err)
+				return
+			}
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "/items", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, `{"items":[`, w.Body.String())
+		})
+	}
+}
+
+type csvReport string
+
+func (csvReport) ContentType() string { return "text/csv; charset=utf-8" }
+
+func TestContentType(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+			}) (string, error) {
+				return "<html>", nil
+			}),
+			Get(func(ctx context.Context, in struct {
+				Reports Fixed
+			}) (csvReport, error) {
+				return "a,b", nil
+			}),
+			ResponseEncoder(func(ctx context.Context, w http.ResponseWriter, v any) error {
+				_, err := fmt.Fprint(w, v)
+				return err
+			}),
+			ContentType("text/plain; charset=utf-8"),
+			Get(func(ctx context.Context, in struct {
+				Notes Fixed
+			}) (string, error) {
+				return "<html>", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	for path, contentType := range map[string]string{
+		"/users":   "application/json; charset=utf-8",
+		"/reports": "text/csv; charset=utf-8",
+		"/notes":   "text/plain; charset=utf-8",
+	} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, contentType, w.Header().Get("Content-Type"), path)
+	}
+}
+
+func TestRereadableBody(t *testing.T) {
+	type event struct {
+		Type string `json:"type"`
+	}
+	key := []byte("secret")
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	handler, err := New(
+		testOptions(
+			RereadableBody(64),
+			ByName("Signature", RequestValue(func(r *http.Request, v any) error {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					return err
+				}
+				if r.Header.Get("Signature") != sign(string(body)) {
+					return WithStatus(http.StatusUnauthorized, errors.New("invalid signature"))
+				}
+				return nil
+			})),
+			Post(func(ctx context.Context, in struct {
+				Webhooks  Fixed
+				Signature struct{}
+				Body      event
+			}) (string, error) {
+				return in.Body.Type, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	post := func(body, signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/webhooks", strings.NewReader(body))
+		req.Header.Set("Signature", signature)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+	body := `{"type":"push"}`
+	assert.Equal(t, `"push"`+"\n", post(body, sign(body)).Body.String())
+	assert.Equal(t, http.StatusUnauthorized, post(body, sign("{}")).Code)
+
+	large := `{"type":"push","padding":"` + strings.Repeat("x", 64) + `"}`
+	assert.Contains(t, post(large, sign(large)).Body.String(), "EOF")
+}
+
+func TestParallel(t *testing.T) {
+	type user struct{ Name string }
+	type tenant struct{ ID string }
+	started := make(chan struct{}, 2)
+	// rendezvous only returns in time if the other field is bound concurrently
+	rendezvous := func() error {
+		started <- struct{}{}
+		deadline := time.Now().Add(time.Second)
+		for len(started) < 2 {
+			if time.Now().After(deadline) {
+				return errors.New("fields were bound sequentially")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	}
+	handler, err := New(
+		testOptions(
+			ByType(Parallel(RequestValue(func(r *http.Request, v *user) error {
+				if err := rendezvous(); err != nil {
+					return err
+				}
+				if r.Header.Get("Authorization") == "" {
+					return WithStatus(http.StatusUnauthorized, errors.New("unauthorized"))
+				}
+				v.Name = "ada"
+				return nil
+			}))),
+			ByType(Parallel(RequestValue(func(r *http.Request, v *tenant) error {
+				v.ID = "acme"
+				return rendezvous()
+			}))),
+			Get(func(ctx context.Context, in struct {
+				Orders Fixed
+				ID     int
+				User   user
+				Tenant tenant
+			}) (string, error) {
+				return fmt.Sprintf("%s/%s/%d", in.Tenant.ID, in.User.Name, in.ID), nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	req := httptest.NewRequest("GET", "/orders/3", nil)
+	req.Header.Set("Authorization", "token")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, `"acme/ada/3"`+"\n", w.Body.String())
+
+	for len(started) > 0 {
+		<-started
+	}
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/orders/3", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	_, err = New(
+		testOptions(
+			ByType(Parallel(IntPathIDs())),
+			Get(func(ctx context.Context, in struct {
+				Orders Fixed
+				ID     int
+			}) (string, error) {
+				return "", nil
+			}),
+		),
+	)
+	assert.ErrorContains(t, err, "parallel fields can not add path segments")
+}
+
+func TestLazyValue(t *testing.T) {
+	type document struct {
+		Text string `json:"text"`
+	}
+	decoded, closed := 0, 0
+	var lazy Lazy[document]
+	handler, err := New(
+		testOptions(
+			ByType(LazyValue(ClosableRequestValue(func(r *http.Request, v *document) (func(error) error, error) {
+				decoded++
+				return func(error) error {
+					closed++
+					return nil
+				}, json.NewDecoder(r.Body).Decode(v)
+			}))),
+			Put(func(ctx context.Context, in struct {
+				Documents Fixed
+				ID        int
+				Document  Lazy[document]
+			}) (string, error) {
+				lazy = in.Document
+				if in.ID == 0 {
+					return "", WithStatus(http.StatusNotFound, errors.New("no document"))
+				}
+				doc, err := in.Document.Get()
+				if err != nil {
+					return "", WithStatus(http.StatusBadRequest, err)
+				}
+				_, _ = in.Document.Get()
+				return doc.Text, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	put := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("PUT", path, strings.NewReader(body)))
+		return w
+	}
+	assert.Equal(t, http.StatusNotFound, put("/documents/0", `{"text":"draft"}`).Code)
+	assert.Equal(t, 0, decoded)
+	_, err = lazy.Get()
+	assert.EqualError(t, err, "lazy value accessed after the request")
+
+	assert.Equal(t, `"draft"`+"\n", put("/documents/1", `{"text":"draft"}`).Body.String())
+	assert.Equal(t, 1, decoded)
+	assert.Equal(t, 1, closed)
+	assert.Equal(t, http.StatusBadRequest, put("/documents/1", `{`).Code)
+}
+
+func TestFieldMetrics(t *testing.T) {
+	var records []FieldRecord
+	handler, err := New(
+		testOptions(
+			FieldMetrics(func(ctx context.Context, record FieldRecord) {
+				records = append(records, record)
+			}),
+			Post(func(ctx context.Context, in struct {
+				Users Fixed
+				Body  map[string]string
+			}) (string, error) {
+				return in.Body["name"], nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", strings.NewReader(`{"name":"ada"}`)))
+	handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", strings.NewReader(`{`)))
+	if assert.Len(t, records, 4) {
+		assert.Equal(t, "Users", records[0].Field)
+		assert.Equal(t, "Body", records[1].Field)
+		assert.Equal(t, "/users", records[1].Pattern)
+		assert.NoError(t, records[1].Err)
+		assert.Error(t, records[3].Err)
+	}
+}
+
+func TestOutputHeaderFields(t *testing.T) {
+	type page struct {
+		Total    int       `route:"header=X-Total-Count"`
+		Modified time.Time `route:"header=Last-Modified"`
+		Links    []string  `route:"header=Link"`
+		Items    []string  `json:"items"`
+	}
+	handler, err := New(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+			}) (page, error) {
+				return page{
+					Total:    42,
+					Modified: time.Date(2024, 5, 17, 8, 0, 0, 0, time.UTC),
+					Links:    []string{`</users?page=2>; rel="next"`, `</users?page=5>; rel="last"`},
+					Items:    []string{"ada", "grace"},
+				}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/users", nil))
+	assert.JSONEq(t, `{"items":["ada","grace"]}`, w.Body.String())
+	assert.Equal(t, "42", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, "Fri, 17 May 2024 08:00:00 GMT", w.Header().Get("Last-Modified"))
+	assert.Len(t, w.Header().Values("Link"), 2)
+
+	assert.NotContains(t, SchemaFor(reflect.TypeFor[page]()).Properties, "Total")
+
+	type hidden struct {
+		total int `route:"header=X-Total-Count"`
+		Items []string
+	}
+	_, err = New(testOptions(Get(func(ctx context.Context, in struct{ Hidden Fixed }) (hidden, error) {
+		return hidden{total: 1}, nil
+	})))
+	assert.ErrorContains(t, err, "GET /hidden: header field total of route.hidden is not exported")
+}
+
+func TestResponse(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+	type created struct {
+		Status   int
+		Location string `route:"header=Location"`
+		Body     user   `route:"body"`
+	}
+	handler, err := New(
+		testOptions(
+			Post(func(ctx context.Context, in struct {
+				Users Fixed
+				Body  user
+			}) (created, error) {
+				return created{Status: http.StatusCreated, Location: "/users/ada", Body: in.Body}, nil
+			}),
+			Delete(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (Response[*user], error) {
+				return Response[*user]{
+					Status:  http.StatusNoContent,
+					Headers: http.Header{"X-Deleted": {strconv.Itoa(in.ID)}},
+				}, nil
+			}),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (Response[user], error) {
+				return Response[user]{Headers: http.Header{"Cache-Control": {"no-store"}}, Body: user{Name: "ada"}}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/users", strings.NewReader(`{"name":"ada"}`)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/users/ada", w.Header().Get("Location"))
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"name":"ada"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("DELETE", "/users/7", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "7", w.Header().Get("X-Deleted"))
+	assert.Empty(t, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/users/7", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"name":"ada"}`, w.Body.String())
+
+	info := RouteInfo{OutputType: reflect.TypeFor[created]()}
+	assert.Contains(t, info.OutputSchema().Properties, "name")
+
+	// structs without Response or a body tag are encoded as they are
+	type message struct {
+		Status int
+		Body   string
+	}
+	handler, err = New(testOptions(
+		Get(func(ctx context.Context, in struct{ Messages Fixed }) (message, error) {
+			return message{Status: 3, Body: "hello"}, nil
+		}),
+		Get(func(ctx context.Context, in struct{ Invalid Fixed }) (Response[string], error) {
+			return Response[string]{Status: 3}, nil
+		}),
+	))
+	if assert.NoError(t, err) {
+		w = httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/messages", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"Status":3,"Body":"hello"}`, w.Body.String())
+
+		w = httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/invalid", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid response status 3")
+	}
+}
+
+func TestAutomaticHead(t *testing.T) {
+	calls := 0
+	handler, err := New(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+			}) (string, error) {
+				calls++
+				return "users", nil
+			}),
+			Group(
+				AutomaticHead(false),
+				Get(func(ctx context.Context, in struct {
+					Reports Fixed
+				}) (string, error) {
+					calls++
+					return "report", nil
+				}),
+			),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("HEAD", "/users", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, 1, calls)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("HEAD", "/reports", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET", w.Header().Get("Allow"))
+	assert.Equal(t, 1, calls)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/reports", nil))
+	assert.Equal(t, `"report"`+"\n", w.Body.String())
+}
+
+func TestAutomaticOptions(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (string, error) {
+				return "user", nil
+			}),
+			Delete(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (string, error) {
+				return "deleted", nil
+			}),
+			Group(
+				AutomaticOptions(false),
+				Put(func(ctx context.Context, in struct {
+					Users Fixed
+					ID    int
+				}) (string, error) {
+					return "updated", nil
+				}),
+				Get(func(ctx context.Context, in struct {
+					Internal Fixed
+				}) (string, error) {
+					return "internal", nil
+				}),
+			),
+			Group(
+				AutomaticHead(false),
+				Post(func(ctx context.Context, in struct {
+					Reports Fixed
+				}) (string, error) {
+					return "report", nil
+				}),
+				Get(func(ctx context.Context, in struct {
+					Reports Fixed
+				}) (string, error) {
+					return "report", nil
+				}),
+			),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	options := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("OPTIONS", path, nil))
+		return w
+	}
+	w := options("/users/1")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, HEAD, DELETE, OPTIONS", w.Header().Get("Allow"))
+	assert.Equal(t, "GET, POST, OPTIONS", options("/reports").Header().Get("Allow"))
+	assert.Equal(t, http.StatusNotFound, options("/internal").Code)
+	assert.Equal(t, http.StatusNotFound, options("/unknown").Code)
+}
+
+func TestCORS(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Group(
+				CORS(CORSPolicy{
+					AllowedOrigins:   []string{"https://app.example.com"},
+					AllowedHeaders:   []string{"Authorization", "Content-Type"},
+					ExposedHeaders:   []string{"X-Total-Count"},
+					AllowCredentials: true,
+					MaxAge:           10 * time.Minute,
+				}),
+				Get(func(ctx context.Context, in struct {
+					Users Fixed
+					ID    int
+				}) (string, error) {
+					return "user", nil
+				}),
+				Delete(func(ctx context.Context, in struct {
+					Users Fixed
+					ID    int
+				}) (string, error) {
+					return "", errors.New("failed")
+				}),
+			),
+			Put(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (string, error) {
+				return "updated", nil
+			}),
+			CORS(CORSPolicy{AllowedOrigins: []string{"*"}}),
+			Get(func(ctx context.Context, in struct{ Status Fixed }) (string, error) {
+				return "ok", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	serve := func(method, path, origin string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+	w := serve("GET", "/users/1", "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "X-Total-Count", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	w = serve("DELETE", "/users/1", "https://app.example.com")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	w = serve("GET", "/users/1", "https://evil.example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "*", serve("GET", "/status", "https://other.example.com").Header().Get("Access-Control-Allow-Origin"))
+
+	w = serve("OPTIONS", "/users/1", "https://app.example.com", "Access-Control-Request-Method", "DELETE")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, HEAD, DELETE", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	w = serve("OPTIONS", "/users/1", "https://app.example.com", "Access-Control-Request-Method", "PUT")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	w = serve("OPTIONS", "/users/1", "https://evil.example.com", "Access-Control-Request-Method", "GET")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+
+	_, err = New(CORS(CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}))
+	assert.ErrorContains(t, err, "CORS can't allow credentials for any origin")
+}
+
+type fakeHTTP3 struct {
+	addr    string
+	handler http.Handler
+	closed  chan struct{}
+}
+
+func (s *fakeHTTP3) ListenAndServe(addr string, handler http.Handler) error {
+	s.addr, s.handler = addr, handler
+	<-s.closed
+	return http.ErrServerClosed
+}
+
+func (s *fakeHTTP3) Shutdown(ctx context.Context) error {
+	close(s.closed)
+	return nil
+}
+
+func TestServe(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Proto Fixed
+			}) (string, error) {
+				ex, _ := exchangeFrom(ctx)
+				return ex.request.Proto, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h3 := &fakeHTTP3{closed: make(chan struct{})}
+	served := make(chan error)
+	go func() {
+		served <- ServeListener(ctx, listener, handler, H2C(), HTTP3(h3))
+	}()
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	res, err := client.Get("http://" + listener.Addr().String() + "/proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, `"HTTP/2.0"`+"\n", string(body))
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	assert.Equal(t, `h3=":`+port+`"; ma=86400`, res.Header.Get("Alt-Svc"))
+
+	cancel()
+	assert.NoError(t, <-served)
+	assert.Equal(t, listener.Addr().String(), h3.addr)
+}
+
+func TestServerTimeouts(t *testing.T) {
+	handler, err := New(testOptions(Get(func(ctx context.Context, in struct{ Ping Fixed }) (string, error) {
+		return "pong", nil
+	})))
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, ServeListener(context.Background(), listener, handler, ServerTimeouts(Timeouts{Idle: -time.Second})))
+
+	listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- ServeListener(ctx, listener, handler, ServerTimeouts(Timeouts{ReadHeader: 50 * time.Millisecond}))
+	}()
+
+	// a client that never finishes its headers is disconnected
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("GET /ping HTTP/1.1\r\nHost: example.com\r\n"))
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadAll(conn)
+	assert.NoError(t, err)
+
+	res, err := http.Get("http://" + listener.Addr().String() + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, `"pong"`+"\n", string(body))
+
+	cancel()
+	assert.NoError(t, <-served)
+}
+
+func TestConnInfo(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			ByType(ConnInfo()),
+			Get(func(ctx context.Context, in struct {
+				Diagnostics Fixed
+				Conn        ConnMetadata
+			}) (ConnMetadata, error) {
+				return in.Conn, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- ServeListener(ctx, listener, handler)
+	}()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-served)
+	}()
+
+	get := func() ConnMetadata {
+		res, err := http.Get("http://" + listener.Addr().String() + "/diagnostics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var conn ConnMetadata
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&conn))
+		return conn
+	}
+	first := get()
+	assert.Equal(t, listener.Addr().String(), first.LocalAddr)
+	assert.Equal(t, "HTTP/1.1", first.Protocol)
+	assert.False(t, first.TLS)
+	assert.Equal(t, int64(1), first.Request)
+	assert.False(t, first.Reused)
+
+	second := get()
+	assert.Equal(t, first.RemoteAddr, second.RemoteAddr)
+	assert.Equal(t, int64(2), second.Request)
+	assert.True(t, second.Reused)
+}
+
+func TestStripPrefix(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    string
+			}) (string, error) {
+				ex, _ := exchangeFrom(ctx)
+				return in.ID + " " + ex.request.URL.Path, nil
+			}),
+			StripPrefix("/api/"),
+			RewritePath(func(path string) string {
+				return strings.Replace(path, "/v1/", "/", 1)
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+	assert.Equal(t, `"7 /users/7"`+"\n", get("/api/users/7").Body.String())
+	assert.Equal(t, `"a/b /users/a/b"`+"\n", get("/api/v1/users/a%2Fb").Body.String())
+	assert.Equal(t, http.StatusNotFound, get("/users/7").Code)
+	assert.Equal(t, http.StatusNotFound, get("/apiusers/7").Code)
+}
+
+func TestRedirects(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Accounts Fixed
+				ID       int
+			}) (int, error) {
+				return in.ID, nil
+			}),
+			Redirects(map[string]string{
+				"/users/{id}":        "/accounts/{id}",
+				"/files/{path...}":   "/documents/{path...}",
+				"/teams/{team}/{id}": "/accounts/{id}",
+			}, http.StatusPermanentRedirect),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	w := serve("GET", "/users/7?fields=name")
+	assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+	assert.Equal(t, "/accounts/7?fields=name", w.Header().Get("Location"))
+	w = serve("POST", "/teams/a/8")
+	assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+	assert.Equal(t, "/accounts/8", w.Header().Get("Location"))
+	assert.Equal(t, "/documents/a/b%20c", serve("GET", "/files/a/b%20c").Header().Get("Location"))
+
+	handler, err = New(
+		testOptions(
+			StripPrefix("/api"),
+			Redirects(map[string]string{"/users/{id}": "/accounts/{id}"}, http.StatusPermanentRedirect),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+	assert.Equal(t, "/api/accounts/7?fields=name", serve("GET", "/api/users/7?fields=name").Header().Get("Location"))
+
+	_, err = New(testOptions(Redirects(map[string]string{"/users/{id}": "/accounts/{name}"}, http.StatusMovedPermanently)))
+	assert.ErrorContains(t, err, "variable name of /accounts/{name} is not part of the old pattern")
+	_, err = New(testOptions(Redirects(map[string]string{"/a": "/b"}, http.StatusOK)))
+	assert.ErrorContains(t, err, "redirect status 200 is not a 3xx status")
+}
+
+func TestAccept(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			ByType(Accept()),
+			Get(func(ctx context.Context, in struct {
+				Report Fixed
+				Accept AcceptList
+			}) (string, error) {
+				return in.Accept.Negotiate("application/json", "text/csv", "text/html"), nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(accept ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/report", nil)
+		for _, value := range accept {
+			r.Header.Add("Accept", value)
+		}
+		handler(w, r)
+		return w
+	}
+	assert.Equal(t, `"application/json"`+"\n", get().Body.String())
+	assert.Equal(t, `"text/csv"`+"\n", get("text/*;q=0.5, application/json;q=0.4", "text/html;q=0").Body.String())
+	assert.Equal(t, `"text/html"`+"\n", get(`text/html; level="1,2";q=0.5, text/html;q=0.9, */*;q=0.1`).Body.String())
+	assert.Equal(t, `""`+"\n", get("image/png").Body.String())
+	assert.Equal(t, http.StatusBadRequest, get("text/html;q=2").Code)
+	assert.Equal(t, http.StatusBadRequest, get("html").Code)
+
+	list, err := parseAccept([]string{"*/*;q=0.1, text/html;charset=utf-8, text/*;q=0.5, text/html;q=0.8"})
+	assert.NoError(t, err)
+	assert.Equal(t, AcceptList{
+		{Type: "text/html", Params: map[string]string{"charset": "utf-8"}, Quality: 1},
+		{Type: "text/html", Quality: 0.8},
+		{Type: "text/*", Quality: 0.5},
+		{Type: "*/*", Quality: 0.1},
+	}, list)
+	assert.Equal(t, 1.0, list.Quality("text/html; charset=UTF-8"))
+	assert.Equal(t, 0.8, list.Quality("text/html"))
+	assert.Equal(t, 0.5, list.Quality("text/plain"))
+	assert.True(t, list.Accepts("image/png"))
+}
+
+func TestGeoIP(t *testing.T) {
+	resolver := GeoResolverFunc(func(ctx context.Context, addr netip.Addr) (Location, bool, error) {
+		switch addr.String() {
+		case "203.0.113.7":
+			return Location{Country: "DE", Region: "BY", City: "Munich"}, true, nil
+		case "203.0.113.8":
+			return Location{}, false, errors.New("database closed")
+		}
+		return Location{}, false, nil
+	})
+	handler, err := New(
+		testOptions(
+			ByType(GeoIP(resolver)),
+			Get(func(ctx context.Context, in struct {
+				Region   Fixed
+				Location Location
+			}) (Location, error) {
+				return in.Location, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/region", nil)
+		r.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		handler(w, r)
+		return w
+	}
+	assert.JSONEq(t, `{"Country":"DE","Region":"BY","City":"Munich"}`, get("203.0.113.7:1234", "").Body.String())
+	assert.JSONEq(t, `{"Country":"DE","Region":"BY","City":"Munich"}`, get("127.0.0.1:1234", "203.0.113.7").Body.String())
+	assert.JSONEq(t, `{"Country":"","Region":"","City":""}`, get("198.51.100.1:1234", "203.0.113.7").Body.String())
+	assert.Equal(t, http.StatusInternalServerError, get("203.0.113.8:1234", "").Code)
+}
+
+func TestLoadShed(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			LoadShed(0, 10*time.Millisecond),
+			Priority(PriorityCritical),
+			Get(func(ctx context.Context, in struct {
+				Critical Fixed
+				Delay    int
+			}) (string, error) {
+				time.Sleep(time.Duration(in.Delay) * time.Millisecond)
+				return "critical", nil
+			}),
+			Priority(PriorityNormal),
+			Get(func(ctx context.Context, in struct{ Normal Fixed }) (string, error) {
+				return "normal", nil
+			}),
+			LowPriority(),
+			Get(func(ctx context.Context, in struct{ Batch Fixed }) (string, error) {
+				return "batch", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+	// the first request three times over the latency budget puts the routes under pressure
+	assert.Equal(t, http.StatusOK, get("/critical/30").Code)
+	w := get("/batch")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusServiceUnavailable, get("/normal").Code)
+	assert.Equal(t, http.StatusOK, get("/critical/0").Code)
+
+	// once no request was admitted for maxLatency a single one probes the latency
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, get("/batch").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, get("/batch").Code)
+
+	// fast requests lower the moving average until nothing is shed anymore
+	for range 20 {
+		get("/critical/0")
+	}
+	assert.Equal(t, http.StatusOK, get("/normal").Code)
+	assert.Equal(t, http.StatusOK, get("/batch").Code)
+}
+
+func TestPriority(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	block := func(ctx context.Context, in struct{ Critical Fixed }) (string, error) {
+		started <- struct{}{}
+		<-release
+		return "critical", nil
+	}
+	handler, err := New(
+		testOptions(
+			LoadShed(1, 0),
+			Priority(PriorityCritical),
+			Get(block),
+			Priority(PriorityNormal),
+			Get(func(ctx context.Context, in struct{ Normal Fixed }) (string, error) {
+				return "normal", nil
+			}),
+			Priority(PriorityBatch),
+			Get(func(ctx context.Context, in struct{ Batch Fixed }) (string, error) {
+				return "batch", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(release)
+	blocked := func(path string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, http.StatusOK, get(path))
+		}()
+		<-started
+	}
+
+	blocked("/critical")
+	assert.Equal(t, http.StatusOK, get("/batch"))
+	blocked("/critical")
+	assert.Equal(t, http.StatusServiceUnavailable, get("/batch"))
+	assert.Equal(t, http.StatusOK, get("/normal"))
+	blocked("/critical")
+	assert.Equal(t, http.StatusServiceUnavailable, get("/normal"))
+	blocked("/critical")
+
+	routes, err := Routes(testOptions(Priority(PriorityBatch), Get(func(ctx context.Context, in struct{ Batch Fixed }) (string, error) {
+		return "", nil
+	})))
+	assert.NoError(t, err)
+	assert.Equal(t, PriorityBatch, routes[0].Priority)
+	_, err = New(Priority("urgent"))
+	assert.ErrorContains(t, err, `unknown priority class "urgent"`)
+}
+
+func TestRateLimit(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			RateLimit(1, 2, nil),
+			Get(func(ctx context.Context, in struct{ Search Fixed }) (string, error) {
+				return "results", nil
+			}),
+			Group(
+				RateLimit(1, 1, func(r *http.Request) string {
+					return r.Header.Get("X-Api-Key")
+				}),
+				Get(func(ctx context.Context, in struct{ Export Fixed }) (string, error) {
+					return "export", nil
+				}),
+			),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(path, remoteAddr, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Api-Key", apiKey)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, get("/search", "192.0.2.1:1234", "").Code)
+	assert.Equal(t, http.StatusOK, get("/search", "192.0.2.1:1235", "").Code)
+	w := get("/search", "192.0.2.1:1234", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, get("/search", "192.0.2.2:1234", "").Code)
+
+	assert.Equal(t, http.StatusOK, get("/export", "192.0.2.1:1234", "a").Code)
+	assert.Equal(t, http.StatusTooManyRequests, get("/export", "192.0.2.2:1234", "a").Code)
+	assert.Equal(t, http.StatusOK, get("/export", "192.0.2.1:1234", "b").Code)
+
+	_, err = New(RateLimit(0, 1, nil))
+	assert.ErrorContains(t, err, "lets no request through")
+}
+
+func TestRequireScopes(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Authenticate(func(r *http.Request) []string {
+				token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if !ok {
+					return nil
+				}
+				return strings.Fields(token)
+			}),
+			RequireScopes(),
+			Get(func(ctx context.Context, in struct{ Profile Fixed }) (string, error) {
+				return "profile", nil
+			}),
+			RequireScopes("reports:read"),
+			Get(func(ctx context.Context, in struct{ Reports Fixed }) (string, error) {
+				return "reports", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(path, authorization string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, get("/profile", ""))
+	assert.Equal(t, http.StatusOK, get("/profile", "Bearer "))
+	assert.Equal(t, http.StatusForbidden, get("/reports", "Bearer profile"))
+	assert.Equal(t, http.StatusOK, get("/reports", "Bearer profile reports:read"))
+
+	_, err = New(RequireScopes("admin"))
+	assert.ErrorContains(t, err, "RequireScopes needs Authenticate before it")
+}
+
+func TestPriorityConcurrency(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler, err := New(
+		testOptions(
+			Priority(PriorityBatch),
+			MaxConcurrent(1, 5, time.Second),
+			Get(func(ctx context.Context, in struct{ Report Fixed }) (string, error) {
+				started <- struct{}{}
+				<-release
+				return "report", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func() int {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/report", nil))
+		return w.Code
+	}
+	done := make(chan int)
+	go func() { done <- get() }()
+	<-started
+	assert.Equal(t, http.StatusTooManyRequests, get())
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+}
+
+func TestKillSwitch(t *testing.T) {
+	var switches KillSwitches
+	handler, err := New(
+		testOptions(
+			KillSwitch(&switches),
+			Get(func(ctx context.Context, in struct{ Orders Fixed }) (string, error) {
+				return "orders", nil
+			}),
+			Post(func(ctx context.Context, in struct{ Orders Fixed }) (string, error) {
+				return "created", nil
+			}),
+			KillSwitch(nil),
+			Get(func(ctx context.Context, in struct{ Health Fixed }) (string, error) {
+				return "ok", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	serve := func(method, path string) int {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, path, nil))
+		return w.Code
+	}
+	assert.NoError(t, switches.Disable("POST /orders", http.StatusServiceUnavailable))
+	assert.Equal(t, http.StatusOK, serve("GET", "/orders"))
+	assert.Equal(t, http.StatusServiceUnavailable, serve("POST", "/orders"))
+
+	assert.NoError(t, switches.Disable("/orders", http.StatusNotFound))
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/orders"))
+	assert.Equal(t, map[string]int{"POST /orders": 503, "/orders": 404}, switches.Disabled())
+
+	switches.Enable("/orders")
+	switches.Enable("POST /orders")
+	assert.Equal(t, http.StatusOK, serve("GET", "/orders"))
+	assert.Equal(t, http.StatusOK, serve("POST", "/orders"))
+
+	assert.NoError(t, switches.Disable("/health", http.StatusNotFound))
+	assert.Equal(t, http.StatusOK, serve("GET", "/health"))
+	assert.Error(t, switches.Disable("/orders", http.StatusGone))
+}
+
+func TestWarmup(t *testing.T) {
+	calls := 0
+	users := Get(func(ctx context.Context, in struct {
+		Users Fixed
+		ID    int
+	}) (string, error) {
+		calls++
+		assert.True(t, IsWarmup(ctx))
+		return "user", nil
+	})
+	warm := func(path string) *http.Request {
+		return httptest.NewRequest("GET", path, nil)
+	}
+
+	hooks := 0
+	_, err := New(testOptions(
+		AfterCommit(func(ctx context.Context, info RouteInfo, input, output any) { hooks++ }),
+		OnResponse(func(ctx context.Context, info RouteInfo, output any) (any, error) {
+			hooks++
+			return output, nil
+		}),
+		users,
+		Warmup(false, warm("/users/7")),
+	))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, 0, hooks, "hooks don't see the zero output of skipped handlers")
+	_, err = New(testOptions(users, Warmup(true, warm("/users/7"))))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	_, err = New(testOptions(
+		users,
+		Get(func(ctx context.Context, in struct{ Events Fixed }) (chan int, error) {
+			return make(chan int), nil
+		}),
+		Warmup(false, warm("/users/7"), warm("/missing"), warm("/events")),
+	))
+	assert.ErrorContains(t, err, "warmup GET /missing: status 404: not found")
+	assert.ErrorContains(t, err, "warmup GET /events: status 500: encoding response: json: unsupported type: chan int")
+	assert.Equal(t, 1, calls)
+
+	var audited []string
+	cached, err := New(testOptions(
+		ResponseCache(NewMemoryCache(10), time.Minute),
+		Audit(nil, func(ctx context.Context, record AuditRecord) {
+			audited = append(audited, record.Path)
+		}),
+		Get(func(ctx context.Context, in struct{ Items Fixed }) ([]string, error) {
+			return []string{"real"}, nil
+		}),
+		Warmup(false, warm("/items")),
+	))
+	if assert.NoError(t, err) {
+		w := httptest.NewRecorder()
+		cached(w, httptest.NewRequest("GET", "/items", nil))
+		assert.Equal(t, "[\"real\"]\n", w.Body.String())
+		assert.Equal(t, []string{"/items"}, audited)
+	}
+
+	router, err := NewRouter(testOptions(users, Warmup(true, warm("/users/7"))))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.NoError(t, router.Add(Get(func(ctx context.Context, in struct{ Groups Fixed }) (string, error) {
+		return "groups", nil
+	})))
+	assert.Equal(t, 2, calls)
+}
+
+func TestReconfigure(t *testing.T) {
+	router, err := NewRouter(testOptions(
+		Group(
+			Reconfigurable("defaults", MaxBodySize(8)),
+			Post(func(ctx context.Context, in struct {
+				Echo Fixed
+				Body string
+			}) (string, error) {
+				return in.Body, nil
+			}),
+		),
+		Group(
+			Reconfigurable("reports", MaxBodySize(64)),
+			Post(func(ctx context.Context, in struct {
+				Reports Fixed
+				Body    string
+			}) (string, error) {
+				return in.Body, nil
+			}),
+		),
+	))
+	if err != nil {
+		t.Errorf("NewRouter() error = %v", err)
+		return
+	}
+
+	post := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(`"0123456789"`)))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/echo"))
+	assert.Equal(t, http.StatusOK, post("/reports"))
+	assert.NoError(t, router.Reconfigure(map[string][]Option{"defaults": {MaxBodySize(64)}}))
+	assert.Equal(t, http.StatusOK, post("/echo"))
+	assert.Equal(t, http.StatusOK, post("/reports"))
+
+	// the reports group keeps its own options
+	assert.NoError(t, router.Reconfigure(map[string][]Option{"defaults": {MaxBodySize(4)}}))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/echo"))
+	assert.Equal(t, http.StatusOK, post("/reports"))
+	assert.NoError(t, router.Reconfigure(map[string][]Option{"reports": {MaxBodySize(8)}}))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/echo"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/reports"))
+
+	var maintenance Maintenance
+	maintenance.Enable(time.Minute)
+	assert.NoError(t, router.Reconfigure(map[string][]Option{"defaults": {MaintenanceMode(&maintenance)}}))
+	assert.Equal(t, http.StatusServiceUnavailable, post("/echo"))
+
+	assert.EqualError(t, router.Reconfigure(map[string][]Option{"defaults": {Get(func(ctx context.Context, in struct{ Echo Fixed }) (string, error) {
+		return "", nil
+	})}}), "reconfiguring must not change the routes")
+	assert.EqualError(t, router.Reconfigure(map[string][]Option{"admin": nil}), `no Reconfigurable named "admin"`)
+	assert.Equal(t, http.StatusServiceUnavailable, post("/echo"))
+
+	assert.NoError(t, router.Add(Get(func(ctx context.Context, in struct{ Health Fixed }) (string, error) {
+		return "ok", nil
+	})))
+	assert.Equal(t, http.StatusServiceUnavailable, post("/echo"))
+
+	// Reconfigurables within variants are reconfigured as well
+	assert.NoError(t, router.Add(Variant("strict", 100, func(r *http.Request) string { return "all" },
+		Reconfigurable("strict", MaxBodySize(4)),
+		Post(func(ctx context.Context, in struct {
+			Reports Fixed
+			Body    string
+		}) (string, error) {
+			return in.Body, nil
+		}),
+	)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/reports"))
+	assert.NoError(t, router.Reconfigure(map[string][]Option{"strict": nil}))
+	assert.Equal(t, http.StatusOK, post("/reports"))
+	assert.NoError(t, router.Reconfigure(map[string][]Option{"defaults": nil}))
+	assert.Equal(t, http.StatusOK, post("/echo"))
+}
+
+func TestReconfigureKeepsState(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	router, err := NewRouter(testOptions(
+		Reconfigurable("defaults", MaxBodySize(64), CircuitBreaker(0.5, 1, time.Minute, time.Minute)),
+		Get(func(ctx context.Context, in struct{ Flaky Fixed }) (string, error) {
+			return "", errors.New("dependency down")
+		}),
+		MaxConcurrent(1, 0, 0),
+		Get(func(ctx context.Context, in struct{ Report Fixed }) (string, error) {
+			started <- struct{}{}
+			<-release
+			return "report", nil
+		}),
+	))
+	if err != nil {
+		t.Errorf("NewRouter() error = %v", err)
+		return
+	}
+
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusInternalServerError, get("/flaky"))
+	assert.Equal(t, http.StatusServiceUnavailable, get("/flaky"))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.Equal(t, http.StatusOK, get("/report"))
+	}()
+	<-started
+
+	assert.NoError(t, router.Reconfigure(map[string][]Option{"defaults": {MaxBodySize(8), CircuitBreaker(0.5, 1, time.Minute, time.Minute)}}))
+	assert.Equal(t, http.StatusServiceUnavailable, get("/flaky"))
+	assert.Equal(t, http.StatusTooManyRequests, get("/report"))
+	assert.NoError(t, router.Add(Get(func(ctx context.Context, in struct{ Health Fixed }) (string, error) {
+		return "ok", nil
+	})))
+	assert.Equal(t, http.StatusServiceUnavailable, get("/flaky"))
+	assert.Equal(t, http.StatusTooManyRequests, get("/report"))
+	close(release)
+	<-done
+
+	// changed settings start afresh
+	assert.NoError(t, router.Reconfigure(map[string][]Option{"defaults": {CircuitBreaker(0.5, 2, time.Minute, time.Minute)}}))
+	assert.Equal(t, http.StatusInternalServerError, get("/flaky"))
+}
+
+type userPage struct {
+	Name string
+}
+
+type editPage struct {
+	Name string
+}
+
+func (editPage) Template() string {
+	return "form"
+}
+
+func TestHTMLResponse(t *testing.T) {
+	files := fstest.MapFS{
+		"layout.html":         {Data: []byte(`<html><title>{{block "title" .}}App{{end}}</title>{{template "nav.html" .}}{{template "content" .}}</html>`)},
+		"partials/nav.html":   {Data: []byte(`<nav>{{shout "menu"}}</nav>`)},
+		"pages/userpage.html": {Data: []byte(`{{define "title"}}{{.Name}}{{end}}{{define "content"}}<p>{{.Name}}</p>{{end}}`)},
+		"pages/form.html":     {Data: []byte(`{{define "content"}}<a href="/users?name={{.Name}}">edit</a>{{end}}`)},
+	}
+	handler, err := New(
+		testOptions(
+			HTMLResponse(files, HTMLConfig{
+				Pages:    "pages/*.html",
+				Layout:   "layout.html",
+				Partials: "partials/*.html",
+				Funcs:    template.FuncMap{"shout": strings.ToUpper},
+			}),
+			Get(func(ctx context.Context, in struct{ User Fixed }) (userPage, error) {
+				return userPage{Name: "<b>Ada</b>"}, nil
+			}),
+			Get(func(ctx context.Context, in struct{ Edit Fixed }) (*editPage, error) {
+				return &editPage{Name: "Ada & Bob"}, nil
+			}),
+			Get(func(ctx context.Context, in struct{ Other Fixed }) (string, error) {
+				return "other", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+	w := get("/user")
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `<html><title>&lt;b&gt;Ada&lt;/b&gt;</title><nav>MENU</nav><p>&lt;b&gt;Ada&lt;/b&gt;</p></html>`, w.Body.String())
+	assert.Equal(t, `<html><title>App</title><nav>MENU</nav><a href="/users?name=Ada%20%26%20Bob">edit</a></html>`, get("/edit").Body.String())
+	w = get("/other")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "no page for output string")
+
+	_, err = New(HTMLResponse(fstest.MapFS{"a.html": {Data: []byte("a")}}, HTMLConfig{Pages: "*.html", Layout: "a.html"}))
+	assert.ErrorContains(t, err, "HTMLResponse: page a.html does not define content")
+}
+
+type savedPage struct {
+	HTMXHeaders
+	Name string
+}
+
+func TestHTMX(t *testing.T) {
+	files := fstest.MapFS{
+		"layout.html":          {Data: []byte(`<html>{{template "content" .}}</html>`)},
+		"pages/savedpage.html": {Data: []byte(`{{define "content"}}<p>{{.Name}}</p>{{end}}`)},
+	}
+	handler, err := New(
+		testOptions(
+			ByType(HTMX()),
+			HTMLResponse(files, HTMLConfig{Pages: "pages/*.html", Layout: "layout.html"}),
+			Post(func(ctx context.Context, in struct {
+				Save Fixed
+				HX   HTMXRequest
+			}) (savedPage, error) {
+				page := savedPage{Name: in.HX.Target}
+				if in.HX.Request {
+					page.Trigger = map[string]any{"saved": nil, "notify": nil}
+					page.TriggerAfterSwap = map[string]any{"toast": map[string]string{"level": "info"}}
+					page.PushURL = "/saved"
+				}
+				return page, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	post := func(header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/save", nil)
+		for key, value := range header {
+			r.Header.Set(key, value)
+		}
+		handler(w, r)
+		return w
+	}
+	w := post(nil)
+	assert.Equal(t, "<html><p></p></html>", w.Body.String())
+	assert.Equal(t, "HX-Request", w.Header().Get("Vary"))
+	assert.Empty(t, w.Header().Get("HX-Trigger"))
+
+	w = post(map[string]string{"HX-Request": "true", "HX-Target": "result"})
+	assert.Equal(t, "<p>result</p>", w.Body.String())
+	assert.Equal(t, "notify, saved", w.Header().Get("HX-Trigger"))
+	assert.Equal(t, `{"toast":{"level":"info"}}`, w.Header().Get("HX-Trigger-After-Swap"))
+	assert.Equal(t, "/saved", w.Header().Get("HX-Push-Url"))
+
+	w = post(map[string]string{"HX-Request": "true", "HX-Boosted": "true"})
+	assert.Equal(t, "<html><p></p></html>", w.Body.String())
+}
+
+type signupForm struct {
+	Name   string
+	Age    int
+	Terms  bool
+	Topics []string `form:"topic"`
+}
+
+func (f *signupForm) ValidateForm() FormErrors {
+	if f.Name == "" {
+		return FormErrors{"name": "required"}
+	}
+	return nil
+}
+
+type welcomePage struct {
+	Name string
+}
+
+func TestFormPage(t *testing.T) {
+	files := fstest.MapFS{
+		"pages/signup.html":      {Data: []byte(`<input name="name" value="{{.Values.Get "name"}}">{{.Errors.name}}<input name="age" value="{{.Values.Get "age"}}">{{.Errors.age}}`)},
+		"pages/welcomepage.html": {Data: []byte(`welcome {{.Name}}`)},
+	}
+	var bound signupForm
+	handler, err := New(
+		testOptions(
+			ByName("Form", FormBody()),
+			HTMLResponse(files, HTMLConfig{Pages: "pages/*.html"}),
+			FormPage("signup"),
+			Post(func(ctx context.Context, in struct {
+				Signup Fixed
+				Form   signupForm
+			}) (welcomePage, error) {
+				bound = in.Form
+				if in.Form.Name == "taken" {
+					return welcomePage{}, FormErrors{"name": "is taken"}
+				}
+				return welcomePage{Name: in.Form.Name}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	post := func(form string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/signup", strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		handler(w, r)
+		return w
+	}
+	w := post("name=Ada&age=36&terms=on&topic=go&topic=web")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "welcome Ada", w.Body.String())
+	assert.Equal(t, signupForm{Name: "Ada", Age: 36, Terms: true, Topics: []string{"go", "web"}}, bound)
+
+	w = post("name=Ada&age=old")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, `<input name="name" value="Ada"><input name="age" value="old">is not a valid number`, w.Body.String())
+
+	w = post("name=taken")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, `<input name="name" value="taken">is taken<input name="age" value="">`, w.Body.String())
+
+	w = post("age=3")
+	assert.Equal(t, `<input name="name" value="">required<input name="age" value="3">`, w.Body.String())
+
+	_, err = New(FormPage("signup"))
+	assert.EqualError(t, err, "FormPage requires a response encoder")
+	assert.Equal(t, http.StatusUnprocessableEntity, StatusCode(fmt.Errorf("binding: %w", FormErrors{"a": "b"})))
+}
+
+func TestLocalizeErrors(t *testing.T) {
+	catalog := Catalog{
+		"de": {
+			"not found":                          "nicht gefunden",
+			"can not sort by %q, allowed are %s": "Sortierung nach %q nicht möglich, erlaubt sind %s",
+			"required":                           "Pflichtfeld",
+		},
+	}
+	handler, err := New(
+		testOptions(
+			ByType(SortQuery("name")),
+			ByType(AcceptLanguage("en", "de")),
+			ByName("Form", FormBody()),
+			LocalizeErrors(catalog, "en", "de"),
+			Get(func(ctx context.Context, in struct {
+				Users  Fixed
+				Locale Locale
+				Sort   Sort
+			}) (Locale, error) {
+				return in.Locale, nil
+			}),
+			Post(func(ctx context.Context, in struct {
+				Signup Fixed
+				Form   signupForm
+			}) (string, error) {
+				return in.Form.Name, nil
+			}),
+			Put(func(ctx context.Context, in struct {
+				Profile Fixed
+			}) (string, error) {
+				return "", WithStatus(http.StatusConflict, fmt.Errorf("saving profile: %w", FormErrors{"name": "required"}))
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	serve := func(method, path, language string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Accept-Language", language)
+		handler(w, r)
+		return w
+	}
+	assert.Equal(t, `"de"`+"\n", serve("GET", "/users", "fr;q=0.9, de-AT;q=0.8, en;q=0.5").Body.String())
+	assert.Equal(t, `"en"`+"\n", serve("GET", "/users", "fr").Body.String())
+
+	w := serve("GET", "/missing", "de")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "nicht gefunden\n", w.Body.String())
+	assert.Equal(t, "de", w.Header().Get("Content-Language"))
+	assert.Equal(t, "not found\n", serve("GET", "/missing", "en").Body.String())
+
+	w = serve("GET", "/users?sort=age", "de")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `Sortierung nach "age" nicht möglich, erlaubt sind name`+"\n", w.Body.String())
+
+	w = serve("POST", "/signup", "de")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "invalid form: name: Pflichtfeld\n", w.Body.String())
+
+	// the translated FormErrors keep the status of the error they were wrapped in
+	w = serve("PUT", "/profile", "de")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "invalid form: name: Pflichtfeld\n", w.Body.String())
+}
+
+type importRecord struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestNDJSON(t *testing.T) {
+	var stream Stream[importRecord]
+	handler, err := New(
+		testOptions(
+			ByType(NDJSONBody[importRecord]()),
+			NDJSONResponse(),
+			Post(func(ctx context.Context, in struct {
+				Import  Fixed
+				Records Stream[importRecord]
+			}) (int, error) {
+				stream = in.Records
+				count := 0
+				for record := range in.Records.All() {
+					if record.ID == 0 {
+						break
+					}
+					count++
+				}
+				return count, in.Records.Err()
+			}),
+			Post(func(ctx context.Context, in struct {
+				Each    Fixed
+				Records Stream[importRecord]
+			}) ([]string, error) {
+				var names []string
+				err := in.Records.Each(func(record importRecord) error {
+					names = append(names, record.Name)
+					return nil
+				})
+				return names, err
+			}),
+			Get(func(ctx context.Context, in struct{ Export Fixed }) (iter.Seq[importRecord], error) {
+				return func(yield func(importRecord) bool) {
+					for i := 1; i <= 3 && yield(importRecord{ID: i}); i++ {
+					}
+				}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	w := serve("POST", "/import", "{\"id\":1}\n{\"id\":2}\n\n{\"id\":0}\n{\"id\":3}\n")
+	assert.Equal(t, "2\n", w.Body.String())
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.EqualError(t, stream.Each(func(importRecord) error { return nil }), "stream used after the request")
+
+	w = serve("POST", "/import", "{\"id\":1}\n{\"id\":\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "record 2: unexpected EOF")
+
+	assert.Equal(t, "\"a\"\n\"b\"\n", serve("POST", "/each", `{"name":"a"}`+"\n"+`{"name":"b"}`).Body.String())
+	assert.Equal(t, "{\"id\":1,\"name\":\"\"}\n{\"id\":2,\"name\":\"\"}\n{\"id\":3,\"name\":\"\"}\n", serve("GET", "/export", "").Body.String())
+
+	records := func(yield func(importRecord) bool) {
+		for i := 1; i <= 3 && yield(importRecord{ID: i}); i++ {
+		}
+	}
+	// writers that only unwrap are flushed through
+	w = httptest.NewRecorder()
+	assert.NoError(t, encodeNDJSON(context.Background(), unwrapOnly{w}, iter.Seq[importRecord](records)))
+	assert.True(t, w.Flushed)
+}
+
+type unwrapOnly struct {
+	http.ResponseWriter
+}
+
+func (w unwrapOnly) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestUploads(t *testing.T) {
+	store := &MemoryUploadStore{}
+	handler, err := New(
+		testOptions(
+			Uploads("/uploads", store, 10),
+			ByType(CompletedUpload(store, "upload")),
+			Post(func(ctx context.Context, in struct {
+				Documents Fixed
+				File      UploadedFile
+			}) (string, error) {
+				f, err := in.File.Open()
+				if err != nil {
+					return "", err
+				}
+				defer f.Close()
+				data, err := io.ReadAll(f)
+				return in.File.Metadata["name"] + ": " + string(data), err
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	serve := func(method, path, contentRange, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentRange != "" {
+			req.Header.Set("Content-Range", contentRange)
+		}
+		handler(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve("POST", "/uploads", "", `{"size":11}`).Code)
+	w := serve("POST", "/uploads", "", `{"size":10,"metadata":{"name":"notes.txt"}}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	location := w.Header().Get("Location")
+	assert.Regexp(t, `^/uploads/[0-9a-f]{32}$`, location)
+	id := strings.TrimPrefix(location, "/uploads/")
+
+	w = serve("PUT", location, "bytes 0-5/10", "hello ")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, http.StatusConflict, serve("POST", "/documents?upload="+id, "", "").Code)
+
+	w = serve("PUT", location, "bytes 0-5/10", "hello ")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, http.StatusBadRequest, serve("PUT", location, "bytes 6-10/11", "world").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("PUT", location, "", "world").Code)
+
+	w = serve("GET", location, "", "")
+	assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+	assert.Contains(t, w.Body.String(), `"offset":6`)
+
+	assert.Equal(t, http.StatusNoContent, serve("PUT", location, "bytes 6-9/10", "world").Code)
+	w = serve("POST", "/documents?upload="+id, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"notes.txt: hello worl"`+"\n", w.Body.String())
+	assert.Equal(t, http.StatusNotFound, serve("GET", location, "", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve("POST", "/documents?upload="+id, "", "").Code)
+
+	w = serve("POST", "/uploads", "", `{"size":3}`)
+	location = w.Header().Get("Location")
+	assert.Equal(t, http.StatusNoContent, serve("DELETE", location, "", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve("PUT", location, "bytes 0-2/3", "abc").Code)
+}
+
+// gatedUploadStore holds Append calls until release is closed.
+type gatedUploadStore struct {
+	*MemoryUploadStore
+	appending chan struct{}
+	release   chan struct{}
+}
+
+func (s gatedUploadStore) Append(ctx context.Context, id string, offset int64, chunk io.Reader) (int64, error) {
+	s.appending <- struct{}{}
+	<-s.release
+	return s.MemoryUploadStore.Append(ctx, id, offset, chunk)
+}
+
+func TestUploadsConcurrentChunks(t *testing.T) {
+	store := gatedUploadStore{&MemoryUploadStore{}, make(chan struct{}), make(chan struct{})}
+	handler, err := New(testOptions(Uploads("/uploads", store, 10)))
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/uploads", strings.NewReader(`{"size":10}`)))
+	location := w.Header().Get("Location")
+
+	// both requests pass the offset check of the loaded upload before either appends
+	responses := make(chan *httptest.ResponseRecorder, 2)
+	for range 2 {
+		go func() {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("PUT", location, strings.NewReader("hello"))
+			req.Header.Set("Content-Range", "bytes 0-4/10")
+			handler(w, req)
+			responses <- w
+		}()
+	}
+	<-store.appending
+	<-store.appending
+	close(store.release)
+
+	codes := map[int]string{}
+	for range 2 {
+		w := <-responses
+		codes[w.Code] = w.Header().Get("Upload-Offset")
+	}
+	assert.Equal(t, map[int]string{http.StatusNoContent: "5", http.StatusConflict: "5"}, codes)
+}
+
+func TestRangeReader(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Objects Fixed
+			}) (RangeReader, error) {
+				return RangeReader{Reader: strings.NewReader("0123456789"), Size: 10, ContentType: "text/plain", ETag: `"v1"`}, nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	serve := func(header ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/objects", nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		handler(w, req)
+		return w
+	}
+
+	w := serve()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	assert.Equal(t, "0123456789", w.Body.String())
+
+	w = serve("Range", "bytes=2-4")
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 2-4/10", w.Header().Get("Content-Range"))
+	assert.Equal(t, "234", w.Body.String())
+
+	w = serve("Range", "bytes=-2")
+	assert.Equal(t, "89", w.Body.String())
+
+	w = serve("Range", "bytes=0-1,8-9")
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "multipart/byteranges; boundary="))
+	assert.Contains(t, w.Body.String(), "Content-Range: bytes 0-1/10\r\nContent-Type: text/plain\r\n\r\n01")
+	assert.Contains(t, w.Body.String(), "Content-Range: bytes 8-9/10\r\nContent-Type: text/plain\r\n\r\n89")
+
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, serve("Range", "bytes=20-30").Code)
+	assert.Equal(t, http.StatusOK, serve("Range", "bytes=2-4", "If-Range", `"v0"`).Code)
+	assert.Equal(t, http.StatusPartialContent, serve("Range", "bytes=2-4", "If-Range", `"v1"`).Code)
+}
+
+func TestEnv(t *testing.T) {
+	routes := func(environment string) []string {
+		handler, err := New(
+			testOptions(
+				Environment(environment),
+				Get(func(ctx context.Context, in struct {
+					Users Fixed
+				}) (string, error) {
+					return "users", nil
+				}),
+				Env("dev, staging", Get(func(ctx context.Context, in struct {
+					Debug Fixed
+				}) (string, error) {
+					return "debug", nil
+				})),
+			),
+		)
+		if err != nil {
+			t.Errorf("New() error = %v", err)
+			return nil
+		}
+		var found []string
+		for _, path := range []string{"/users", "/debug"} {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", path, nil))
+			if w.Code == http.StatusOK {
+				found = append(found, path)
+			}
+		}
+		return found
+	}
+
+	assert.Equal(t, []string{"/users", "/debug"}, routes("staging"))
+	assert.Equal(t, []string{"/users"}, routes("production"))
+
+	_, err := New(testOptions(Env("staging")))
+	assert.ErrorContains(t, err, `Env("staging") requires an Environment set before it`)
+	_, err = New(testOptions(Environment("staging"), Environment("production")))
+	assert.ErrorContains(t, err, `environment already set to "staging"`)
+	// variants see the environment as well
+	handler, err := New(testOptions(
+		Environment("dev"),
+		Get(func(ctx context.Context, in struct{ Debug Fixed }) (string, error) {
+			return "debug", nil
+		}),
+		Variant("verbose", 100, func(r *http.Request) string { return "everyone" },
+			Env("dev", Get(func(ctx context.Context, in struct{ Debug Fixed }) (string, error) {
+				return "verbose debug", nil
+			})),
+		),
+	))
+	if assert.NoError(t, err) {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/debug", nil))
+		assert.Equal(t, `"verbose debug"`+"\n", w.Body.String())
+	}
+	for _, environments := range []string{"", "dev,,staging", "dev, "} {
+		_, err = New(testOptions(Environment("staging"), Env(environments)))
+		assert.ErrorContains(t, err, fmt.Sprintf("Env(%q) has an empty environment", environments))
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	logged := func(next http.Handler) http.Handler { return next }
+	routes, err := Routes(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (string, error) {
+				return "", nil
+			}),
+			Middleware(logged),
+			Post(func(ctx context.Context, in struct {
+				Users Fixed
+				Body  struct{ Name string }
+			}) (string, error) {
+				return "", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("Routes() error = %v", err)
+		return
+	}
+
+	assert.Equal(t, []string{"type route.Fixed", "type int"}, routes[0].Providers)
+	dependencies := Dependencies(routes)
+	assert.Equal(t, []string{"GET /users/{ID}", "POST /users"}, dependencies["type route.Fixed"])
+	assert.Equal(t, []string{"POST /users"}, dependencies["name Body"])
+	assert.Equal(t, []string{"POST /users"}, dependencies["middleware "+funcName(logged)])
+
+	var graph strings.Builder
+	assert.NoError(t, PrintDependencyGraph(&graph, routes))
+	assert.Contains(t, graph.String(), "\t\"POST /users\" -> \"name Body\";\n")
+	assert.True(t, strings.HasPrefix(graph.String(), "digraph routes {"))
+}
+
+func TestFixtures(t *testing.T) {
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	routes := func(handler func(id int) (user, error), opts ...Option) http.HandlerFunc {
+		h, err := New(testOptions(append(opts, Get(func(ctx context.Context, in struct {
+			Users Fixed
+			ID    int
+		}) (user, error) {
+			return handler(in.ID)
+		}))...))
+		if err != nil {
+			t.Errorf("New() error = %v", err)
+		}
+		return h
+	}
+	serve := func(handler http.HandlerFunc, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	var fixtures []Fixture
+	recording := routes(func(id int) (user, error) {
+		switch id {
+		case 0:
+			return user{}, WithStatus(http.StatusNotFound, errors.New("user 0 not found"))
+		case 9:
+			return user{}, ErrNoContent
+		}
+		return user{ID: id, Name: "Ada"}, nil
+	}, RecordFixtures(func(ctx context.Context, fixture Fixture) {
+		fixtures = append(fixtures, fixture)
+	}))
+	serve(recording, "/users/1")
+	serve(recording, "/users/0")
+	assert.Equal(t, http.StatusNoContent, serve(recording, "/users/9").Code)
+	assert.Equal(t, []Fixture{
+		{Route: "GET /users/{ID}", Input: json.RawMessage(`{"Users":{},"ID":1}`), Output: json.RawMessage(`{"id":1,"name":"Ada"}`)},
+		{Route: "GET /users/{ID}", Input: json.RawMessage(`{"Users":{},"ID":0}`), Error: "user 0 not found", Status: http.StatusNotFound},
+		{Route: "GET /users/{ID}", Input: json.RawMessage(`{"Users":{},"ID":9}`), Status: http.StatusNoContent},
+	}, fixtures)
+
+	stub := routes(func(id int) (user, error) {
+		t.Errorf("handler called while replaying")
+		return user{}, nil
+	}, ReplayFixtures(fixtures))
+	w := serve(stub, "/users/1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"id":1,"name":"Ada"}`+"\n", w.Body.String())
+	assert.Equal(t, http.StatusNotFound, serve(stub, "/users/0").Code)
+	w = serve(stub, "/users/9")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, http.StatusNotImplemented, serve(stub, "/users/2").Code)
+}
+
+func TestFaultInjection(t *testing.T) {
+	var enabled atomic.Bool
+	on := func(ctx context.Context) bool { return enabled.Load() }
+	handler, err := New(
+		testOptions(
+			FaultInjection(on, &Faults{ErrorRate: 1, ErrorStatus: http.StatusBadGateway}),
+			Get(func(ctx context.Context, in struct {
+				Orders Fixed
+			}) (string, error) {
+				return "orders", nil
+			}),
+			Group(
+				FaultInjection(on, &Faults{DropRate: 1, DelayRate: 1, Delay: time.Millisecond}),
+				Get(func(ctx context.Context, in struct {
+					Users Fixed
+				}) (string, error) {
+					return "users", nil
+				}),
+			),
+			FaultInjection(nil, nil),
+			Get(func(ctx context.Context, in struct {
+				Health Fixed
+			}) (string, error) {
+				return "ok", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/orders"))
+	assert.Equal(t, http.StatusOK, serve("/users"))
+
+	enabled.Store(true)
+	assert.Equal(t, http.StatusBadGateway, serve("/orders"))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { serve("/users") })
+	assert.Equal(t, http.StatusOK, serve("/health"))
+
+	_, err = New(testOptions(FaultInjection(on, &Faults{ErrorRate: 0.6, DropRate: 0.6})))
+	assert.ErrorContains(t, err, "error and drop rates add up to more than 1")
+	_, err = New(testOptions(FaultInjection(on, &Faults{DelayRate: 2})))
+	assert.ErrorContains(t, err, "delay rate 2 is not between 0 and 1")
+}
+
+func TestSampler(t *testing.T) {
+	type login struct {
+		User     string `json:"user"`
+		Password string `json:"password"`
+	}
+	var samples []Sample
+	handler, err := New(
+		testOptions(
+			Sampler(1, func(ctx context.Context, sample Sample) {
+				samples = append(samples, sample)
+			}, "password"),
+			Post(func(ctx context.Context, in struct {
+				Logins Fixed
+				Body   login
+			}) (string, error) {
+				return in.Body.User, nil
+			}),
+			Sampler(0, func(ctx context.Context, sample Sample) {
+				t.Errorf("sampled at rate 0")
+			}),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+			}) (string, error) {
+				return "users", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/logins", strings.NewReader(`{"user":"ada","password":"secret"}`)))
+	assert.Equal(t, `"ada"`+"\n", w.Body.String())
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+
+	if assert.Len(t, samples, 2) {
+		assert.Equal(t, "POST /logins", samples[0].Route)
+		assert.Equal(t, "/logins", samples[0].Path)
+		assert.JSONEq(t, `{"Logins":{},"Body":{"user":"ada","password":"[REDACTED]"}}`, string(samples[0].Input))
+		assert.Equal(t, "GET /users", samples[1].Route)
+	}
+
+	_, err = New(testOptions(Sampler(1.5, nil)))
+	assert.ErrorContains(t, err, "sample rate 1.5 is not between 0 and 1")
+}
+
+func TestLoadTargets(t *testing.T) {
+	type order struct {
+		Item     string    `json:"item"`
+		Quantity int       `json:"quantity"`
+		Express  bool      `json:"express,omitempty"`
+		Placed   time.Time `json:"placed"`
+	}
+	routes, err := Routes(
+		testOptions(
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+				ID    int
+			}) (string, error) {
+				return "", nil
+			}),
+			Post(func(ctx context.Context, in struct {
+				Orders Fixed
+				Body   order
+			}) (string, error) {
+				return "", nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("Routes() error = %v", err)
+		return
+	}
+
+	targets := LoadTargets(routes, "http://localhost:8080/", map[string]string{"ID": "42"})
+	assert.Equal(t, []LoadTarget{
+		{Method: "GET", URL: "http://localhost:8080/users/42"},
+		{Method: "POST", URL: "http://localhost:8080/orders", Body: json.RawMessage(`{"express":true,"item":"example","placed":"2006-01-02T15:04:05Z","quantity":1}`)},
+	}, targets)
+
+	var vegeta strings.Builder
+	assert.NoError(t, WriteVegetaTargets(&vegeta, targets))
+	lines := strings.Split(strings.TrimSpace(vegeta.String()), "\n")
+	assert.Equal(t, `{"method":"GET","url":"http://localhost:8080/users/42"}`, lines[0])
+	var posted struct {
+		Body   []byte
+		Header http.Header
+	}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &posted))
+	assert.JSONEq(t, string(targets[1].Body), string(posted.Body))
+	assert.Equal(t, "application/json", posted.Header.Get("Content-Type"))
+
+	var k6 strings.Builder
+	assert.NoError(t, WriteK6Script(&k6, targets))
+	assert.Contains(t, k6.String(), "import http from 'k6/http';")
+	assert.Contains(t, k6.String(), `"url": "http://localhost:8080/users/42"`)
+}
+
+func TestRouteConfigSnapshot(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Group(
+				HandleError(func(ctx context.Context, w http.ResponseWriter, err error) {
+					w.WriteHeader(http.StatusTeapot)
+				}),
+				Nonce([]byte("secret"), time.Minute, NewMemoryNonceStore()),
+				Post(func(ctx context.Context, in struct {
+					Hook Fixed
+				}) (string, error) {
+					return "ok", nil
+				}),
+			),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/hook", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusTeapot, w.Code)
+}
+
+func TestLateResponseEncoder(t *testing.T) {
+	options := Join(
+		PathByNameOfFixedTyped(strings.ToLower),
+		Get(func(ctx context.Context, in struct {
+			Users Fixed
+		}) (string, error) {
+			return "users", nil
+		}),
+		Get(func(ctx context.Context, in struct {
+			Orders Fixed
+		}) (string, error) {
+			return "", WithStatus(http.StatusConflict, errors.New("locked"))
+		}),
+		// options after the routes still apply to them
+		JSONResponse(),
+		HandleError(func(ctx context.Context, w http.ResponseWriter, err error) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+	)
+	assert.NoError(t, Validate(options))
+	handler, err := New(options)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/users", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"users"`+"\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/orders", nil))
+	assert.Equal(t, http.StatusTeapot, w.Code)
+}
+
+func TestRequireTLS(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Group(
+				RequireTLS(false),
+				Get(func(ctx context.Context, in struct {
+					Accounts Fixed
+				}) (string, error) {
+					return "accounts", nil
+				}),
+			),
+			RequireTLS(true),
+			Get(func(ctx context.Context, in struct {
+				Users Fixed
+			}) (string, error) {
+				return "users", nil
+			}),
+			RequireTLS(false),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.RemoteAddr = "203.0.113.1:1234"
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve("https://example.com/accounts").Code)
+	assert.Equal(t, http.StatusForbidden, serve("http://example.com/accounts").Code)
+	assert.Equal(t, http.StatusOK, serve("https://example.com/users").Code)
+	w := serve("http://example.com/users?page=2")
+	assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+	assert.Equal(t, "https://example.com/users?page=2", w.Header().Get("Location"))
+}
+
+func TestRequireTLSTrustedProxies(t *testing.T) {
+	handler, err := New(
+		testOptions(
+			Group(
+				TrustedProxies("10.0.0.0/8"),
+				RequireTLS(false),
+				Get(func(ctx context.Context, in struct {
+					Accounts Fixed
+				}) (string, error) {
+					return "accounts", nil
+				}),
+			),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	serve := func(remoteAddr, proto string) int {
+		req := httptest.NewRequest("GET", "/accounts", nil)
+		req.RemoteAddr = remoteAddr
+		if proto != "" {
+			req.Header.Set("X-Forwarded-Proto", proto)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("10.1.2.3:1234", "https"))
+	assert.Equal(t, http.StatusForbidden, serve("10.1.2.3:1234", ""))
+	assert.Equal(t, http.StatusForbidden, serve("10.1.2.3:1234", "http"))
+	assert.Equal(t, http.StatusForbidden, serve("203.0.113.1:1234", "https"))
+}
+
+func TestShadow(t *testing.T) {
+	type mirrored struct {
+		method, path, header, body string
+	}
+	mirrors := make(chan mirrored, 1)
+	reports := make(chan error, 1)
+	handler, err := New(
+		testOptions(
+			Shadow(100, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				switch string(body) {
+				case `"panic"`:
+					panic("shadow broke")
+				case `"fail"`:
+					w.Header().Set("X-Shadow", "true")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				mirrors <- mirrored{r.Method, r.URL.RequestURI(), r.Header.Get("X-Request-Id"), string(body)}
+			}), func(ctx context.Context, err error) {
+				reports <- err
+			}),
+			Post(func(ctx context.Context, in struct {
+				Orders Fixed
+				Body   string
+			}) (string, error) {
+				return "primary " + strconv.Itoa(len(in.Body)), nil
+			}),
+		),
+	)
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/orders?express=1", strings.NewReader(body))
+		req.Header.Set("X-Request-Id", "r1")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	w := post(`"book"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"primary 4"`+"\n", w.Body.String())
+	assert.Equal(t, mirrored{"POST", "/orders?express=1", "r1", `"book"`}, <-mirrors)
+
+	w = post(`"panic"`)
+	assert.Equal(t, `"primary 5"`+"\n", w.Body.String())
+	var panicErr *PanicError
+	assert.ErrorAs(t, <-reports, &panicErr)
+
+	w = post(`"fail"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Shadow"))
+	assert.EqualError(t, <-reports, "shadow of POST /orders answered with status 500")
+
+	large := `"` + strings.Repeat("x", shadowBodyLimit) + `"`
+	w = post(large)
+	assert.Equal(t, `"primary `+strconv.Itoa(shadowBodyLimit)+`"`+"\n", w.Body.String())
+	assert.ErrorContains(t, <-reports, "mirroring POST /orders: body exceeds")
+	select {
+	case m := <-mirrors:
+		t.Errorf("large body mirrored: %s", m.path)
+	default:
+	}
+}
@@ -2,8 +2,15 @@ package route
 
 import (
 	"context"
+	"fmt"
+	"maps"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"reflect"
+	"slices"
+	"strings"
+	"time"
 )
 
 type router struct {
@@ -12,6 +19,40 @@ type router struct {
 	put    node
 	delete node
 
+	config
+
+	routes      []RouteInfo
+	normalize   PathNormalization
+	strictPaths bool
+	matrix      bool
+	environment string
+
+	canonicalQuery func(url.Values) error
+	rewrites       []func(path string) (rest, stripped string, ok bool)
+
+	fieldOptions map[string]bool
+	problems     []error
+	// root is the config of the top level router, routes fall back to its response encoder and error handler.
+	root *config
+	// unencoded are the routes registered without response encoder, a problem unless one is set later.
+	unencoded []error
+
+	// overrides replace the field options of the keys for all routes registered after them.
+	overrides map[string]FieldOption[any]
+
+	// operational replaces the options of the Reconfigurable of the same name once set by Router.Reconfigure.
+	operational map[string][]Option
+	// reconfigurable holds the names of the applied Reconfigurable options.
+	reconfigurable map[string]bool
+	// replaying is set while a Router rebuild applies options that were applied before.
+	replaying bool
+	// variant is the name of the Variant whose routes the router registers.
+	variant string
+}
+
+// config holds the settings options make for the routes registered after them.
+// Routes capture the config at registration and Group restores it afterwards.
+type config struct {
 	nameRouteOptions map[string]FieldOption[any]
 	typeRouteOptions map[reflect.Type]FieldOption[any]
 
@@ -19,14 +60,229 @@ type router struct {
 
 	handleErr func(context.Context, http.ResponseWriter, error)
 
-	middleware []func(http.Handler) http.Handler
+	// live is the config of the router for the configs routes capture. Routes whose config sets no response
+	// encoder or error handler fall back to the ones set after them.
+	live *config
+	// state carries the state of stateful wrappers over Router rebuilds.
+	state *wrapperState
+
+	middleware   []func(http.Handler) http.Handler
+	interceptors []interceptor
+	onInput      []func(context.Context, reflect.Value) error
+	onResponse   []func(context.Context, RouteInfo, any) (any, error)
+	afterCommit  []func(ctx context.Context, info RouteInfo, input, output any)
+
+	deprecation   *deprecation
+	audit         *audit
+	slow          *slowRequest
+	tracer        Tracer
+	fieldMetrics  func(context.Context, FieldRecord)
+	nonce         *nonceVerifier
+	signedURLs    *signedURLs
+	cache         *responseCache
+	coalesce      *coalescer
+	dedupe        *deduper
+	concurrency   *concurrencyLimit
+	breaker       *breakerSettings
+	shedder       *loadShedder
+	priority      PriorityClass
+	shadow        *shadow
+	trailers      []string
+	responseLimit *responseLimit
+	requireTLS    *requireTLS
+	echoInput     string
+	tenancy       *tenancy
+	tenantScope   func(Tenant) bool
+
+	flagProvider func(context.Context, string) bool
+	featureFlag  *featureFlag
+	maintenance  *Maintenance
+	killSwitches *KillSwitches
+	faults       *faultInjection
+
+	trustedProxies []netip.Prefix
+
+	cors           *CORSPolicy
+	rateLimit      *rateLimit
+	authenticate   func(*http.Request) []string
+	requiredScopes *requiredScopes
+
+	noAutoHead    bool
+	noAutoOptions bool
+}
+
+func (c config) clone() config {
+	c.nameRouteOptions = maps.Clone(c.nameRouteOptions)
+	c.typeRouteOptions = maps.Clone(c.typeRouteOptions)
+	c.middleware = slices.Clip(c.middleware)
+	c.interceptors = slices.Clip(c.interceptors)
+	c.onInput = slices.Clip(c.onInput)
+	c.onResponse = slices.Clip(c.onResponse)
+	c.afterCommit = slices.Clip(c.afterCommit)
+	c.trailers = slices.Clip(c.trailers)
+	return c
+}
+
+// register sets the handler of a route node wrapped by the middleware and the per route behavior of the config.
+func (r *router) register(node *node, info RouteInfo, handler http.Handler) {
+	info.Middleware = r.middlewareNames()
+	if r.deprecation != nil {
+		info.Deprecated = true
+		if !r.deprecation.sunset.IsZero() {
+			info.Sunset = &r.deprecation.sunset
+		}
+	}
+	if r.featureFlag != nil {
+		info.FeatureFlag = r.featureFlag.name
+	}
+	info.Priority = r.priority
+	info.Variant = r.variant
+	r.routes = append(r.routes, info)
+	// the wrappers keep the config of the route, later options and groups change the router's
+	cfg := r.config.clone()
+	cfg.live = r.root
+	node.handler = cfg.wrap(info, handler)
+	node.noAutoHead = r.noAutoHead
+	node.noAutoOptions = r.noAutoOptions
+	node.cors = r.cors
+}
+
+func (c *config) wrap(info RouteInfo, handler http.Handler) http.Handler {
+	if c.responseLimit != nil {
+		handler = c.responseLimit.wrap(c, info, handler)
+	}
+	if len(c.trailers) > 0 {
+		handler = announceTrailers(c.trailers, handler)
+	}
+	if c.breaker != nil {
+		breaker := stateOf(c.state, routeKey("breaker", info, *c.breaker), func() *circuitBreaker {
+			return newCircuitBreaker(*c.breaker)
+		})
+		handler = bypassWarmup(breaker.wrap(c, handler), handler)
+	}
+	if c.concurrency != nil {
+		handler = c.concurrency.wrap(c, info, handler)
+	}
+	if c.coalesce != nil {
+		handler = bypassWarmup(c.coalesce.wrap(info, handler), handler)
+	}
+	if c.cache != nil {
+		handler = bypassWarmup(c.cache.wrap(info, handler), handler)
+	}
+	if c.dedupe != nil {
+		handler = bypassWarmup(c.dedupe.wrap(info, handler), handler)
+	}
+	if c.nonce != nil {
+		handler = c.nonce.wrap(c, handler)
+	}
+	if c.signedURLs != nil {
+		handler = c.signedURLs.wrap(c, handler)
+	}
+	if c.requiredScopes != nil {
+		handler = c.requiredScopes.wrap(c, handler)
+	}
+	for _, middleware := range c.middleware {
+		handler = middleware(handler)
+	}
+	if c.tenancy != nil {
+		handler = c.tenancy.wrap(c, c.tenantScope, handler)
+	}
+	if c.requireTLS != nil {
+		handler = c.requireTLS.wrap(c, handler)
+	}
+	if c.rateLimit != nil {
+		handler = bypassWarmup(c.rateLimit.wrap(c, info, handler), handler)
+	}
+	if c.shadow != nil {
+		handler = bypassWarmup(c.shadow.wrap(handler), handler)
+	}
+	if c.shedder != nil {
+		handler = c.shedder.wrap(c, c.priority, handler)
+	}
+	if c.featureFlag != nil {
+		handler = c.featureFlag.wrap(c, handler)
+	}
+	if c.deprecation != nil {
+		handler = c.deprecation.wrap(handler)
+	}
+	if c.maintenance != nil {
+		handler = c.maintenance.wrap(c, handler)
+	}
+	if c.killSwitches != nil {
+		handler = c.killSwitches.wrap(c, info, handler)
+	}
+	if c.faults != nil {
+		handler = bypassWarmup(c.faults.wrap(c, info, handler), handler)
+	}
+	if c.audit != nil {
+		handler = bypassWarmup(c.audit.wrap(info, handler), handler)
+	}
+	if c.slow != nil {
+		handler = bypassWarmup(c.slow.wrap(info, handler), handler)
+	}
+	if c.tracer != nil {
+		handler = c.traceRoute(info, handler)
+	}
+	if c.cors != nil {
+		handler = c.cors.wrap(handler)
+	}
+	if c.noAutoHead && info.Method == http.MethodGet {
+		handler = rejectHead(c, handler)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ex := &exchange{route: &info, start: time.Now()}
+		r = r.WithContext(withExchange(r.Context(), ex))
+		ex.request = r
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.matrix {
+		stripped, err := stripMatrix(req)
+		if err != nil {
+			r.serveErr(w, req, WithStatus(http.StatusBadRequest, err))
+			return
+		}
+		req = stripped
+	}
+	rewritten, err := r.rewritePath(req)
+	if err != nil {
+		r.serveErr(w, req, err)
+		return
+	}
+	req, path, err := r.normalizePath(rewritten)
+	if err != nil {
+		r.serveErr(w, req, WithStatus(http.StatusBadRequest, err))
+		return
+	}
+
+	if req.Method == http.MethodOptions && r.serveOptions(w, req, path) {
+		return
+	}
+	handler, ok := r.Node(req.Method).Handler(path)
+	if !ok {
+		r.serveErr(w, req, WithStatus(http.StatusNotFound, Messagef("not found")))
+		return
+	}
+	canonical, err := r.canonicalizeQuery(req)
+	if err != nil {
+		r.serveErr(w, req, err)
+		return
+	}
+	handler.ServeHTTP(w, canonical)
+}
+
+// serveErr handles errors of requests that did not reach a route with the request in the context.
+func (r *router) serveErr(w http.ResponseWriter, req *http.Request, err error) {
+	ctx, _ := exchangeOf(req)
+	r.HandleErr(ctx, w, err)
 }
 
 func (r *router) Node(method string) node {
 	switch method {
-	case http.MethodHead:
-		fallthrough
-	case http.MethodGet:
+	case http.MethodGet, http.MethodHead:
+		// HEAD requests are answered by the GET routes unless they disable it with AutomaticHead.
 		return r.get
 	case http.MethodPost:
 		return r.post
@@ -39,12 +295,42 @@ func (r *router) Node(method string) node {
 	}
 }
 
-func (r *router) HandleErr(ctx context.Context, w http.ResponseWriter, err error) {
+func (r *router) tree(method string) *node {
+	switch method {
+	case http.MethodGet:
+		return &r.get
+	case http.MethodPost:
+		return &r.post
+	case http.MethodPut:
+		return &r.put
+	case http.MethodDelete:
+		return &r.delete
+	default:
+		return nil
+	}
+}
+
+// encoder returns the response encoder of the config or else the one of the router.
+func (r *config) encoder() func(context.Context, http.ResponseWriter, any) error {
+	if r.responseEncoder == nil && r.live != nil {
+		return r.live.responseEncoder
+	}
+	return r.responseEncoder
+}
+
+func (r *config) HandleErr(ctx context.Context, w http.ResponseWriter, err error) {
 	if r.handleErr != nil {
 		r.handleErr(ctx, w, err)
 		return
 	}
-	http.Error(w, err.Error(), http.StatusInternalServerError)
+	if r.live != nil && r.live.handleErr != nil {
+		r.live.handleErr(ctx, w, err)
+		return
+	}
+	if ResponseCommitted(w) {
+		return
+	}
+	http.Error(w, err.Error(), StatusCode(err))
 }
 
 func (r *router) addTypeRouteOption(t reflect.Type, option FieldOption[any]) {
@@ -52,6 +338,7 @@ func (r *router) addTypeRouteOption(t reflect.Type, option FieldOption[any]) {
 		r.typeRouteOptions = make(map[reflect.Type]FieldOption[any])
 	}
 	r.typeRouteOptions[t] = option
+	r.useFieldOption(typeOptionKey(t), false)
 }
 
 func (r *router) addNameRouteOption(name string, option FieldOption[any]) {
@@ -59,22 +346,69 @@ func (r *router) addNameRouteOption(name string, option FieldOption[any]) {
 		r.nameRouteOptions = make(map[string]FieldOption[any])
 	}
 	r.nameRouteOptions[name] = option
+	r.useFieldOption(nameOptionKey(name), false)
 }
 
-func (r *router) routeOption(field reflect.StructField) (FieldOption[any], bool) {
+// routeOption returns the field option of the field and its key, which names the provider in RouteInfo.Providers.
+func (r *router) routeOption(field reflect.StructField) (FieldOption[any], string, bool) {
+	option, key, ok := r.registeredOption(field)
+	if !ok {
+		return nil, "", false
+	}
+	if override, ok := r.overrides[nameOptionKey(field.Name)]; ok {
+		return override, key, true
+	}
+	if override, ok := r.overrides[typeOptionKey(field.Type)]; ok {
+		return override, key, true
+	}
+	return option, key, true
+}
+
+func (r *router) registeredOption(field reflect.StructField) (FieldOption[any], string, bool) {
 	if named, ok := r.nameRouteOptions[field.Name]; ok {
-		return named, true
+		key := nameOptionKey(field.Name)
+		r.useFieldOption(key, true)
+		return named, key, true
 	}
 
 	if typed, ok := r.typeRouteOptions[field.Type]; ok {
-		return typed, true
+		key := typeOptionKey(field.Type)
+		r.useFieldOption(key, true)
+		return typed, key, true
+	}
+	return nil, "", false
+}
+
+func (r *router) addOverride(key string, option FieldOption[any]) {
+	if r.overrides == nil {
+		r.overrides = make(map[string]FieldOption[any])
 	}
-	return nil, false
+	r.overrides[key] = option
 }
 
 type route struct {
 	*node
-	fields []fieldModifier[any]
+	config   *config
+	method   string
+	segments []string
+	fields   []fieldModifier[any]
+	names    []string
+	parallel map[string]bool
+}
+
+// fixedRoute returns a route of the method at the fixed path.
+func (r *router) fixedRoute(method, path string) route {
+	route := route{node: r.tree(method), method: method}
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if segment != "" {
+			route.addFixedToPath(segment)
+		}
+	}
+	return route
+}
+
+func (r *route) pattern() string {
+	return "/" + strings.Join(r.segments, "/")
 }
 
 func (r *route) addFixedToPath(name string) {
@@ -87,15 +421,17 @@ func (r *route) addFixedToPath(name string) {
 		r.childs[name] = next
 	}
 	r.node = next
+	r.segments = append(r.segments, name)
 }
 
-func (r *route) addVarToPath() {
+func (r *route) addVarToPath(name string) {
 	next := r.child
 	if next == nil {
 		next = &node{}
 		r.child = next
 	}
 	r.node = next
+	r.segments = append(r.segments, "{"+name+"}")
 }
 
 type request struct {
@@ -110,6 +446,49 @@ func (r *request) popPath() string {
 }
 
 func typeOf[T any]() reflect.Type {
-	var t T
-	return reflect.TypeOf(t)
+	return reflect.TypeFor[T]()
+}
+
+// missingOption describes a field without option with the route it belongs to and
+// the registered names and types it most likely was meant to match.
+func (r *router) missingOption(route *route, field reflect.StructField) error {
+	var hints []string
+	for name := range r.nameRouteOptions {
+		if strings.EqualFold(name, field.Name) || editDistance(strings.ToLower(name), strings.ToLower(field.Name)) <= 2 {
+			hints = append(hints, "name "+name)
+		}
+	}
+	for t := range r.typeRouteOptions {
+		if t.Name() == field.Type.Name() || t.String() == "*"+field.Type.String() || "*"+t.String() == field.Type.String() {
+			hints = append(hints, "type "+t.String())
+		}
+	}
+	slices.Sort(hints)
+
+	msg := fmt.Sprintf("%s %s: no option for field %s type %s", route.method, route.pattern(), field.Name, field.Type)
+	if len(hints) > 0 {
+		msg += ", did you mean " + strings.Join(hints, " or ") + "?"
+	}
+	return fmt.Errorf("%s; register one with ByName(%q, ...) or ByType[%s](...)", msg, field.Name, field.Type)
+}
+
+// editDistance returns the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
 }
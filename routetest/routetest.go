@@ -0,0 +1,33 @@
+// Package routetest helps testing handlers built with route, e.g. with test doubles for shared providers.
+package routetest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/generikvault/route"
+)
+
+// New returns the handler of opts with the overrides applied to all of its routes, so a test can swap
+// single providers without reconstructing the option set, e.g.
+//
+//	handler := routetest.New(t, app.Options(), routetest.Value[*sql.Tx](fakeTx))
+//
+// The overrides are route.OverrideByName and route.OverrideByType options or Value. It fails the test
+// if the options fail.
+func New(tb testing.TB, opts []route.Option, overrides ...route.Option) http.HandlerFunc {
+	tb.Helper()
+	handler, err := route.New(append(overrides, opts...)...)
+	if err != nil {
+		tb.Fatalf("route.New() error = %v", err)
+	}
+	return handler
+}
+
+// Value returns an override binding value into the fields of type T instead of their registered provider.
+func Value[T any](value T) route.Option {
+	return route.OverrideByType[T](route.RequestValue(func(r *http.Request, v *T) error {
+		*v = value
+		return nil
+	}))
+}
@@ -0,0 +1,72 @@
+package routetest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/generikvault/route"
+	"github.com/stretchr/testify/assert"
+)
+
+type greeter interface {
+	Greet() string
+}
+
+type greeting string
+
+func (g greeting) Greet() string {
+	return string(g)
+}
+
+func appOptions() []route.Option {
+	return []route.Option{
+		route.JSONResponse(),
+		route.PathByNameOfFixedTyped(strings.ToLower),
+		route.ByType(route.RequestValue(func(r *http.Request, v *greeter) error {
+			*v = greeting("hello from production")
+			return nil
+		})),
+		route.Get(func(ctx context.Context, in struct {
+			Greetings route.Fixed
+			Greeter   greeter
+		}) (string, error) {
+			return in.Greeter.Greet(), nil
+		}),
+	}
+}
+
+func TestNew(t *testing.T) {
+	serve := func(handler http.HandlerFunc) string {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/greetings", nil))
+		return w.Body.String()
+	}
+
+	assert.Equal(t, "\"hello from production\"\n", serve(New(t, appOptions())))
+	assert.Equal(t, "\"hello from test\"\n", serve(New(t, appOptions(), Value[greeter](greeting("hello from test")))))
+	assert.Equal(t, "\"hello by name\"\n", serve(New(t, appOptions(),
+		Value[greeter](greeting("hello from test")),
+		route.OverrideByName("Greeter", route.RequestValue(func(r *http.Request, v any) error {
+			*v.(*greeter) = greeting("hello by name")
+			return nil
+		})),
+	)))
+}
+
+func TestNewVariant(t *testing.T) {
+	options := append(appOptions(), route.Variant("rewrite", 100, func(r *http.Request) string { return "everyone" },
+		route.Get(func(ctx context.Context, in struct {
+			Greetings route.Fixed
+			Greeter   greeter
+		}) (string, error) {
+			return "variant " + in.Greeter.Greet(), nil
+		}),
+	))
+
+	w := httptest.NewRecorder()
+	New(t, options, Value[greeter](greeting("hello from test")))(w, httptest.NewRequest("GET", "/greetings", nil))
+	assert.Equal(t, "\"variant hello from test\"\n", w.Body.String())
+}
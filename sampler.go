@@ -0,0 +1,54 @@
+package route
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"time"
+)
+
+// Sample is a bound input sampled by Sampler, e.g. to build test corpora and load test scenarios
+// from production traffic.
+type Sample struct {
+	Time  time.Time       `json:"time"`
+	Route string          `json:"route"`
+	Path  string          `json:"path"`
+	Input json.RawMessage `json:"input"`
+}
+
+// Sampler returns an Option that passes a random fraction rate of the bound inputs of the routes registered
+// after it to sink before their handlers are called. Inputs are marshaled as JSON with the values of object
+// fields named like one of redact, e.g. password or token, replaced case-insensitively like BodyLogger does.
+// Tag input fields that hold dependencies instead of request values with json:"-". Inputs that do not marshal
+// are not sampled. Sink is called on the request goroutine, so it should hand the sample off quickly.
+func Sampler(rate float64, sink func(context.Context, Sample), redact ...string) Option {
+	return func(r *router) error {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("sample rate %v is not between 0 and 1", rate)
+		}
+		r.interceptors = append(r.interceptors, interceptor{
+			input:  reflect.TypeFor[any](),
+			output: reflect.TypeFor[any](),
+			intercept: func(ctx context.Context, in any, next func(context.Context, any) (any, error)) (any, error) {
+				ex, ok := exchangeFrom(ctx)
+				if !ok || ex.route == nil || IsWarmup(ctx) || rand.Float64() >= rate {
+					return next(ctx, in)
+				}
+				input, err := json.Marshal(in)
+				if err != nil {
+					return next(ctx, in)
+				}
+				sink(ctx, Sample{
+					Time:  ex.start,
+					Route: ex.route.String(),
+					Path:  ex.request.URL.Path,
+					Input: json.RawMessage(redactBody(input, redact)),
+				})
+				return next(ctx, in)
+			},
+		})
+		return nil
+	}
+}
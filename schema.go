@@ -0,0 +1,329 @@
+package route
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON Schema the package generates and validates against.
+// A schema with Not set to the empty schema allows nothing, generated structs use it
+// as AdditionalProperties to reject unknown fields.
+type Schema struct {
+	Type                 SchemaType         `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Not                  *Schema            `json:"not,omitempty"`
+}
+
+// SchemaType lists the JSON types a schema allows. It is marshaled as a string if it holds a single type.
+type SchemaType []string
+
+func (t SchemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = SchemaType{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// JSONSchemaBody returns a FieldOption that validates the request body against the schema before
+// decoding it as JSON into the field. A nil schema is generated from the field type, which rejects
+// unknown fields and requires all fields that are neither pointers nor tagged omitempty.
+// Violations are rejected with 400 naming the JSON pointer of every offending value.
+func JSONSchemaBody(schema *Schema) FieldOption[any] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[any], error) {
+		s := schema
+		if s == nil {
+			s = SchemaFor(field)
+		}
+		patterns, err := s.compile()
+		if err != nil {
+			return nil, err
+		}
+		return func(r *request, value any) (func(error) error, error) {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				return nil, err
+			}
+			decoder := json.NewDecoder(bytes.NewReader(body))
+			decoder.UseNumber()
+			var doc any
+			if err := decoder.Decode(&doc); err != nil {
+				return nil, WithStatus(http.StatusBadRequest, err)
+			}
+			if errs := s.validate(doc, "", patterns); len(errs) > 0 {
+				return nil, WithStatus(http.StatusBadRequest, errors.Join(errs...))
+			}
+			return nil, json.Unmarshal(body, value)
+		}, nil
+	}
+}
+
+// SchemaFor returns the JSON Schema of the type as encoding/json marshals it, e.g. to derive
+// clients, validators or OpenAPI documents from the structs the handlers use.
+// Structs reject unknown fields and require all fields that are neither pointers nor tagged omitempty.
+func SchemaFor(t reflect.Type) *Schema {
+	if t == nil {
+		return nil
+	}
+	return schemaOf(t, map[reflect.Type]bool{})
+}
+
+// InputSchema returns the schema of the Input of a typed route, nil for untyped ones.
+func (i RouteInfo) InputSchema() *Schema {
+	return SchemaFor(i.InputType)
+}
+
+// OutputSchema returns the schema of the encoded Output of a typed route, nil for untyped ones.
+// The schema of Response like outputs is the one of their Body.
+func (i RouteInfo) OutputSchema() *Schema {
+	if i.OutputType == nil {
+		return nil
+	}
+	return SchemaFor(bodyType(i.OutputType))
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// schemaOf generates the schema of the type as encoding/json marshals it.
+func schemaOf(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+	if visiting[t] {
+		return &Schema{}
+	}
+
+	s := &Schema{}
+	switch {
+	case t == timeType:
+		s.Type, s.Format = SchemaType{"string"}, "date-time"
+	case t.Implements(reflect.TypeFor[json.Marshaler]()):
+		return &Schema{}
+	case t.Kind() == reflect.Bool:
+		s.Type = SchemaType{"boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		s.Type = SchemaType{"integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		s.Type = SchemaType{"number"}
+	case t.Kind() == reflect.String:
+		s.Type = SchemaType{"string"}
+		s.Enum = enumValues(t)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		s.Type, s.Format = SchemaType{"string"}, "byte"
+		nullable = true
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		s.Type = SchemaType{"array"}
+		s.Items = schemaOf(t.Elem(), visiting)
+		nullable = nullable || t.Kind() == reflect.Slice
+	case t.Kind() == reflect.Map:
+		s.Type = SchemaType{"object"}
+		s.AdditionalProperties = schemaOf(t.Elem(), visiting)
+		nullable = true
+	case t.Kind() == reflect.Struct:
+		visiting[t] = true
+		defer delete(visiting, t)
+		s.Type = SchemaType{"object"}
+		s.Properties = map[string]*Schema{}
+		s.AdditionalProperties = &Schema{Not: &Schema{}}
+		addProperties(s, t, visiting)
+	default:
+		return &Schema{}
+	}
+	if nullable {
+		s.Type = append(s.Type, "null")
+	}
+	return s
+}
+
+func addProperties(s *Schema, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addProperties(s, embedded, visiting)
+				continue
+			}
+		}
+		if _, ok := headerTag(field); ok || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		s.Properties[name] = schemaOf(field.Type, visiting)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			s.Properties[name].Enum = enumOf(strings.Split(enum, ","))
+		}
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") && field.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// compile compiles the patterns of the schema and its subschemas.
+func (s *Schema) compile() (map[string]*regexp.Regexp, error) {
+	patterns := map[string]*regexp.Regexp{}
+	var walk func(s *Schema) error
+	walk = func(s *Schema) error {
+		if s == nil {
+			return nil
+		}
+		if s.Pattern != "" && patterns[s.Pattern] == nil {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return fmt.Errorf("schema pattern: %w", err)
+			}
+			patterns[s.Pattern] = re
+		}
+		for _, p := range s.Properties {
+			if err := walk(p); err != nil {
+				return err
+			}
+		}
+		for _, sub := range []*Schema{s.AdditionalProperties, s.Items, s.Not} {
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return patterns, walk(s)
+}
+
+// validate returns the violations of the JSON document decoded with UseNumber, located by JSON pointers.
+func (s *Schema) validate(v any, pointer string, patterns map[string]*regexp.Regexp) []error {
+	at := pointer
+	if at == "" {
+		at = "/"
+	}
+	violation := func(format string, args ...any) []error {
+		return []error{fmt.Errorf("%s: %s", at, fmt.Sprintf(format, args...))}
+	}
+
+	if s.Not != nil && len(s.Not.validate(v, pointer, patterns)) == 0 {
+		return violation("is not allowed")
+	}
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return isJSONType(v, t) }) {
+		return violation("must be of type %s", strings.Join(s.Type, " or "))
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(v) }) {
+		return violation("must be one of %v", s.Enum)
+	}
+
+	var errs []error
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				errs = append(errs, violation("missing required property %q", name)...)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			child := pointer + "/" + strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+			if p, ok := s.Properties[name]; ok {
+				errs = append(errs, p.validate(v[name], child, patterns)...)
+			} else if s.AdditionalProperties != nil {
+				errs = append(errs, s.AdditionalProperties.validate(v[name], child, patterns)...)
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				errs = append(errs, s.Items.validate(item, pointer+"/"+strconv.Itoa(i), patterns)...)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			errs = append(errs, violation("must be at least %d characters long", *s.MinLength)...)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			errs = append(errs, violation("must be at most %d characters long", *s.MaxLength)...)
+		}
+		if s.Pattern != "" && !patterns[s.Pattern].MatchString(v) {
+			errs = append(errs, violation("must match %s", s.Pattern)...)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				errs = append(errs, violation("must be a RFC 3339 date-time")...)
+			}
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			errs = append(errs, violation("must be at least %v", *s.Minimum)...)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			errs = append(errs, violation("must be at most %v", *s.Maximum)...)
+		}
+	}
+	return errs
+}
+
+func isJSONType(v any, t string) bool {
+	switch v := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		f, err := v.Float64()
+		return t == "integer" && err == nil && f == math.Trunc(f)
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ServeOption configures how Serve serves a router.
+type ServeOption func(*serveConfig) error
+
+type serveConfig struct {
+	h2c             bool
+	http3           HTTP3Server
+	shutdownTimeout time.Duration
+	timeouts        Timeouts
+}
+
+// HTTP3Server serves HTTP/3 over QUIC, e.g. an adapter around quic-go's http3.Server.
+// It listens on the UDP port of the address Serve listens on.
+type HTTP3Server interface {
+	ListenAndServe(addr string, handler http.Handler) error
+	Shutdown(ctx context.Context) error
+}
+
+// H2C returns a ServeOption that accepts HTTP/2 over cleartext TCP besides HTTP/1,
+// e.g. for internal gRPC-style clients behind a TLS terminating proxy.
+func H2C() ServeOption {
+	return func(c *serveConfig) error {
+		c.h2c = true
+		return nil
+	}
+}
+
+// HTTP3 returns a ServeOption that serves HTTP/3 with server alongside HTTP/1 and HTTP/2.
+// Responses over TCP advertise it with an Alt-Svc header. HTTP/3 support is experimental.
+func HTTP3(server HTTP3Server) ServeOption {
+	return func(c *serveConfig) error {
+		if server == nil {
+			return errors.New("HTTP3 requires a server")
+		}
+		c.http3 = server
+		return nil
+	}
+}
+
+// ShutdownTimeout returns a ServeOption that limits how long Serve waits for open requests
+// to finish after its context is canceled. The default is 10 seconds.
+func ShutdownTimeout(timeout time.Duration) ServeOption {
+	return func(c *serveConfig) error {
+		c.shutdownTimeout = timeout
+		return nil
+	}
+}
+
+// Timeouts are the timeouts of the connections Serve accepts, see http.Server for their meaning.
+// Zero fields keep the defaults: 10 seconds to read the request headers and no limit otherwise.
+// A WriteTimeout also limits streamed responses like server-sent events.
+type Timeouts struct {
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
+// ServerTimeouts returns a ServeOption that sets the timeouts of the connections, e.g. a shorter ReadHeader
+// against clients that keep connections open by sending their headers slowly.
+func ServerTimeouts(timeouts Timeouts) ServeOption {
+	return func(c *serveConfig) error {
+		if timeouts.ReadHeader < 0 || timeouts.Read < 0 || timeouts.Write < 0 || timeouts.Idle < 0 {
+			return fmt.Errorf("negative server timeouts %+v", timeouts)
+		}
+		if timeouts.ReadHeader != 0 {
+			c.timeouts.ReadHeader = timeouts.ReadHeader
+		}
+		c.timeouts.Read, c.timeouts.Write, c.timeouts.Idle = timeouts.Read, timeouts.Write, timeouts.Idle
+		return nil
+	}
+}
+
+// Serve serves the handler, e.g. a router returned by New, at the TCP address until ctx is canceled
+// and shuts down gracefully then.
+func Serve(ctx context.Context, addr string, handler http.Handler, opts ...ServeOption) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return ServeListener(ctx, listener, handler, opts...)
+}
+
+// ServeListener serves the handler like Serve but accepts the TCP connections from listener.
+func ServeListener(ctx context.Context, listener net.Listener, handler http.Handler, opts ...ServeOption) error {
+	cfg := serveConfig{shutdownTimeout: 10 * time.Second, timeouts: Timeouts{ReadHeader: 10 * time.Second}}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	handler = countConnRequests(handler)
+	server := &http.Server{
+		Handler:           handler,
+		ConnContext:       withConnState,
+		ReadHeaderTimeout: cfg.timeouts.ReadHeader,
+		ReadTimeout:       cfg.timeouts.Read,
+		WriteTimeout:      cfg.timeouts.Write,
+		IdleTimeout:       cfg.timeouts.Idle,
+	}
+	if cfg.h2c {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		server.Protocols = protocols
+	}
+
+	errs := make(chan error, 2)
+	servers := 1
+	if cfg.http3 != nil {
+		_, port, err := net.SplitHostPort(listener.Addr().String())
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		altSvc := fmt.Sprintf(`h3=":%s"; ma=86400`, port)
+		server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Alt-Svc", altSvc)
+			handler.ServeHTTP(w, r)
+		})
+		servers++
+		go func() {
+			errs <- fmt.Errorf("serving HTTP/3: %w", cfg.http3.ListenAndServe(listener.Addr().String(), handler))
+		}()
+	}
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+		servers--
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.shutdownTimeout)
+	defer cancel()
+	shutdown := []error{err, server.Shutdown(shutdownCtx)}
+	if cfg.http3 != nil {
+		shutdown = append(shutdown, cfg.http3.Shutdown(shutdownCtx))
+	}
+	for ; servers > 0; servers-- {
+		if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+			shutdown = append(shutdown, err)
+		}
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		shutdown[0] = nil
+	}
+	return errors.Join(shutdown...)
+}
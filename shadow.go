@@ -0,0 +1,104 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+)
+
+// shadowBodyLimit is the size of the largest request body Shadow buffers to mirror a request.
+const shadowBodyLimit = 1 << 20
+
+// Shadow returns an Option that mirrors percent of the requests to the routes registered after it
+// to target, e.g. a new implementation or an httputil.ReverseProxy to a secondary upstream.
+// Mirrored requests are fire-and-forget: they run after the primary response in the background,
+// their responses are discarded and they don't affect the primary response.
+// Requests with bodies larger than 1 MiB are not mirrored. Report, if not nil, gets the panics of target
+// as PanicError, its 5xx responses and the requests that could not be mirrored.
+func Shadow(percent float64, target http.Handler, report func(context.Context, error)) Option {
+	return func(r *router) error {
+		if report == nil {
+			report = func(context.Context, error) {}
+		}
+		r.shadow = &shadow{percent: percent, target: target, report: report}
+		return nil
+	}
+}
+
+type shadow struct {
+	percent float64
+	target  http.Handler
+	report  func(context.Context, error)
+}
+
+func (s *shadow) wrap(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64()*100 >= s.percent {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil && r.Body != http.NoBody {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, shadowBodyLimit+1))
+			// the primary request reads the buffered part and then whatever is left
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			if err == nil && len(body) > shadowBodyLimit {
+				err = fmt.Errorf("body exceeds %d bytes", shadowBodyLimit)
+			}
+			if err != nil {
+				s.report(r.Context(), fmt.Errorf("mirroring %s %s: %w", r.Method, r.URL.Path, err))
+				handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		// the mirror gets its own exchange so it doesn't race with the primary request
+		ctx := context.WithoutCancel(r.Context())
+		if ex, ok := exchangeFrom(ctx); ok {
+			ctx = withExchange(ctx, &exchange{route: ex.route, start: ex.start})
+		}
+		mirror := r.Clone(ctx)
+		mirror.Body = io.NopCloser(bytes.NewReader(body))
+
+		handler.ServeHTTP(w, r)
+
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					s.report(ctx, newPanicError(p))
+				}
+			}()
+			discard := &discardResponseWriter{header: http.Header{}}
+			s.target.ServeHTTP(discard, mirror)
+			if discard.status >= http.StatusInternalServerError {
+				s.report(ctx, fmt.Errorf("shadow of %s %s answered with status %d", mirror.Method, mirror.URL.Path, discard.status))
+			}
+		}()
+	})
+}
+
+type discardResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(p), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
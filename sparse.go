@@ -0,0 +1,84 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// SparseFields returns an Option that lets clients select the top level fields of the response
+// with the fields query parameter, e.g. ?fields=id,name. Fields of arrays of objects are selected per element.
+// Field names are matched case-insensitively against the JSON representation of the output.
+// It wraps the response encoder set before it, which receives the projected output.
+func SparseFields() Option {
+	return func(r *router) error {
+		encoder := r.responseEncoder
+		if encoder == nil {
+			return errors.New("SparseFields requires a response encoder")
+		}
+		r.responseEncoder = func(ctx context.Context, w http.ResponseWriter, v any) error {
+			ex, ok := exchangeFrom(ctx)
+			if !ok {
+				return encoder(ctx, w, v)
+			}
+			param := ex.request.URL.Query().Get("fields")
+			if param == "" {
+				return encoder(ctx, w, v)
+			}
+			projected, err := project(v, strings.Split(param, ","))
+			if err != nil {
+				return err
+			}
+			return encoder(ctx, w, projected)
+		}
+		return nil
+	}
+}
+
+func project(v any, fields []string) (any, error) {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	return projectValue(generic, fields), nil
+}
+
+// toGeneric converts v into its JSON representation of maps, slices and scalars.
+func toGeneric(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var generic any
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+func projectValue(v any, fields []string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		projected := make(map[string]any, len(fields))
+		for key, value := range v {
+			for _, field := range fields {
+				if strings.EqualFold(key, strings.TrimSpace(field)) {
+					projected[key] = value
+				}
+			}
+		}
+		return projected
+	case []any:
+		for i, element := range v {
+			v[i] = projectValue(element, fields)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,81 @@
+package route
+
+import (
+	"fmt"
+	"sync"
+)
+
+// wrapperState carries the state of stateful wrappers like CircuitBreaker, MaxConcurrent, LoadShed and
+// RateLimit over the rebuilds of a Router, so adding routes or reconfiguring doesn't close open breakers,
+// free taken slots or forget the load. States are keyed by route or option and by their settings,
+// wrappers whose settings changed start afresh.
+type wrapperState struct {
+	mu     sync.Mutex
+	states map[string]any
+	// used holds the keys of the states the current build uses.
+	used map[string]bool
+	// options counts the stateful options the current build applied, their position keys their state.
+	options int
+}
+
+// stateOf returns the state of the key, created with create unless a previous build created it.
+// Without wrapperState, as for New, the state is created.
+func stateOf[T any](s *wrapperState, key string, create func() T) T {
+	if s == nil {
+		return create()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used[key] = true
+	if state, ok := s.states[key].(T); ok {
+		return state
+	}
+	state := create()
+	s.states[key] = state
+	return state
+}
+
+// routeKey returns the key of a wrapper of the route with the settings.
+func routeKey(wrapper string, info RouteInfo, settings ...any) string {
+	return fmt.Sprintf("%s %s %s %v", wrapper, info, info.Variant, settings)
+}
+
+// optionKey returns the key of a stateful option with the settings, it counts the option.
+func (s *wrapperState) optionKey(option string, settings ...any) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.options++
+	return fmt.Sprintf("%s %d %v", option, s.options, settings)
+}
+
+// build starts a build of the router.
+func (s *wrapperState) build() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states == nil {
+		s.states = map[string]any{}
+	}
+	s.used = map[string]bool{}
+	s.options = 0
+}
+
+// prune drops the states the last build didn't use once it replaced the served router.
+func (s *wrapperState) prune() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.states {
+		if !s.used[key] {
+			delete(s.states, key)
+		}
+	}
+}
+
+func withState(state *wrapperState) Option {
+	return func(r *router) error {
+		r.state = state
+		return nil
+	}
+}
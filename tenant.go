@@ -0,0 +1,165 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Tenant is the tenant a request is made for.
+type Tenant struct {
+	ID   string
+	Tier string
+}
+
+// TenantSource extracts the tenant ID from a request.
+type TenantSource struct {
+	id   func(cfg *config, r *http.Request) string
+	path bool
+}
+
+// TenantSubdomain returns a TenantSource taking the tenant ID from the subdomain of domain,
+// e.g. acme for acme.example.com with domain example.com. The host honors TrustedProxies.
+func TenantSubdomain(domain string) TenantSource {
+	return TenantSource{id: func(cfg *config, r *http.Request) string {
+		host := cfg.host(r)
+		if h, _, ok := strings.Cut(host, ":"); ok {
+			host = h
+		}
+		id, _ := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(domain))
+		if id == host || strings.Contains(id, ".") {
+			return ""
+		}
+		return id
+	}}
+}
+
+// TenantHeader returns a TenantSource taking the tenant ID from the request header.
+func TenantHeader(name string) TenantSource {
+	return TenantSource{id: func(cfg *config, r *http.Request) string {
+		return r.Header.Get(name)
+	}}
+}
+
+// TenantPathPrefix returns a TenantSource taking the tenant ID from the first path segment.
+// The routes registered after Tenants must start with a field bound by RequestTenant, which adds the segment.
+func TenantPathPrefix() TenantSource {
+	return TenantSource{path: true, id: func(cfg *config, r *http.Request) string {
+		path, err := splitPath(r.URL, false)
+		if err != nil || len(path) == 0 {
+			return ""
+		}
+		return path[0]
+	}}
+}
+
+// Tenants returns an Option that resolves the tenant of the requests to the routes registered after it
+// once per request, before the middleware runs. Lookup turns the tenant ID from the source into a Tenant;
+// it should report unknown tenants with an error carrying 404. Requests without tenant ID are rejected with 404.
+// Handlers receive the tenant with a RequestTenant field, middleware with TenantFromContext.
+func Tenants(source TenantSource, lookup func(ctx context.Context, id string) (Tenant, error)) Option {
+	return func(r *router) error {
+		r.tenancy = &tenancy{source: source, lookup: lookup}
+		r.tenantScope = nil
+		return nil
+	}
+}
+
+// ForTenants returns an Option that confines the routes registered after it to the tenants with the given IDs.
+// Other tenants get 404. Use it within a Group.
+func ForTenants(ids ...string) Option {
+	return func(r *router) error {
+		r.tenantScope = func(t Tenant) bool {
+			return slices.Contains(ids, t.ID)
+		}
+		return nil
+	}
+}
+
+// ForTenantTiers returns an Option that confines the routes registered after it to the tenants of the given tiers.
+// Other tenants get 404. Use it within a Group.
+func ForTenantTiers(tiers ...string) Option {
+	return func(r *router) error {
+		r.tenantScope = func(t Tenant) bool {
+			return slices.Contains(tiers, t.Tier)
+		}
+		return nil
+	}
+}
+
+// RequestTenant returns a FieldOption that binds the tenant resolved by Tenants.
+// With TenantPathPrefix it adds the tenant path segment and must be the first path field.
+func RequestTenant() FieldOption[*Tenant] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*Tenant], error) {
+		t := route.config.tenancy
+		if t == nil {
+			return nil, errors.New("RequestTenant requires the Tenants option")
+		}
+		if t.source.path {
+			if len(route.segments) > 0 {
+				return nil, errors.New("the tenant must be the first path segment")
+			}
+			route.addVarToPath(name)
+		}
+		return func(r *request, v *Tenant) (func(error) error, error) {
+			if t.source.path {
+				r.popPath()
+			}
+			tenant, ok := TenantFromContext(r.Context())
+			if !ok {
+				return nil, errors.New("no tenant resolved")
+			}
+			*v = tenant
+			return nil, nil
+		}, nil
+	}
+}
+
+// TenantFromContext returns the tenant resolved by Tenants for the request.
+func TenantFromContext(ctx context.Context) (Tenant, bool) {
+	ex, ok := exchangeFrom(ctx)
+	if !ok || ex.tenant == nil {
+		return Tenant{}, false
+	}
+	return *ex.tenant, true
+}
+
+type tenancy struct {
+	source TenantSource
+	lookup func(ctx context.Context, id string) (Tenant, error)
+}
+
+// check reports routes that can not work with the tenant source.
+func (t *tenancy) check(pattern string) error {
+	if t.source.path && !strings.HasPrefix(pattern, "/{") {
+		return fmt.Errorf("%s must start with a RequestTenant field for path prefix tenants", pattern)
+	}
+	return nil
+}
+
+func (t *tenancy) wrap(cfg *config, scope func(Tenant) bool, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := t.source.id(cfg, r)
+		if id == "" {
+			cfg.HandleErr(r.Context(), w, WithStatus(http.StatusNotFound, Messagef("no tenant")))
+			return
+		}
+		tenant, err := t.lookup(r.Context(), id)
+		if err != nil {
+			cfg.HandleErr(r.Context(), w, fmt.Errorf("looking up tenant %q: %w", id, err))
+			return
+		}
+		if scope != nil && !scope(tenant) {
+			cfg.HandleErr(r.Context(), w, WithStatus(http.StatusNotFound, Messagef("not found")))
+			return
+		}
+		if ex, ok := exchangeFrom(r.Context()); ok {
+			ex.tenant = &tenant
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package route
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracer starts spans, e.g. by an adapter to OpenTelemetry. The returned function ends the span
+// with the error it failed with, nil if it succeeded.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, func(err error))
+}
+
+// TracerFunc is a function implementing Tracer.
+type TracerFunc func(ctx context.Context, name string) (context.Context, func(err error))
+
+func (f TracerFunc) Start(ctx context.Context, name string) (context.Context, func(err error)) {
+	return f(ctx, name)
+}
+
+// Tracing returns an Option that traces the requests to the routes registered after it with a span named
+// by method and pattern, e.g. GET /users/{ID}. Typed routes add child spans for the phases bind, handle
+// and encode, so slow body decoding can be told apart from slow business logic. Field options and
+// handlers receive the context of their phase span.
+func Tracing(tracer Tracer) Option {
+	return func(r *router) error {
+		r.tracer = tracer
+		return nil
+	}
+}
+
+func (c *config) traceRoute(info RouteInfo, handler http.Handler) http.Handler {
+	tracer := c.tracer
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, end := tracer.Start(r.Context(), info.Method+" "+info.Pattern)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+		var err error
+		if ex, ok := exchangeFrom(ctx); ok {
+			err = ex.err
+		}
+		end(err)
+	})
+}
+
+// span starts a span of a request phase if the config traces requests.
+func (c *config) span(ctx context.Context, name string) (context.Context, func(error)) {
+	if c.tracer == nil {
+		return ctx, func(error) {}
+	}
+	return c.tracer.Start(ctx, name)
+}
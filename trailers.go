@@ -0,0 +1,51 @@
+package route
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Trailers returns an Option that announces the given HTTP trailers, e.g. a checksum or the processing time,
+// in the Trailer header of the responses of the routes registered after it.
+// Handlers and encoders set their values with SetTrailer while or after the body is written.
+func Trailers(names ...string) Option {
+	return func(r *router) error {
+		r.trailers = append(r.trailers, names...)
+		return nil
+	}
+}
+
+// SetTrailer sets an HTTP trailer of the response of the current request.
+// Trailers not announced with Trailers are sent only if the server supports undeclared trailers.
+func SetTrailer(ctx context.Context, name, value string) {
+	ex, ok := exchangeFrom(ctx)
+	if !ok {
+		return
+	}
+	if ex.trailers == nil {
+		ex.trailers = http.Header{}
+	}
+	ex.trailers.Set(name, value)
+}
+
+func announceTrailers(names []string, handler http.Handler) http.Handler {
+	announced := strings.Join(names, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", announced)
+		handler.ServeHTTP(w, r)
+
+		ex, ok := exchangeFrom(r.Context())
+		if !ok {
+			return
+		}
+		header := w.Header()
+		for name, values := range ex.trailers {
+			if !slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(n, name) }) {
+				name = http.TrailerPrefix + name
+			}
+			header[name] = values
+		}
+	})
+}
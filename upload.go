@@ -0,0 +1,293 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upload is a resumable upload session. Offset is the number of bytes received so far, the upload
+// is complete once it reaches Size.
+type Upload struct {
+	ID       string            `json:"id"`
+	Size     int64             `json:"size"`
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Created  time.Time         `json:"created"`
+}
+
+// Complete reports whether all bytes of the upload were received.
+func (u Upload) Complete() bool {
+	return u.Offset == u.Size
+}
+
+// ErrOffsetMismatch is the error UploadStore.Append fails with if the upload is not at the offset of the chunk,
+// e.g. because a concurrent request appended a chunk meanwhile. Uploads answers it with 409 Conflict.
+var ErrOffsetMismatch = errors.New("upload offset mismatch")
+
+// UploadStore persists resumable uploads and their chunks, e.g. in object storage.
+type UploadStore interface {
+	Create(ctx context.Context, upload Upload) error
+	Load(ctx context.Context, id string) (Upload, bool, error)
+	// Append adds the chunk to the upload, whose offset is offset, and returns the new offset.
+	// It fails with an error wrapping ErrOffsetMismatch if the offset moved meanwhile.
+	Append(ctx context.Context, id string, offset int64, chunk io.Reader) (int64, error)
+	Open(ctx context.Context, id string) (io.ReadCloser, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryUploadStore is an UploadStore holding the uploads in memory. Its zero value is ready to use.
+type MemoryUploadStore struct {
+	mu      sync.Mutex
+	uploads map[string]*memoryUpload
+}
+
+type memoryUpload struct {
+	upload Upload
+	data   []byte
+}
+
+func (s *MemoryUploadStore) Create(ctx context.Context, upload Upload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.uploads == nil {
+		s.uploads = map[string]*memoryUpload{}
+	}
+	s.uploads[upload.ID] = &memoryUpload{upload: upload}
+	return nil
+}
+
+func (s *MemoryUploadStore) Load(ctx context.Context, id string) (Upload, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok {
+		return Upload{}, false, nil
+	}
+	return u.upload, true, nil
+}
+
+func (s *MemoryUploadStore) Append(ctx context.Context, id string, offset int64, chunk io.Reader) (int64, error) {
+	data, err := io.ReadAll(chunk)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok {
+		return 0, fmt.Errorf("upload %s not found", id)
+	}
+	if u.upload.Offset != offset {
+		return u.upload.Offset, fmt.Errorf("%w: upload %s is at offset %d, not %d", ErrOffsetMismatch, id, u.upload.Offset, offset)
+	}
+	u.data = append(u.data, data...)
+	u.upload.Offset += int64(len(data))
+	return u.upload.Offset, err
+}
+
+func (s *MemoryUploadStore) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("upload %s not found", id)
+	}
+	return io.NopCloser(bytes.NewReader(u.data)), nil
+}
+
+func (s *MemoryUploadStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.uploads, id)
+	return nil
+}
+
+// Uploads returns an Option that registers the routes of resumable uploads of up to maxSize bytes:
+//
+//	POST path           creates an upload from a JSON body like {"size": 1048576, "metadata": {...}}
+//	                    and answers 201 Created with the Upload and its Location
+//	GET path/{id}       answers with the Upload, e.g. to resume after a connection failure
+//	PUT path/{id}       appends the body as the chunk given by a Content-Range header like bytes 0-65535/1048576
+//	DELETE path/{id}    aborts the upload
+//
+// Chunks have to start at the offset of the upload or are rejected with 409 Conflict,
+// the responses carry the offset in an Upload-Offset header. Bind completed uploads with CompletedUpload.
+func Uploads(path string, store UploadStore, maxSize int64) Option {
+	return func(r *router) error {
+		cfg := r.config
+		load := func(w http.ResponseWriter, req *http.Request) (Upload, bool) {
+			segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+			upload, err := loadUpload(req.Context(), store, segments[len(segments)-1])
+			if err != nil {
+				cfg.HandleErr(req.Context(), w, err)
+				return Upload{}, false
+			}
+			return upload, true
+		}
+
+		route := r.fixedRoute(http.MethodPost, path)
+		r.register(route.node, RouteInfo{
+			Method:  http.MethodPost,
+			Pattern: route.pattern(),
+			Handler: "create upload",
+		}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var upload Upload
+			if err := json.NewDecoder(req.Body).Decode(&upload); err != nil {
+				cfg.HandleErr(req.Context(), w, WithStatus(http.StatusBadRequest, fmt.Errorf("decoding upload: %w", err)))
+				return
+			}
+			if upload.Size <= 0 || upload.Size > maxSize {
+				cfg.HandleErr(req.Context(), w, WithStatus(http.StatusRequestEntityTooLarge, Messagef("upload size %d is not within 1 and %d", upload.Size, maxSize)))
+				return
+			}
+			id := make([]byte, 16)
+			if _, err := rand.Read(id); err != nil {
+				cfg.HandleErr(req.Context(), w, err)
+				return
+			}
+			upload.ID, upload.Offset, upload.Created = hex.EncodeToString(id), 0, time.Now()
+			if err := store.Create(req.Context(), upload); err != nil {
+				cfg.HandleErr(req.Context(), w, fmt.Errorf("creating upload: %w", err))
+				return
+			}
+			w.Header().Set("Location", prefixed(req.Context(), route.pattern()+"/"+upload.ID))
+			w.Header().Set("Upload-Offset", "0")
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(upload)
+		}))
+
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+			route := r.fixedRoute(method, path)
+			route.addVarToPath("id")
+			var handler http.HandlerFunc
+			switch method {
+			case http.MethodGet:
+				handler = func(w http.ResponseWriter, req *http.Request) {
+					if upload, ok := load(w, req); ok {
+						w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+						writeJSON(w, upload)
+					}
+				}
+			case http.MethodPut:
+				handler = func(w http.ResponseWriter, req *http.Request) {
+					upload, ok := load(w, req)
+					if !ok {
+						return
+					}
+					offset, err := appendChunk(req, store, upload)
+					w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+					if err != nil {
+						cfg.HandleErr(req.Context(), w, err)
+						return
+					}
+					w.WriteHeader(http.StatusNoContent)
+				}
+			case http.MethodDelete:
+				handler = func(w http.ResponseWriter, req *http.Request) {
+					upload, ok := load(w, req)
+					if !ok {
+						return
+					}
+					if err := store.Delete(req.Context(), upload.ID); err != nil {
+						cfg.HandleErr(req.Context(), w, fmt.Errorf("deleting upload: %w", err))
+						return
+					}
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}
+			r.register(route.node, RouteInfo{
+				Method:  method,
+				Pattern: route.pattern(),
+				Handler: strings.ToLower(method) + " upload",
+			}, handler)
+		}
+		return nil
+	}
+}
+
+// loadUpload loads the upload with the id, unknown ones fail with 404.
+func loadUpload(ctx context.Context, store UploadStore, id string) (Upload, error) {
+	upload, ok, err := store.Load(ctx, id)
+	if err != nil {
+		return Upload{}, fmt.Errorf("loading upload: %w", err)
+	}
+	if !ok {
+		return Upload{}, WithStatus(http.StatusNotFound, Messagef("upload %s not found", id))
+	}
+	return upload, nil
+}
+
+// appendChunk appends the body of the request to the upload at the position of its Content-Range.
+func appendChunk(req *http.Request, store UploadStore, upload Upload) (int64, error) {
+	var start, end, size int64
+	if _, err := fmt.Sscanf(req.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil || start > end {
+		return upload.Offset, WithStatus(http.StatusBadRequest, Messagef("invalid Content-Range %q", req.Header.Get("Content-Range")))
+	}
+	switch {
+	case size != upload.Size || end >= size:
+		return upload.Offset, WithStatus(http.StatusBadRequest, Messagef("chunk %d-%d/%d exceeds the upload size %d", start, end, size, upload.Size))
+	case start != upload.Offset:
+		return upload.Offset, WithStatus(http.StatusConflict, Messagef("chunk starts at %d, the upload is at %d", start, upload.Offset))
+	}
+	offset, err := store.Append(req.Context(), upload.ID, start, io.LimitReader(req.Body, end-start+1))
+	if errors.Is(err, ErrOffsetMismatch) {
+		return offset, WithStatus(http.StatusConflict, Messagef("chunk starts at %d, the upload is at %d", start, offset))
+	}
+	if err != nil {
+		return offset, fmt.Errorf("appending chunk: %w", err)
+	}
+	return offset, nil
+}
+
+// UploadedFile is a completed upload bound by CompletedUpload.
+type UploadedFile struct {
+	Upload
+	store UploadStore
+	ctx   context.Context
+}
+
+// Open opens the content of the upload.
+func (f UploadedFile) Open() (io.ReadCloser, error) {
+	if f.store == nil {
+		return nil, errors.New("uploaded file is not bound")
+	}
+	return f.store.Open(f.ctx, f.ID)
+}
+
+// CompletedUpload returns a FieldOption that binds the completed upload of store whose id is given in
+// the query parameter param. Unknown uploads are rejected with 404, incomplete ones with 409 Conflict.
+// The upload is deleted once the request was handled successfully.
+func CompletedUpload(store UploadStore, param string) FieldOption[*UploadedFile] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*UploadedFile], error) {
+		return func(r *request, v *UploadedFile) (func(error) error, error) {
+			id := r.URL.Query().Get(param)
+			if id == "" {
+				return nil, WithStatus(http.StatusBadRequest, Messagef("missing query parameter %s", param))
+			}
+			upload, err := loadUpload(r.Context(), store, id)
+			if err != nil {
+				return nil, err
+			}
+			if !upload.Complete() {
+				return nil, WithStatus(http.StatusConflict, Messagef("upload %s is incomplete at %d of %d bytes", id, upload.Offset, upload.Size))
+			}
+			*v = UploadedFile{Upload: upload, store: store, ctx: r.Context()}
+			return func(err error) error {
+				if err != nil {
+					return nil
+				}
+				return store.Delete(context.WithoutCancel(r.Context()), id)
+			}, nil
+		}, nil
+	}
+}
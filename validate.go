@@ -0,0 +1,84 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Validate registers the routes of the given options and reports everything that is likely a
+// setup mistake as one joined error: routes registered twice, of which only the last one is
+// reachable, variable segments that routes share under different names, field options no route
+// uses and routes without response encoder whose Output does not respond itself.
+// Call it from a test to catch these before they reach production.
+func Validate(opts ...Option) error {
+	router, err := newRouter(opts...)
+	if err != nil {
+		return err
+	}
+	return router.validate()
+}
+
+func (r *router) validate() error {
+	errs := slices.Clone(r.problems)
+	if r.responseEncoder == nil {
+		errs = append(errs, r.unencoded...)
+	}
+
+	seen := map[string]int{}
+	for _, info := range r.routes {
+		key := info.String() + " " + info.Variant
+		seen[key]++
+		if seen[key] == 2 {
+			errs = append(errs, fmt.Errorf("%s is registered more than once, only the last one is reachable", info))
+		}
+	}
+
+	variables := map[string]string{}
+	for _, info := range r.routes {
+		prefix := info.Method
+		for _, segment := range strings.Split(strings.TrimPrefix(info.Pattern, "/"), "/") {
+			if !strings.HasPrefix(segment, "{") {
+				prefix += "/" + segment
+				continue
+			}
+			prefix += "/{}"
+			if other, ok := variables[prefix]; ok && other != segment {
+				errs = append(errs, fmt.Errorf("%s names the variable segment %s that other routes name %s", info, segment, other))
+				continue
+			}
+			variables[prefix] = segment
+		}
+	}
+
+	var unused []string
+	for key, used := range r.fieldOptions {
+		if !used {
+			unused = append(unused, key)
+		}
+	}
+	slices.Sort(unused)
+	for _, key := range unused {
+		errs = append(errs, fmt.Errorf("field option for %s is not used by any route", key))
+	}
+
+	return errors.Join(errs...)
+}
+
+// useFieldOption marks the field option of the key as used, or as registered if used is false.
+func (r *router) useFieldOption(key string, used bool) {
+	if r.fieldOptions == nil {
+		r.fieldOptions = make(map[string]bool)
+	}
+	r.fieldOptions[key] = r.fieldOptions[key] || used
+}
+
+func nameOptionKey(name string) string {
+	return "name " + name
+}
+
+func typeOptionKey(t reflect.Type) string {
+	return "type " + t.String()
+}
@@ -0,0 +1,91 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"net/http"
+)
+
+// Variant returns an Option that serves a deterministic percentage of the traffic to the routes
+// registered by opts instead of the routes registered before at the same method and pattern, e.g. for A/B tests.
+// Percent has to be between 0 and 100.
+// Key identifies who sees the variant, e.g. a user ID or a cookie; requests with an empty key get the original route.
+// The chosen variant is available with VariantFromContext.
+func Variant(name string, percent int, key func(*http.Request) string, opts ...Option) Option {
+	return func(r *router) error {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("variant %s: percent %d is not between 0 and 100", name, percent)
+		}
+		if r.reconfigurable == nil {
+			r.reconfigurable = map[string]bool{}
+		}
+		alt := &router{
+			config:         r.config.clone(),
+			root:           r.root,
+			environment:    r.environment,
+			fieldOptions:   r.fieldOptions,
+			overrides:      maps.Clone(r.overrides),
+			operational:    r.operational,
+			reconfigurable: r.reconfigurable,
+			replaying:      r.replaying,
+			variant:        name,
+		}
+		err := Join(opts...)(alt)
+		r.problems = append(r.problems, alt.problems...)
+		r.unencoded = append(r.unencoded, alt.unencoded...)
+		if err != nil {
+			return err
+		}
+
+		for _, info := range alt.routes {
+			control, ok := r.tree(info.Method).nodeOf(info.Pattern)
+			if !ok || control.handler == nil {
+				return fmt.Errorf("variant %s: no route %s to split traffic with", name, info)
+			}
+			variant, _ := alt.tree(info.Method).nodeOf(info.Pattern)
+			control.handler = &variantSplit{
+				name:    name,
+				percent: uint32(percent),
+				key:     key,
+				control: control.handler,
+				variant: variant.handler,
+			}
+			info.Variant = name
+			r.routes = append(r.routes, info)
+		}
+		return nil
+	}
+}
+
+type variantKey struct{}
+
+// VariantFromContext returns the name of the variant serving the request, if any.
+func VariantFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(variantKey{}).(string)
+	return name, ok
+}
+
+type variantSplit struct {
+	name    string
+	percent uint32
+	key     func(*http.Request) string
+	control http.Handler
+	variant http.Handler
+}
+
+func (s *variantSplit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := s.key(r)
+	if key == "" {
+		s.control.ServeHTTP(w, r)
+		return
+	}
+	h := fnv.New32a()
+	h.Write([]byte(s.name + "\x00" + key))
+	if h.Sum32()%100 >= s.percent {
+		s.control.ServeHTTP(w, r)
+		return
+	}
+	s.variant.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), variantKey{}, s.name)))
+}
@@ -0,0 +1,69 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// ErrPreconditionFailed is returned by handlers when the version the client saw is outdated.
+// It is reported with 412 Precondition Failed.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// Version is an opaque entity tag without quotes, bound from the If-Match header by IfMatch.
+// It is empty without If-Match and * for If-Match: *.
+type Version string
+
+// Check returns ErrPreconditionFailed unless the version matches current, the version of the stored entity.
+// An empty version matches every current version and * every existing one, empty current means none exists.
+func (v Version) Check(current Version) error {
+	if v == "" || v == current || v == "*" && current != "" {
+		return nil
+	}
+	return ErrPreconditionFailed
+}
+
+// IfMatch returns a FieldOption that binds the If-Match header into a Version field for optimistic locking.
+// Call it with ByType(IfMatch(true)). Required rejects requests without If-Match with 428 Precondition Required.
+// Weak and multiple entity tags are rejected with 400.
+func IfMatch(required bool) FieldOption[*Version] {
+	return func(route *route, name string, field reflect.Type) (fieldModifier[*Version], error) {
+		return func(r *request, v *Version) (func(error) error, error) {
+			header := strings.TrimSpace(r.Header.Get("If-Match"))
+			switch {
+			case header == "":
+				if required {
+					return nil, WithStatus(http.StatusPreconditionRequired, Messagef("missing If-Match header"))
+				}
+				*v = ""
+			case header == "*":
+				*v = "*"
+			case len(header) >= 2 && header[0] == '"' && header[len(header)-1] == '"' && !strings.Contains(header[1:len(header)-1], `"`):
+				*v = Version(header[1 : len(header)-1])
+			default:
+				return nil, WithStatus(http.StatusBadRequest, Messagef("unsupported If-Match %s", header))
+			}
+			return nil, nil
+		}, nil
+	}
+}
+
+// Versioned is an output that sets the ETag header to the Version of the Value it is encoded as.
+type Versioned[T any] struct {
+	Version Version
+	Value   T
+}
+
+func (v Versioned[T]) SetHeader(header http.Header) {
+	header.Set("ETag", `"`+string(v.Version)+`"`)
+}
+
+func (v Versioned[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Value)
+}
+
+func (v Versioned[T]) MarshalYAML() (any, error) {
+	return v.Value, nil
+}
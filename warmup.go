@@ -0,0 +1,66 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Warmup returns an Option that sends the synthetic requests through the routes registered before it,
+// e.g. built with http.NewRequest, to surface misconfiguration like missing field options or failing
+// encoders before traffic arrives. Construction fails with the responses of 4xx or 5xx status.
+// Unless handlers is set the handlers of Get, Post, Put and Delete routes are not called, their inputs are
+// bound and the zero value of their output is encoded instead. Handlers see the requests with IsWarmup.
+// Other routes like Mount, Proxy or Handle always handle the requests.
+// The requests bypass stateful behavior like ResponseCache, Dedupe, CircuitBreaker, RateLimit, Shadow,
+// FaultInjection, Audit, SlowRequest, Sampler and RecordFixtures, so they never affect or show up in real traffic.
+// Router rebuilds on Add, Remove and Reconfigure do not send them again.
+func Warmup(handlers bool, requests ...*http.Request) Option {
+	return func(r *router) error {
+		if r.replaying {
+			return nil
+		}
+		var errs []error
+		for _, req := range requests {
+			recorder := newResponseRecorder()
+			r.ServeHTTP(recorder, req.WithContext(context.WithValue(req.Context(), warmupKey{}, warmup{handlers: handlers})))
+			response := recorder.response()
+			if response.Status >= http.StatusBadRequest {
+				errs = append(errs, fmt.Errorf("warmup %s %s: status %d: %s", req.Method, req.URL.RequestURI(), response.Status, bytes.TrimSpace(response.Body)))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+type warmupKey struct{}
+
+type warmup struct {
+	handlers bool
+}
+
+// IsWarmup reports whether the request of the context is a synthetic request sent by Warmup.
+func IsWarmup(ctx context.Context) bool {
+	_, ok := ctx.Value(warmupKey{}).(warmup)
+	return ok
+}
+
+// skipHandler reports whether the request is a Warmup request not meant to reach the handlers.
+func skipHandler(ctx context.Context) bool {
+	w, ok := ctx.Value(warmupKey{}).(warmup)
+	return ok && !w.handlers
+}
+
+// bypassWarmup returns a handler serving requests with wrapped except Warmup requests, which handler serves
+// directly, so stateful wrappers like caches never see synthetic requests.
+func bypassWarmup(wrapped, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsWarmup(r.Context()) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		wrapped.ServeHTTP(w, r)
+	})
+}
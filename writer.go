@@ -0,0 +1,128 @@
+package route
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// statusWriter records the status code and the number of bytes written to a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Status returns the status code sent, 200 if the handler wrote nothing.
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// responseRecorder records a response in memory so it can be replayed.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+func (r *responseRecorder) response() CachedResponse {
+	status := r.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return CachedResponse{Status: status, Header: r.header.Clone(), Body: bytes.Clone(r.body.Bytes())}
+}
+
+// committedWriter records whether the response headers were sent, see ResponseCommitted.
+type committedWriter struct {
+	http.ResponseWriter
+	committed bool
+}
+
+func (w *committedWriter) WriteHeader(status int) {
+	if status >= http.StatusOK {
+		w.committed = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *committedWriter) Write(p []byte) (int, error) {
+	w.committed = true
+	return w.ResponseWriter.Write(p)
+}
+
+// FlushError commits the response unless the writers it wraps can't flush it.
+func (w *committedWriter) FlushError() error {
+	if err := http.NewResponseController(w.ResponseWriter).Flush(); err != nil {
+		return err
+	}
+	w.committed = true
+	return nil
+}
+
+func (w *committedWriter) Flush() {
+	_ = w.FlushError()
+}
+
+func (w *committedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ResponseCommitted reports whether the headers of the response of a typed route were already sent,
+// e.g. because the response encoder failed midway. Error handlers can no longer change the status
+// then and must not write an error body onto the partial response, they can only log the error.
+func ResponseCommitted(w http.ResponseWriter) bool {
+	for {
+		switch rw := w.(type) {
+		case *committedWriter:
+			return rw.committed
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return false
+		}
+	}
+}
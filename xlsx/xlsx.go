@@ -0,0 +1,202 @@
+// Package xlsx renders slices of structs as Excel workbooks for export endpoints.
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/generikvault/route"
+)
+
+// ContentType is the media type of xlsx workbooks.
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Response returns an Option that encodes slice of struct outputs as xlsx attachment with the given file name.
+func Response(filename string) route.Option {
+	return route.ResponseEncoder(Encoder(filename))
+}
+
+// Encoder returns a response encoder that writes slice of struct outputs as xlsx attachment with the given file name.
+func Encoder(filename string) func(context.Context, http.ResponseWriter, any) error {
+	return func(ctx context.Context, w http.ResponseWriter, v any) error {
+		var buf bytes.Buffer
+		if err := Write(&buf, v); err != nil {
+			return err
+		}
+		header := w.Header()
+		header.Set("Content-Type", ContentType)
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		header.Set("Content-Length", strconv.Itoa(buf.Len()))
+		_, err := buf.WriteTo(w)
+		return err
+	}
+}
+
+// Write writes a workbook with a single sheet holding a header row of the field names
+// and a row per element of v, which must be a slice of structs or of pointers to structs.
+// The xlsx struct tag overrides the column name, "-" skips the field.
+func Write(w io.Writer, v any) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Slice {
+		return fmt.Errorf("xlsx: expected slice, got %T", v)
+	}
+	elem := value.Type().Elem()
+	if elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return fmt.Errorf("xlsx: expected slice of structs, got %T", v)
+	}
+
+	var columns []int
+	var header []any
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Field(i)
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("xlsx"); ok {
+			name = tag
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		columns = append(columns, i)
+		header = append(header, name)
+	}
+
+	var sheet bytes.Buffer
+	sheet.WriteString(xml.Header)
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	writeRow(&sheet, 1, header)
+	for i := 0; i < value.Len(); i++ {
+		row := value.Index(i)
+		cells := make([]any, len(columns))
+		if row.Kind() == reflect.Pointer {
+			if row.IsNil() {
+				writeRow(&sheet, i+2, cells)
+				continue
+			}
+			row = row.Elem()
+		}
+		for j, column := range columns {
+			cells[j] = row.Field(column).Interface()
+		}
+		writeRow(&sheet, i+2, cells)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	zw := zip.NewWriter(w)
+	for _, file := range []struct {
+		name    string
+		content []byte
+	}{
+		{"[Content_Types].xml", []byte(contentTypes)},
+		{"_rels/.rels", []byte(rels)},
+		{"xl/workbook.xml", []byte(workbook)},
+		{"xl/_rels/workbook.xml.rels", []byte(workbookRels)},
+		{"xl/worksheets/sheet1.xml", sheet.Bytes()},
+	} {
+		fw, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(file.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeRow(buf *bytes.Buffer, row int, cells []any) {
+	fmt.Fprintf(buf, `<row r="%d">`, row)
+	for i, cell := range cells {
+		ref := column(i) + strconv.Itoa(row)
+		switch cell := deref(cell).(type) {
+		case nil:
+		case bool:
+			b := 0
+			if cell {
+				b = 1
+			}
+			fmt.Fprintf(buf, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			fmt.Fprintf(buf, `<c r="%s"><v>%v</v></c>`, ref, cell)
+		case float32:
+			writeFloat(buf, ref, float64(cell), 32)
+		case float64:
+			writeFloat(buf, ref, cell, 64)
+		case time.Time:
+			writeString(buf, ref, cell.Format(time.RFC3339))
+		default:
+			writeString(buf, ref, fmt.Sprint(cell))
+		}
+	}
+	buf.WriteString(`</row>`)
+}
+
+// deref returns the value cell points to, nil pointers are empty cells.
+func deref(cell any) any {
+	value := reflect.ValueOf(cell)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return nil
+	}
+	return value.Interface()
+}
+
+// writeFloat writes f as number, NaN and infinities have no number representation and are written as strings.
+func writeFloat(buf *bytes.Buffer, ref string, f float64, bitSize int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		writeString(buf, ref, strconv.FormatFloat(f, 'g', -1, bitSize))
+		return
+	}
+	fmt.Fprintf(buf, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(f, 'g', -1, bitSize))
+}
+
+func writeString(buf *bytes.Buffer, ref, s string) {
+	fmt.Fprintf(buf, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+	_ = xml.EscapeText(buf, []byte(s))
+	buf.WriteString(`</t></is></c>`)
+}
+
+// column returns the spreadsheet column name of the zero based index, e.g. A, Z, AA.
+func column(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+const contentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const rels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const workbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`</Relationships>`
@@ -0,0 +1,67 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	type row struct {
+		Name   string
+		Amount int
+		Secret string `xlsx:"-"`
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, []row{{Name: "a<b", Amount: 3, Secret: "x"}}))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	f, err := zr.Open("xl/worksheets/sheet1.xml")
+	require.NoError(t, err)
+	sheet, err := io.ReadAll(f)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(sheet), `<c r="A1" t="inlineStr"><is><t xml:space="preserve">Name</t></is></c>`)
+	assert.Contains(t, string(sheet), `<c r="A2" t="inlineStr"><is><t xml:space="preserve">a&lt;b</t></is></c><c r="B2"><v>3</v></c>`)
+	assert.NotContains(t, string(sheet), "Secret")
+}
+
+func TestWriteCells(t *testing.T) {
+	type row struct {
+		Name  *string
+		Count *int
+		Score float64
+		Ratio float32
+	}
+	name, count := "a", 3
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, []row{
+		{Name: &name, Count: &count, Score: 1.5, Ratio: 0.1},
+		{Score: math.NaN(), Ratio: float32(math.Inf(-1))},
+	}))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	f, err := zr.Open("xl/worksheets/sheet1.xml")
+	require.NoError(t, err)
+	sheet, err := io.ReadAll(f)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(sheet), `<row r="2"><c r="A2" t="inlineStr"><is><t xml:space="preserve">a</t></is></c><c r="B2"><v>3</v></c><c r="C2"><v>1.5</v></c><c r="D2"><v>0.1</v></c></row>`)
+	assert.Contains(t, string(sheet), `<row r="3"><c r="C3" t="inlineStr"><is><t xml:space="preserve">NaN</t></is></c><c r="D3" t="inlineStr"><is><t xml:space="preserve">-Inf</t></is></c></row>`)
+}
+
+func TestColumn(t *testing.T) {
+	assert.Equal(t, "A", column(0))
+	assert.Equal(t, "Z", column(25))
+	assert.Equal(t, "AA", column(26))
+	assert.Equal(t, "BA", column(52))
+}
@@ -0,0 +1,83 @@
+package route
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLBody returns an FieldOption that decodes the request body as YAML into the field.
+func YAMLBody() FieldOption[any] {
+	return Body(decodeYAML)
+}
+
+// YAMLResponse returns an Option that encodes the response as YAML.
+func YAMLResponse() Option {
+	return ResponseEncoder(encodeYAML)
+}
+
+// NegotiatedBody returns an FieldOption that decodes the request body as YAML if its Content-Type
+// is a YAML media type and as JSON otherwise.
+func NegotiatedBody() FieldOption[any] {
+	return RequestValue[any](func(r *http.Request, value any) error {
+		if isYAML(r.Header.Get("Content-Type")) {
+			return decodeYAML(r.Body, value)
+		}
+		return json.NewDecoder(r.Body).Decode(value)
+	})
+}
+
+// NegotiatedResponse returns an Option that encodes the response as YAML if the client accepts
+// a YAML media type but not JSON and as JSON otherwise.
+func NegotiatedResponse() Option {
+	return ResponseEncoder(func(ctx context.Context, w http.ResponseWriter, v any) error {
+		if ex, ok := exchangeFrom(ctx); ok && acceptsYAML(ex.request.Header.Get("Accept")) {
+			return encodeYAML(ctx, w, v)
+		}
+		setContentType(w.Header(), "application/json; charset=utf-8")
+		return json.NewEncoder(w).Encode(v)
+	})
+}
+
+func decodeYAML(r io.Reader, v any) error {
+	return yaml.NewDecoder(r).Decode(v)
+}
+
+func encodeYAML(ctx context.Context, w http.ResponseWriter, v any) error {
+	setContentType(w.Header(), "application/yaml")
+	encoder := yaml.NewEncoder(w)
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func isYAML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+yaml")
+}
+
+func acceptsYAML(accept string) bool {
+	yaml := false
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		mediaType = strings.TrimSpace(mediaType)
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			return false
+		}
+		yaml = yaml || isYAML(mediaType)
+	}
+	return yaml
+}